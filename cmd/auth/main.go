@@ -7,14 +7,28 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"web_auth/internal/adapters/db/postgres"
+	"web_auth/internal/adapters/ldap"
+	"web_auth/internal/adapters/lockout"
+	"web_auth/internal/adapters/mailer"
+	"web_auth/internal/adapters/notifier"
+	"web_auth/internal/adapters/oidc"
+	ratelimitstore "web_auth/internal/adapters/ratelimit"
 	"web_auth/internal/api"
 	"web_auth/internal/config"
+	"web_auth/internal/modules/audit"
 	"web_auth/internal/modules/auth"
 	"web_auth/internal/modules/messages"
+	"web_auth/internal/modules/oauth"
+	"web_auth/internal/modules/ratelimit"
 	"web_auth/internal/utils/mockDB"
+	"web_auth/internal/utils/password"
+	"web_auth/internal/utils/token"
+
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
 const (
@@ -33,16 +47,135 @@ func main() {
 	if err != nil {
 		stlog.Fatal("failed to connect to db")
 	}
-	defer storage.Close(ctx)
+	defer storage.Close()
+
+	tokenManager, err := token.New(cfg.Token)
+	if err != nil {
+		stlog.Fatal("failed to init token manager: ", err)
+	}
+
+	passkeys, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.RPID,
+		RPDisplayName: cfg.WebAuthn.RPDisplayName,
+		RPOrigins:     cfg.WebAuthn.RPOrigins,
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.WebAuthn.Timeout, TimeoutUVD: cfg.WebAuthn.Timeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: cfg.WebAuthn.Timeout, TimeoutUVD: cfg.WebAuthn.Timeout},
+		},
+	})
+	if err != nil {
+		stlog.Fatal("failed to init webauthn: ", err)
+	}
+
+	mailService, err := mailer.New(cfg.Mail, log)
+	if err != nil {
+		stlog.Fatal("failed to init mailer: ", err)
+	}
+
+	hasher, err := password.New(cfg.Password)
+	if err != nil {
+		stlog.Fatal("failed to init password hasher: ", err)
+	}
+
+	passwordPolicy, err := password.NewPolicy(cfg.Password.Policy)
+	if err != nil {
+		stlog.Fatal("failed to init password policy: ", err)
+	}
+
+	var attemptStore auth.AttemptStore
+	switch cfg.Auth.Lockout.Store {
+	case "postgres":
+		attemptStore = storage
+	case "memory":
+		attemptStore = lockout.NewMemory()
+	default:
+		stlog.Fatal("unknown lockout store: ", cfg.Auth.Lockout.Store)
+	}
+
+	var loginNotifier auth.LoginNotifier
+	switch cfg.Auth.LoginNotifier {
+	case "mail":
+		loginNotifier = notifier.NewMail(mailService)
+	case "none":
+	default:
+		stlog.Fatal("unknown login notifier: ", cfg.Auth.LoginNotifier)
+	}
+
+	identityProviders := make(map[string]auth.IdentityProvider, len(cfg.OIDCProviders))
+	for _, providerCfg := range cfg.OIDCProviders {
+		redirectURL := strings.TrimSuffix(cfg.Auth.PublicURL, "/") + "/login/oidc/" + providerCfg.Name + "/callback"
+		provider, err := oidc.New(providerCfg, redirectURL, nil)
+		if err != nil {
+			stlog.Fatal("failed to init identity provider: ", err)
+		}
+		identityProviders[providerCfg.Name] = provider
+	}
+
+	directories := make(map[string]auth.Directory)
+	for _, directoryCfg := range cfg.LDAP {
+		directory, err := ldap.New(directoryCfg)
+		if err != nil {
+			stlog.Fatal("failed to init ldap directory: ", err)
+		}
+		for _, domain := range directoryCfg.Domains {
+			domain = strings.ToLower(domain)
+			if _, ok := directories[domain]; ok {
+				stlog.Fatal("email domain served by two ldap directories: ", domain)
+			}
+			directories[domain] = directory
+		}
+	}
 
-	authService := auth.New(log, storage, storage)
-	messageService := messages.New(log, storage)
+	auditService := audit.New(log, storage)
+	authService := auth.New(log, cfg.Auth, auth.Deps{
+		UserSaver:     storage,
+		UserProvider:  storage,
+		TokenManager:  tokenManager,
+		TokenStore:    storage,
+		RoleStore:     storage,
+		SessionStore:  storage,
+		TOTPStore:     storage,
+		Passkeys:      passkeys,
+		WebAuthnStore: storage,
+		ResetStore:    storage,
+		EmailStore:    storage,
+		GuestStore:    storage,
+		APIKeyStore:   storage,
+		AttemptStore:  attemptStore,
+		Hasher:        hasher,
+		Policy:        passwordPolicy,
+		Mailer:        mailService,
+
+		FederationStore: storage,
+		DirectoryStore:  storage,
+		MagicLinkStore:  storage,
+		AuditLog:        auditService,
+		LoginHistory:    storage,
+		LoginNotifier:   loginNotifier,
+
+		Directories:       directories,
+		IdentityProviders: identityProviders,
+	})
+	messageService := messages.New(log, storage, storage)
+	oauthServer := oauth.New(log, cfg.OAuth, storage, storage, storage, storage, storage, auditService)
 
 	if err = mockDB.SeedDatabase(ctx, storage, cfg.MockDB.UserCount, cfg.MockDB.MsgCount); err != nil {
 		log.Error("can`t create mock for DB")
 	}
 
-	router := api.NewRouter(authService, messageService)
+	if err = authService.BootstrapAdmins(ctx); err != nil {
+		stlog.Fatal("failed to bootstrap admins: ", err)
+	}
+
+	var limiter ratelimit.Store
+	switch cfg.RateLimit.Store {
+	case "memory":
+		limiter = ratelimitstore.NewMemory()
+	default:
+		stlog.Fatal("unknown rate limit store: ", cfg.RateLimit.Store)
+	}
+
+	router := api.NewRouter(authService, messageService, oauthServer, auditService, limiter, cfg.RateLimit)
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.REST.Port),
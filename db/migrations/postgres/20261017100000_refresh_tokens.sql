@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+                                id SERIAL PRIMARY KEY,
+                                user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                family_id UUID NOT NULL,
+                                token_hash VARCHAR(64) UNIQUE NOT NULL,
+                                created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                expires_at TIMESTAMPTZ NOT NULL,
+                                rotated_at TIMESTAMPTZ,
+                                revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS refresh_tokens;
+-- +goose StatementEnd
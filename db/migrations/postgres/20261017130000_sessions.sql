@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sessions (
+                          id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                          user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                          user_agent TEXT NOT NULL DEFAULT '',
+                          ip VARCHAR(45) NOT NULL DEFAULT '',
+                          created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                          last_seen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                          expires_at TIMESTAMPTZ NOT NULL,
+                          revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+-- refresh token families are sessions from now on, older tokens have none
+UPDATE refresh_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE revoked_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS sessions;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_totp (
+                           user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+                           secret VARCHAR(64) NOT NULL,
+                           last_used_step BIGINT NOT NULL DEFAULT 0,
+                           created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                           confirmed_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+                                id SERIAL PRIMARY KEY,
+                                user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                code_hash VARCHAR(64) NOT NULL,
+                                created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_user_id_idx ON recovery_codes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+-- +goose StatementEnd
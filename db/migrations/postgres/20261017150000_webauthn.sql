@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+                                      id SERIAL PRIMARY KEY,
+                                      user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                      credential_id BYTEA UNIQUE NOT NULL,
+                                      public_key BYTEA NOT NULL,
+                                      credential JSONB NOT NULL,
+                                      created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                      last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+CREATE TABLE IF NOT EXISTS webauthn_ceremonies (
+                                     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                                     kind VARCHAR(20) NOT NULL CHECK (kind IN ('registration', 'login')),
+                                     user_id INT REFERENCES users(id) ON DELETE CASCADE,
+                                     session_data JSONB NOT NULL,
+                                     expires_at TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS webauthn_ceremonies;
+DROP TABLE IF EXISTS webauthn_credentials;
+-- +goose StatementEnd
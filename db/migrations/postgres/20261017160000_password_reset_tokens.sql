@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+                                       id SERIAL PRIMARY KEY,
+                                       user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                       token_hash VARCHAR(64) UNIQUE NOT NULL,
+                                       created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                       expires_at TIMESTAMPTZ NOT NULL,
+                                       used_at TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS password_reset_tokens;
+-- +goose StatementEnd
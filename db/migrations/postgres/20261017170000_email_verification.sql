@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_verified_at TIMESTAMPTZ;
+
+-- accounts created before verification existed are trusted as they are
+UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+                                           id SERIAL PRIMARY KEY,
+                                           user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                           token_hash VARCHAR(64) UNIQUE NOT NULL,
+                                           created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                           expires_at TIMESTAMPTZ NOT NULL,
+                                           used_at TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS email_verification_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS email_verified_at;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS email_change_tokens (
+                                     id SERIAL PRIMARY KEY,
+                                     user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                     new_email VARCHAR(255) NOT NULL,
+                                     token_hash VARCHAR(64) UNIQUE NOT NULL,
+                                     created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                     expires_at TIMESTAMPTZ NOT NULL,
+                                     used_at TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS email_change_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE anonymous_users SET identifier = gen_random_uuid() WHERE identifier IS NULL;
+ALTER TABLE anonymous_users ALTER COLUMN identifier SET NOT NULL;
+ALTER TABLE anonymous_users ADD CONSTRAINT anonymous_users_identifier_key UNIQUE (identifier);
+-- a guest merged into a registered account keeps its row for the record but can't be used anymore
+ALTER TABLE anonymous_users ADD COLUMN IF NOT EXISTS merged_into INT REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE anonymous_users ADD COLUMN IF NOT EXISTS merged_at TIMESTAMPTZ;
+
+-- messages belong to either a user or a guest
+ALTER TABLE user_messages ALTER COLUMN user_id DROP NOT NULL;
+ALTER TABLE user_messages ADD COLUMN IF NOT EXISTS anonymous_user_id INT REFERENCES anonymous_users(id) ON DELETE CASCADE;
+ALTER TABLE user_messages ADD CONSTRAINT user_messages_owner_check
+    CHECK ((user_id IS NULL) <> (anonymous_user_id IS NULL));
+CREATE INDEX IF NOT EXISTS user_messages_anonymous_user_id_idx ON user_messages (anonymous_user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM user_messages WHERE user_id IS NULL;
+DROP INDEX IF EXISTS user_messages_anonymous_user_id_idx;
+ALTER TABLE user_messages DROP CONSTRAINT IF EXISTS user_messages_owner_check;
+ALTER TABLE user_messages DROP COLUMN IF EXISTS anonymous_user_id;
+ALTER TABLE user_messages ALTER COLUMN user_id SET NOT NULL;
+ALTER TABLE anonymous_users DROP COLUMN IF EXISTS merged_at;
+ALTER TABLE anonymous_users DROP COLUMN IF EXISTS merged_into;
+ALTER TABLE anonymous_users DROP CONSTRAINT IF EXISTS anonymous_users_identifier_key;
+ALTER TABLE anonymous_users ALTER COLUMN identifier DROP NOT NULL;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS api_keys (
+                          id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                          user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                          name VARCHAR(100) NOT NULL,
+                          prefix VARCHAR(16) NOT NULL,
+                          key_hash VARCHAR(64) UNIQUE NOT NULL,
+                          scopes TEXT[] NOT NULL DEFAULT '{}',
+                          created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                          expires_at TIMESTAMPTZ,
+                          last_used_at TIMESTAMPTZ,
+                          revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,60 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS oauth_clients (
+                               id VARCHAR(64) PRIMARY KEY,
+                               name VARCHAR(100) NOT NULL,
+                               -- NULL for public clients, which authenticate with PKCE only
+                               secret_hash VARCHAR(64),
+                               redirect_uris TEXT[] NOT NULL DEFAULT '{}',
+                               grant_types TEXT[] NOT NULL DEFAULT '{}',
+                               scopes TEXT[] NOT NULL DEFAULT '{}',
+                               created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorization_codes (
+                                           code_hash VARCHAR(64) PRIMARY KEY,
+                                           grant_id UUID NOT NULL,
+                                           client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+                                           user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                           redirect_uri TEXT NOT NULL,
+                                           scopes TEXT[] NOT NULL DEFAULT '{}',
+                                           code_challenge VARCHAR(128) NOT NULL,
+                                           created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                           expires_at TIMESTAMPTZ NOT NULL,
+                                           used_at TIMESTAMPTZ
+);
+
+-- access and refresh tokens of one authorization share a grant_id and are revoked together
+CREATE TABLE IF NOT EXISTS oauth_tokens (
+                              id SERIAL PRIMARY KEY,
+                              grant_id UUID NOT NULL,
+                              kind VARCHAR(10) NOT NULL CHECK (kind IN ('access', 'refresh')),
+                              token_hash VARCHAR(64) UNIQUE NOT NULL,
+                              client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+                              -- NULL for client credentials tokens
+                              user_id INT REFERENCES users(id) ON DELETE CASCADE,
+                              scopes TEXT[] NOT NULL DEFAULT '{}',
+                              created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                              expires_at TIMESTAMPTZ NOT NULL,
+                              revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS oauth_tokens_grant_id_idx ON oauth_tokens (grant_id);
+
+INSERT INTO permissions (name) VALUES ('oauth:clients')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name = 'oauth:clients'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'oauth:clients';
+DROP TABLE IF EXISTS oauth_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_clients;
+-- +goose StatementEnd
@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- RSA keys signing ID tokens, the newest one is active. Older keys stay
+-- published in the JWKS until the ID tokens they signed have expired.
+CREATE TABLE IF NOT EXISTS oidc_signing_keys (
+                                   kid VARCHAR(64) PRIMARY KEY,
+                                   algorithm VARCHAR(10) NOT NULL,
+                                   private_key TEXT NOT NULL,
+                                   created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE oauth_authorization_codes
+    ADD COLUMN IF NOT EXISTS nonce VARCHAR(255) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS nonce;
+DROP TABLE IF EXISTS oidc_signing_keys;
+-- +goose StatementEnd
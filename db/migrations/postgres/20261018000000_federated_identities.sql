@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS federated_identities (
+                                      provider VARCHAR(50) NOT NULL,
+                                      subject VARCHAR(255) NOT NULL,
+                                      user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                                      email VARCHAR(255) NOT NULL DEFAULT '',
+                                      created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                                      last_login_at TIMESTAMPTZ,
+                                      PRIMARY KEY (provider, subject),
+                                      -- one account per provider and user
+                                      UNIQUE (user_id, provider)
+);
+
+-- pending sign ins, keyed by the hash of the OAuth state parameter
+CREATE TABLE IF NOT EXISTS federated_logins (
+                                  state_hash VARCHAR(64) PRIMARY KEY,
+                                  provider VARCHAR(50) NOT NULL,
+                                  nonce VARCHAR(128) NOT NULL,
+                                  code_verifier VARCHAR(128) NOT NULL,
+                                  expires_at TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS federated_logins;
+DROP TABLE IF EXISTS federated_identities;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS magic_links (
+                             id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+                             user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                             email VARCHAR(255) NOT NULL,
+                             -- hash of the nonce cookie of the browser that asked for the link
+                             nonce_hash VARCHAR(64) NOT NULL,
+                             created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+                             expires_at TIMESTAMPTZ NOT NULL,
+                             used_at TIMESTAMPTZ
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS magic_links;
+-- +goose StatementEnd
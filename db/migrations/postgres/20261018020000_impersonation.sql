@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- the admin acting as the session's user
+ALTER TABLE sessions ADD COLUMN IF NOT EXISTS impersonator_id INT REFERENCES users(id) ON DELETE CASCADE;
+
+INSERT INTO permissions (name) VALUES ('users:impersonate')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name = 'users:impersonate'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'users:impersonate';
+ALTER TABLE sessions DROP COLUMN IF EXISTS impersonator_id;
+-- +goose StatementEnd
@@ -0,0 +1,48 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS audit_events (
+                              id BIGSERIAL PRIMARY KEY,
+                              type VARCHAR(50) NOT NULL,
+                              outcome VARCHAR(10) NOT NULL,
+                              -- no foreign keys, the log outlives deleted users
+                              actor_id INT,
+                              target_id INT,
+                              ip VARCHAR(45) NOT NULL DEFAULT '',
+                              user_agent TEXT NOT NULL DEFAULT '',
+                              details TEXT NOT NULL DEFAULT '',
+                              created_at TIMESTAMPTZ NOT NULL,
+                              prev_hash VARCHAR(64) NOT NULL,
+                              hash VARCHAR(64) UNIQUE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS audit_events_target_id_idx ON audit_events (target_id);
+CREATE INDEX IF NOT EXISTS audit_events_type_created_at_idx ON audit_events (type, created_at);
+CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (name) VALUES ('audit:read')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name = 'audit:read'
+ON CONFLICT DO NOTHING;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM permissions WHERE name = 'audit:read';
+DROP TABLE IF EXISTS audit_events;
+DROP FUNCTION IF EXISTS audit_events_append_only();
+-- +goose StatementEnd
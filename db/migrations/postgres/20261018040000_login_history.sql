@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS login_history (
+                             id BIGSERIAL PRIMARY KEY,
+                             user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+                             method VARCHAR(32) NOT NULL,
+                             result VARCHAR(16) NOT NULL,
+                             ip VARCHAR(45) NOT NULL DEFAULT '',
+                             user_agent TEXT NOT NULL DEFAULT '',
+                             -- SHA-256 of the browser family and OS from the user agent, versions ignored
+                             device VARCHAR(64) NOT NULL,
+                             -- /24 for IPv4, /48 for IPv6
+                             ip_range VARCHAR(64) NOT NULL,
+                             created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_history_user ON login_history (user_id, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_history;
+-- +goose StatementEnd
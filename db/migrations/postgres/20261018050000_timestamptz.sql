@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- TIMESTAMP drops the zone of the times the app writes, so expiry checks
+-- against time.Now() were off by the app's UTC offset. Existing values are
+-- read in the session time zone, the one CURRENT_TIMESTAMP defaults used.
+ALTER TABLE users ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE user_messages ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE anonymous_users ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE anonymous_users ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE user_messages ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE users ALTER COLUMN created_at TYPE TIMESTAMP;
+-- +goose StatementEnd
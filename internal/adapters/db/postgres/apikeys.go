@@ -0,0 +1,124 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const apiKeyColumns = `id::text, user_id, name, prefix, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func scanAPIKey(row pgx.Row, key *models.APIKey) error {
+	return row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.Scopes,
+		&key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &key.RevokedAt)
+}
+
+func (s *Storage) SaveAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error {
+	const op = "postgres.SaveAPIKey"
+
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id::text, created_at;
+	`
+
+	err := s.db.QueryRow(ctx, query, key.UserID, key.Name, key.Prefix, keyHash, key.Scopes, key.ExpiresAt).
+		Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) APIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	const op = "postgres.APIKeyByHash"
+
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1;`
+
+	var key models.APIKey
+	err := scanAPIKey(s.db.QueryRow(ctx, query, keyHash), &key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, auth.ErrAPIKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &key, nil
+}
+
+func (s *Storage) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	const op = "postgres.ListAPIKeys"
+
+	query := `
+		SELECT ` + apiKeyColumns + `
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC;
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var key models.APIKey
+		if err := scanAPIKey(rows, &key); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) RevokeAPIKey(ctx context.Context, userID int64, keyID string) error {
+	const op = "postgres.RevokeAPIKey"
+
+	query := `
+		UPDATE api_keys
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1::uuid AND user_id = $2 AND revoked_at IS NULL;
+	`
+
+	cmdTag, err := s.db.Exec(ctx, query, keyID, userID)
+	if isInvalidUUID(err) {
+		return auth.ErrAPIKeyNotFound
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) TouchAPIKey(ctx context.Context, keyID string) error {
+	const op = "postgres.TouchAPIKey"
+
+	query := `
+		UPDATE api_keys
+		SET last_used_at = CURRENT_TIMESTAMP
+		WHERE id = $1::uuid AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute');
+	`
+
+	if _, err := s.db.Exec(ctx, query, keyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
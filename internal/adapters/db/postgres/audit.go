@@ -0,0 +1,143 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"web_auth/internal/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// auditChainLock is the advisory lock serializing audit log appends.
+const auditChainLock = 0x61756469
+
+const auditEventColumns = `id, type, outcome, actor_id, target_id, ip, user_agent, details, created_at, prev_hash, hash`
+
+func scanAuditEvent(row pgx.Row, event *models.AuditEvent) error {
+	return row.Scan(&event.ID, &event.Type, &event.Outcome, &event.ActorID, &event.TargetID, &event.IP,
+		&event.UserAgent, &event.Details, &event.CreatedAt, &event.PrevHash, &event.Hash)
+}
+
+func (s *Storage) AppendAuditEvent(ctx context.Context, event *models.AuditEvent,
+	hash func(*models.AuditEvent) string,
+) error {
+	const op = "postgres.AppendAuditEvent"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1);`, auditChainLock); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var prevHash string
+	err = tx.QueryRow(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1;`).Scan(&prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	event.PrevHash = prevHash
+	// postgres keeps microseconds, the hash must survive the round trip
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	event.Hash = hash(event)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO audit_events (type, outcome, actor_id, target_id, ip, user_agent, details, created_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id;
+	`, event.Type, event.Outcome, event.ActorID, event.TargetID, event.IP, event.UserAgent, event.Details,
+		event.CreatedAt, event.PrevHash, event.Hash).Scan(&event.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	const op = "postgres.ListAuditEvents"
+
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.UserID != nil {
+		p := arg(*filter.UserID)
+		where = append(where, "(actor_id = "+p+" OR target_id = "+p+")")
+	}
+	if filter.Type != "" {
+		where = append(where, "type = "+arg(filter.Type))
+	}
+	if filter.From != nil {
+		where = append(where, "created_at >= "+arg(*filter.From))
+	}
+	if filter.To != nil {
+		where = append(where, "created_at < "+arg(*filter.To))
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC LIMIT ` + arg(filter.Limit) + ` OFFSET ` + arg(filter.Offset) + `;`
+
+	events, err := s.queryAuditEvents(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+func (s *Storage) AuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]models.AuditEvent, error) {
+	const op = "postgres.AuditEventsAfter"
+
+	query := `
+		SELECT ` + auditEventColumns + `
+		FROM audit_events
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2;
+	`
+
+	events, err := s.queryAuditEvents(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+func (s *Storage) queryAuditEvents(ctx context.Context, query string, args ...any) ([]models.AuditEvent, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		if err := scanAuditEvent(rows, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
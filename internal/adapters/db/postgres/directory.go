@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s *Storage) SaveDirectoryUser(ctx context.Context, email string) (int64, error) {
+	const op = "postgres.SaveDirectoryUser"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		INSERT INTO users (email, password, email_verified_at)
+		VALUES ($1, '', CURRENT_TIMESTAMP)
+		RETURNING id;
+	`
+
+	var uid int64
+	err = tx.QueryRow(ctx, query, email).Scan(&uid)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, auth.ErrUserExists
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := assignRole(ctx, tx, uid, models.RoleUser); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uid, nil
+}
+
+func (s *Storage) SyncRoles(ctx context.Context, userID int64, roles, managed []string) error {
+	const op = "postgres.SyncRoles"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT $1, id FROM roles WHERE name = ANY($2)
+		ON CONFLICT DO NOTHING;
+	`, userID, roles)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM user_roles
+		USING roles
+		WHERE user_roles.role_id = roles.id
+			AND user_roles.user_id = $1
+			AND roles.name = ANY($2)
+			AND NOT roles.name = ANY($3);
+	`, userID, managed, roles)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s *Storage) SaveEmailVerificationToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	const op = "postgres.SaveEmailVerificationToken"
+
+	query := `
+		INSERT INTO email_verification_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3);
+	`
+
+	if _, err := s.db.Exec(ctx, query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// VerifyEmail burns the verification token and marks the owner's email as
+// verified. It returns auth.ErrInvalidToken if the token is unknown, used or
+// expired.
+func (s *Storage) VerifyEmail(ctx context.Context, tokenHash string) (int64, error) {
+	const op = "postgres.VerifyEmail"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, `
+		UPDATE email_verification_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id;
+	`, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, auth.ErrInvalidToken
+	} else if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP)
+		WHERE id = $1;
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// SaveEmailChangeToken stores a pending email change and cancels the user's
+// earlier pending changes.
+func (s *Storage) SaveEmailChangeToken(ctx context.Context, userID int64, newEmail, tokenHash string, expiresAt time.Time) error {
+	const op = "postgres.SaveEmailChangeToken"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE email_change_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO email_change_tokens (user_id, new_email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4);
+	`, userID, newEmail, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ChangeEmail burns the change token and swaps the owner's email for the
+// confirmed one. It returns auth.ErrInvalidToken if the token is unknown,
+// used or expired and auth.ErrUserExists if the address was taken meanwhile.
+func (s *Storage) ChangeEmail(ctx context.Context, tokenHash string) (int64, error) {
+	const op = "postgres.ChangeEmail"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		userID   int64
+		newEmail string
+	)
+	err = tx.QueryRow(ctx, `
+		UPDATE email_change_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id, new_email;
+	`, tokenHash).Scan(&userID, &newEmail)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, auth.ErrInvalidToken
+	} else if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET email = $2,
+		    email_verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1;
+	`, userID, newEmail)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, auth.ErrUserExists
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
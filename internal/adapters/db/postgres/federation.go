@@ -0,0 +1,204 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s *Storage) SaveFederatedLogin(ctx context.Context, stateHash string, login *models.FederatedLogin) error {
+	const op = "postgres.SaveFederatedLogin"
+
+	query := `
+		INSERT INTO federated_logins (state_hash, provider, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	_, err := s.db.Exec(ctx, query, stateHash, login.Provider, login.Nonce, login.CodeVerifier, login.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) TakeFederatedLogin(ctx context.Context, stateHash string) (*models.FederatedLogin, error) {
+	const op = "postgres.TakeFederatedLogin"
+
+	query := `
+		DELETE FROM federated_logins
+		WHERE state_hash = $1
+		RETURNING provider, nonce, code_verifier, expires_at;
+	`
+
+	var login models.FederatedLogin
+	err := s.db.QueryRow(ctx, query, stateHash).
+		Scan(&login.Provider, &login.Nonce, &login.CodeVerifier, &login.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, auth.ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &login, nil
+}
+
+func (s *Storage) FederatedIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error) {
+	const op = "postgres.FederatedIdentity"
+
+	query := `
+		SELECT user_id, provider, subject, email, created_at, last_login_at
+		FROM federated_identities
+		WHERE provider = $1 AND subject = $2;
+	`
+
+	var identity models.FederatedIdentity
+	err := s.db.QueryRow(ctx, query, provider, subject).Scan(&identity.UserID, &identity.Provider,
+		&identity.Subject, &identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, auth.ErrIdentityNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &identity, nil
+}
+
+func (s *Storage) LinkFederatedIdentity(ctx context.Context, identity *models.FederatedIdentity) error {
+	const op = "postgres.LinkFederatedIdentity"
+
+	if err := insertFederatedIdentity(ctx, s.db, identity); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return auth.ErrUserExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveFederatedUser(ctx context.Context, identity *models.FederatedIdentity, emailVerified bool,
+) (int64, error) {
+	const op = "postgres.SaveFederatedUser"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var uid int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (email, password, email_verified_at)
+		VALUES ($1, '', CASE WHEN $2 THEN CURRENT_TIMESTAMP END)
+		RETURNING id;
+	`, identity.Email, emailVerified).Scan(&uid)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, auth.ErrUserExists
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := assignRole(ctx, tx, uid, models.RoleUser); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	identity.UserID = uid
+	if err := insertFederatedIdentity(ctx, tx, identity); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uid, nil
+}
+
+// rowQuerier is implemented by both the connection and transactions.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func insertFederatedIdentity(ctx context.Context, q rowQuerier, identity *models.FederatedIdentity) error {
+	return q.QueryRow(ctx, `
+		INSERT INTO federated_identities (provider, subject, user_id, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		RETURNING created_at, last_login_at;
+	`, identity.Provider, identity.Subject, identity.UserID, identity.Email).
+		Scan(&identity.CreatedAt, &identity.LastLoginAt)
+}
+
+func (s *Storage) TouchFederatedIdentity(ctx context.Context, provider, subject string) error {
+	const op = "postgres.TouchFederatedIdentity"
+
+	query := `
+		UPDATE federated_identities
+		SET last_login_at = CURRENT_TIMESTAMP
+		WHERE provider = $1 AND subject = $2;
+	`
+
+	if _, err := s.db.Exec(ctx, query, provider, subject); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListFederatedIdentities(ctx context.Context, userID int64) ([]models.FederatedIdentity, error) {
+	const op = "postgres.ListFederatedIdentities"
+
+	query := `
+		SELECT user_id, provider, subject, email, created_at, last_login_at
+		FROM federated_identities
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var identities []models.FederatedIdentity
+	for rows.Next() {
+		var identity models.FederatedIdentity
+		if err := rows.Scan(&identity.UserID, &identity.Provider, &identity.Subject, &identity.Email,
+			&identity.CreatedAt, &identity.LastLoginAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return identities, nil
+}
+
+func (s *Storage) UnlinkFederatedIdentity(ctx context.Context, userID int64, provider string) error {
+	const op = "postgres.UnlinkFederatedIdentity"
+
+	cmdTag, err := s.db.Exec(ctx, `DELETE FROM federated_identities WHERE user_id = $1 AND provider = $2;`,
+		userID, provider)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrIdentityNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s *Storage) CreateGuest(ctx context.Context) (*models.Guest, error) {
+	const op = "postgres.CreateGuest"
+
+	query := `
+		INSERT INTO anonymous_users DEFAULT VALUES
+		RETURNING id, identifier::text, created_at;
+	`
+
+	var guest models.Guest
+	if err := s.db.QueryRow(ctx, query).Scan(&guest.ID, &guest.Identifier, &guest.CreatedAt); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &guest, nil
+}
+
+// GuestByIdentifier returns a guest that hasn't been merged into an account.
+func (s *Storage) GuestByIdentifier(ctx context.Context, identifier string) (*models.Guest, error) {
+	const op = "postgres.GuestByIdentifier"
+
+	query := `
+		SELECT id, identifier::text, created_at
+		FROM anonymous_users
+		WHERE identifier = $1::uuid AND merged_at IS NULL;
+	`
+
+	var guest models.Guest
+	err := s.db.QueryRow(ctx, query, identifier).Scan(&guest.ID, &guest.Identifier, &guest.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) || isInvalidUUID(err) {
+		return nil, auth.ErrGuestNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &guest, nil
+}
+
+// SaveUserFromGuest creates a user with the default role and moves the
+// guest's data to it in one transaction, so either the account exists with
+// everything the guest owned or nothing changes. It returns
+// auth.ErrGuestNotFound if the guest is unknown or already merged.
+func (s *Storage) SaveUserFromGuest(ctx context.Context, email string, passHash []byte, identifier string) (int64, error) {
+	const op = "postgres.SaveUserFromGuest"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var uid int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO users (email, password)
+		VALUES ($1, $2)
+		RETURNING id;
+	`, email, passHash).Scan(&uid)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return 0, auth.ErrUserExists
+		}
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := assignRole(ctx, tx, uid, models.RoleUser); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The update locks the guest row, a concurrent merge of the same guest
+	// waits for it and then finds merged_at set.
+	var guestID int64
+	err = tx.QueryRow(ctx, `
+		UPDATE anonymous_users
+		SET merged_into = $2,
+		    merged_at = CURRENT_TIMESTAMP
+		WHERE identifier = $1::uuid AND merged_at IS NULL
+		RETURNING id;
+	`, identifier, uid).Scan(&guestID)
+	if errors.Is(err, pgx.ErrNoRows) || isInvalidUUID(err) {
+		return 0, auth.ErrGuestNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE user_messages
+		SET user_id = $2,
+		    anonymous_user_id = NULL
+		WHERE anonymous_user_id = $1;
+	`, guestID, uid)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return uid, nil
+}
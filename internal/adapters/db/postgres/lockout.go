@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *Storage) AttemptLockout(ctx context.Context, key string) (time.Duration, error) {
+	const op = "postgres.AttemptLockout"
+
+	query := `
+		SELECT COALESCE(EXTRACT(EPOCH FROM MAX(locked_until) - CURRENT_TIMESTAMP), 0)::float8
+		FROM login_attempts
+		WHERE key = $1 AND locked_until > CURRENT_TIMESTAMP;
+	`
+
+	var seconds float64
+	if err := s.db.QueryRow(ctx, query, key).Scan(&seconds); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// RecordFailedAttempt starts the count over once the key has been quiet, i.e.
+// neither failing nor locked, for window.
+func (s *Storage) RecordFailedAttempt(ctx context.Context, key string, window time.Duration) (int, error) {
+	const op = "postgres.RecordFailedAttempt"
+
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES ($1, 1, CURRENT_TIMESTAMP)
+		ON CONFLICT (key) DO UPDATE
+		SET failures = CASE
+				WHEN GREATEST(login_attempts.last_failure_at, login_attempts.locked_until)
+					< CURRENT_TIMESTAMP - $2 * INTERVAL '1 second' THEN 1
+				ELSE login_attempts.failures + 1
+			END,
+			last_failure_at = CURRENT_TIMESTAMP
+		RETURNING failures;
+	`
+
+	var failures int
+	if err := s.db.QueryRow(ctx, query, key, window.Seconds()).Scan(&failures); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return failures, nil
+}
+
+func (s *Storage) LockAttempts(ctx context.Context, key string, d time.Duration) error {
+	const op = "postgres.LockAttempts"
+
+	query := `
+		UPDATE login_attempts
+		SET locked_until = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second'
+		WHERE key = $1;
+	`
+
+	if _, err := s.db.Exec(ctx, query, key, d.Seconds()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ResetAttempts(ctx context.Context, key string) error {
+	const op = "postgres.ResetAttempts"
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM login_attempts WHERE key = $1;`, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
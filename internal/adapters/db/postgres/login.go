@@ -0,0 +1,85 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"web_auth/internal/models"
+)
+
+func (s *Storage) SaveLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error {
+	const op = "postgres.SaveLoginAttempt"
+
+	query := `
+		INSERT INTO login_history (user_id, method, result, ip, user_agent, device, ip_range)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at;
+	`
+
+	err := s.db.QueryRow(ctx, query, attempt.UserID, attempt.Method, attempt.Result, attempt.IP,
+		attempt.UserAgent, attempt.Device, attempt.IPRange).Scan(&attempt.ID, &attempt.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// ListLoginAttempts returns the user's login history, newest first.
+func (s *Storage) ListLoginAttempts(ctx context.Context, userID int64, limit, offset int,
+) ([]models.LoginAttempt, error) {
+	const op = "postgres.ListLoginAttempts"
+
+	query := `
+		SELECT id, user_id, method, result, ip, user_agent, device, ip_range, created_at
+		FROM login_history
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3;
+	`
+
+	rows, err := s.db.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	attempts := make([]models.LoginAttempt, 0, limit)
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		if err := rows.Scan(&attempt.ID, &attempt.UserID, &attempt.Method, &attempt.Result, &attempt.IP,
+			&attempt.UserAgent, &attempt.Device, &attempt.IPRange, &attempt.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return attempts, nil
+}
+
+// LoginOrigin checks the user's successful logins for the device and IP
+// range.
+func (s *Storage) LoginOrigin(ctx context.Context, userID int64, device, ipRange string) (*models.LoginOrigin, error) {
+	const op = "postgres.LoginOrigin"
+
+	query := `
+		SELECT count(*) = 0,
+		       COALESCE(bool_or(device = $2), false),
+		       COALESCE(bool_or(ip_range = $3), false)
+		FROM login_history
+		WHERE user_id = $1 AND result = $4;
+	`
+
+	var origin models.LoginOrigin
+	err := s.db.QueryRow(ctx, query, userID, device, ipRange, models.LoginSuccess).
+		Scan(&origin.FirstLogin, &origin.KnownDevice, &origin.KnownIPRange)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &origin, nil
+}
@@ -0,0 +1,54 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) SaveMagicLink(ctx context.Context, link *models.MagicLink) error {
+	const op = "postgres.SaveMagicLink"
+
+	query := `
+		INSERT INTO magic_links (user_id, email, nonce_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id::text;
+	`
+
+	err := s.db.QueryRow(ctx, query, link.UserID, link.Email, link.NonceHash, link.ExpiresAt).Scan(&link.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeMagicLink marks the link used and returns it. It returns
+// auth.ErrInvalidToken if the link is unknown, used, expired or was requested
+// with another nonce; such attempts leave the link usable.
+func (s *Storage) TakeMagicLink(ctx context.Context, linkID, nonceHash string) (*models.MagicLink, error) {
+	const op = "postgres.TakeMagicLink"
+
+	query := `
+		UPDATE magic_links
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE id = $1::uuid AND nonce_hash = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id::text, user_id, email, nonce_hash, expires_at;
+	`
+
+	var link models.MagicLink
+	err := s.db.QueryRow(ctx, query, linkID, nonceHash).
+		Scan(&link.ID, &link.UserID, &link.Email, &link.NonceHash, &link.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) || isInvalidUUID(err) {
+		return nil, auth.ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &link, nil
+}
@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SaveTOTPSecret starts or restarts an enrollment. A confirmed secret is never
+// overwritten.
+func (s *Storage) SaveTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	const op = "postgres.SaveTOTPSecret"
+
+	query := `
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed_at IS NULL;
+	`
+
+	cmdTag, err := s.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (s *Storage) TOTPByUserID(ctx context.Context, userID int64) (*models.TOTP, error) {
+	const op = "postgres.TOTPByUserID"
+
+	query := `
+		SELECT user_id, secret, last_used_step, created_at, confirmed_at
+		FROM user_totp
+		WHERE user_id = $1;
+	`
+
+	var totp models.TOTP
+	err := s.db.QueryRow(ctx, query, userID).
+		Scan(&totp.UserID, &totp.Secret, &totp.LastUsedStep, &totp.CreatedAt, &totp.ConfirmedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, auth.ErrTOTPNotEnabled
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &totp, nil
+}
+
+// UseTOTPStep records the time step of an accepted code. It returns
+// auth.ErrInvalidOTP if that step or a later one was already used.
+func (s *Storage) UseTOTPStep(ctx context.Context, userID, step int64) error {
+	const op = "postgres.UseTOTPStep"
+
+	query := `
+		UPDATE user_totp
+		SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2;
+	`
+
+	cmdTag, err := s.db.Exec(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrInvalidOTP
+	}
+
+	return nil
+}
+
+// ConfirmTOTP enables the second factor and replaces the recovery codes.
+func (s *Storage) ConfirmTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	const op = "postgres.ConfirmTOTP"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	cmdTag, err := tx.Exec(ctx, `
+		UPDATE user_totp
+		SET confirmed_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND confirmed_at IS NULL;
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrTOTPAlreadyEnabled
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO recovery_codes (user_id, code_hash)
+		SELECT $1, unnest($2::text[]);
+	`, userID, recoveryCodeHashes)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteTOTP(ctx context.Context, userID int64) error {
+	const op = "postgres.DeleteTOTP"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1;`, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode burns an unused recovery code. It returns auth.ErrInvalidOTP
+// if there is none with that hash.
+func (s *Storage) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error {
+	const op = "postgres.UseRecoveryCode"
+
+	query := `
+		UPDATE recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE id = (
+			SELECT id FROM recovery_codes
+			WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+			LIMIT 1
+		);
+	`
+
+	cmdTag, err := s.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrInvalidOTP
+	}
+
+	return nil
+}
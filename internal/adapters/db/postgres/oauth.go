@@ -0,0 +1,283 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/oauth"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const oauthClientColumns = `id, name, COALESCE(secret_hash, ''), redirect_uris, grant_types, scopes, created_at`
+
+func scanOAuthClient(row pgx.Row, client *models.OAuthClient) error {
+	return row.Scan(&client.ID, &client.Name, &client.SecretHash,
+		&client.RedirectURIs, &client.GrantTypes, &client.Scopes, &client.CreatedAt)
+}
+
+const oauthTokenColumns = `id, grant_id::text, kind, token_hash, client_id, user_id, scopes, created_at, expires_at, revoked_at`
+
+func (s *Storage) SaveOAuthClient(ctx context.Context, client *models.OAuthClient) error {
+	const op = "postgres.SaveOAuthClient"
+
+	query := `
+		INSERT INTO oauth_clients (id, name, secret_hash, redirect_uris, grant_types, scopes)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6)
+		RETURNING created_at;
+	`
+
+	err := s.db.QueryRow(ctx, query, client.ID, client.Name, client.SecretHash,
+		nonNil(client.RedirectURIs), nonNil(client.GrantTypes), nonNil(client.Scopes)).
+		Scan(&client.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) OAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	const op = "postgres.OAuthClient"
+
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE id = $1;`
+
+	var client models.OAuthClient
+	err := scanOAuthClient(s.db.QueryRow(ctx, query, clientID), &client)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, oauth.ErrClientNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &client, nil
+}
+
+func (s *Storage) ListOAuthClients(ctx context.Context) ([]models.OAuthClient, error) {
+	const op = "postgres.ListOAuthClients"
+
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY created_at;`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var clients []models.OAuthClient
+	for rows.Next() {
+		var client models.OAuthClient
+		if err := scanOAuthClient(rows, &client); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		clients = append(clients, client)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clients, nil
+}
+
+func (s *Storage) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	const op = "postgres.DeleteOAuthClient"
+
+	cmdTag, err := s.db.Exec(ctx, `DELETE FROM oauth_clients WHERE id = $1;`, clientID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return oauth.ErrClientNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) SaveAuthorizationCode(ctx context.Context, code *models.OAuthCode) error {
+	const op = "postgres.SaveAuthorizationCode"
+
+	query := `
+		INSERT INTO oauth_authorization_codes
+			(code_hash, grant_id, client_id, user_id, redirect_uri, scopes, code_challenge, nonce, expires_at)
+		VALUES ($1, $2::uuid, $3, $4, $5, $6, $7, $8, $9);
+	`
+
+	_, err := s.db.Exec(ctx, query, code.CodeHash, code.GrantID, code.ClientID, code.UserID,
+		code.RedirectURI, nonNil(code.Scopes), code.CodeChallenge, code.Nonce, code.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// TakeAuthorizationCode locks the code row while marking it used, so
+// concurrent exchanges of the same code can't both succeed.
+func (s *Storage) TakeAuthorizationCode(ctx context.Context, codeHash string) (*models.OAuthCode, error) {
+	const op = "postgres.TakeAuthorizationCode"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		code   models.OAuthCode
+		usedAt *time.Time
+	)
+	err = tx.QueryRow(ctx, `
+		SELECT code_hash, grant_id::text, client_id, user_id, redirect_uri, scopes, code_challenge, nonce,
+			expires_at, used_at
+		FROM oauth_authorization_codes
+		WHERE code_hash = $1
+		FOR UPDATE;
+	`, codeHash).Scan(&code.CodeHash, &code.GrantID, &code.ClientID, &code.UserID,
+		&code.RedirectURI, &code.Scopes, &code.CodeChallenge, &code.Nonce, &code.ExpiresAt, &usedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, oauth.ErrCodeNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if usedAt != nil {
+		return &code, oauth.ErrCodeReused
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE oauth_authorization_codes SET used_at = CURRENT_TIMESTAMP WHERE code_hash = $1;`, codeHash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &code, nil
+}
+
+func (s *Storage) SaveOAuthTokens(ctx context.Context, tokens ...*models.OAuthToken) error {
+	const op = "postgres.SaveOAuthTokens"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := insertOAuthTokens(ctx, tx, tokens); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) OAuthTokenByHash(ctx context.Context, tokenHash string) (*models.OAuthToken, error) {
+	const op = "postgres.OAuthTokenByHash"
+
+	query := `SELECT ` + oauthTokenColumns + ` FROM oauth_tokens WHERE token_hash = $1;`
+
+	var t models.OAuthToken
+	err := s.db.QueryRow(ctx, query, tokenHash).Scan(&t.ID, &t.GrantID, &t.Kind, &t.TokenHash,
+		&t.ClientID, &t.UserID, &t.Scopes, &t.CreatedAt, &t.ExpiresAt, &t.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, oauth.ErrTokenNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &t, nil
+}
+
+// RotateOAuthRefreshToken revokes the presented refresh token and the access
+// tokens issued with it, then stores their successors.
+func (s *Storage) RotateOAuthRefreshToken(ctx context.Context, refreshID int64, tokens ...*models.OAuthToken) error {
+	const op = "postgres.RotateOAuthRefreshToken"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var grantID string
+	err = tx.QueryRow(ctx, `
+		UPDATE oauth_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL
+		RETURNING grant_id::text;
+	`, refreshID).Scan(&grantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return oauth.ErrTokenNotFound
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE oauth_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE grant_id = $1::uuid AND kind = 'access' AND revoked_at IS NULL;
+	`, grantID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := insertOAuthTokens(ctx, tx, tokens); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RevokeOAuthGrant(ctx context.Context, grantID string) error {
+	const op = "postgres.RevokeOAuthGrant"
+
+	query := `
+		UPDATE oauth_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE grant_id = $1::uuid AND revoked_at IS NULL;
+	`
+
+	if _, err := s.db.Exec(ctx, query, grantID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func insertOAuthTokens(ctx context.Context, tx pgx.Tx, tokens []*models.OAuthToken) error {
+	for _, t := range tokens {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO oauth_tokens (grant_id, kind, token_hash, client_id, user_id, scopes, expires_at)
+			VALUES ($1::uuid, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at;
+		`, t.GrantID, t.Kind, t.TokenHash, t.ClientID, t.UserID, nonNil(t.Scopes), t.ExpiresAt).
+			Scan(&t.ID, &t.CreatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nonNil keeps NOT NULL array columns from receiving NULL for nil slices.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,66 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"web_auth/internal/models"
+)
+
+func (s *Storage) SaveSigningKey(ctx context.Context, key *models.SigningKey) error {
+	const op = "postgres.SaveSigningKey"
+
+	query := `
+		INSERT INTO oidc_signing_keys (kid, algorithm, private_key)
+		VALUES ($1, $2, $3)
+		RETURNING created_at;
+	`
+
+	err := s.db.QueryRow(ctx, query, key.ID, key.Algorithm, key.PrivateKey).Scan(&key.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	const op = "postgres.SigningKeys"
+
+	query := `
+		SELECT kid, algorithm, private_key, created_at
+		FROM oidc_signing_keys
+		ORDER BY created_at DESC;
+	`
+
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var keys []models.SigningKey
+	for rows.Next() {
+		var key models.SigningKey
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.PrivateKey, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		keys = append(keys, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (s *Storage) DeleteSigningKey(ctx context.Context, keyID string) error {
+	const op = "postgres.DeleteSigningKey"
+
+	if _, err := s.db.Exec(ctx, `DELETE FROM oidc_signing_keys WHERE kid = $1;`, keyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
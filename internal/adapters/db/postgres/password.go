@@ -0,0 +1,93 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) SavePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error {
+	const op = "postgres.SavePasswordResetToken"
+
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3);
+	`
+
+	if _, err := s.db.Exec(ctx, query, userID, tokenHash, expiresAt); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// PasswordResetUser returns the owner of an unused, unexpired reset token or
+// auth.ErrInvalidToken.
+func (s *Storage) PasswordResetUser(ctx context.Context, tokenHash string) (int64, error) {
+	const op = "postgres.PasswordResetUser"
+
+	query := `
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP;
+	`
+
+	var userID int64
+	err := s.db.QueryRow(ctx, query, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, auth.ErrInvalidToken
+	} else if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
+
+// ResetPassword burns the reset token, invalidates the user's other pending
+// reset tokens and stores the new password hash in one transaction. It
+// returns auth.ErrInvalidToken if the token is unknown, used or expired.
+func (s *Storage) ResetPassword(ctx context.Context, tokenHash string, passHash []byte) (int64, error) {
+	const op = "postgres.ResetPassword"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int64
+	err = tx.QueryRow(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id;
+	`, tokenHash).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, auth.ErrInvalidToken
+	} else if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND used_at IS NULL;
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1;`, userID, passHash); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return userID, nil
+}
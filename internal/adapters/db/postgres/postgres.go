@@ -12,14 +12,17 @@ import (
 	"web_auth/internal/config"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/pressly/goose"
 )
 
 const migrationDir = "db/migrations/postgres"
 
+// Storage runs its queries on a connection pool, a single connection can't
+// serve concurrent requests.
 type Storage struct {
-	db  *pgx.Conn
+	db  *pgxpool.Pool
 	log *slog.Logger
 }
 
@@ -30,34 +33,36 @@ func New(ctx context.Context, cfg *config.Config, log *slog.Logger) (*Storage, e
 
 	url := dbStringConverter(cfg)
 
-	conn, err := pgx.Connect(ctx, url)
+	pool, err := pgxpool.New(ctx, url)
 	if err != nil {
 		log.Error("can`t connect to db: ", "err", err)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := conn.Ping(ctx); err != nil {
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		log.Error("failed ping db: ", "err", err)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := applyMigrations(ctx, conn, migrationDir); err != nil {
+	if err := applyMigrations(pool, migrationDir); err != nil {
+		pool.Close()
 		log.Error("can't migrate up: ", "err", err)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	return &Storage{
-		db:  conn,
+		db:  pool,
 		log: log,
 	}, nil
 }
 
-func (s *Storage) Close(ctx context.Context) error {
-	return s.db.Close(ctx)
+func (s *Storage) Close() {
+	s.db.Close()
 }
 
-func applyMigrations(ctx context.Context, conn *pgx.Conn, migrationsDir string) error {
-	db := stdlib.OpenDB(*conn.Config())
+func applyMigrations(pool *pgxpool.Pool, migrationsDir string) error {
+	db := stdlib.OpenDB(*pool.Config().ConnConfig)
 	defer db.Close()
 
 	return goose.Up(db, migrationsDir)
@@ -76,16 +81,23 @@ func dbStringConverter(cfg *config.Config) string {
 	return urlConn
 }
 
+// SaveUser creates a user with the default role.
 func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error) {
 	const op = "postgres.SaveUser"
 
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
 	query := `
 		INSERT INTO users (email, password) 
 		VALUES ($1, $2) 
 		RETURNING id;
 		`
 
-	err = s.db.QueryRow(ctx, query, email, passHash).Scan(&uid)
+	err = tx.QueryRow(ctx, query, email, passHash).Scan(&uid)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
@@ -94,6 +106,14 @@ func (s *Storage) SaveUser(ctx context.Context, email string, passHash []byte) (
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	if err := assignRole(ctx, tx, uid, models.RoleUser); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
 	return uid, nil
 }
 
@@ -102,14 +122,21 @@ func (s *Storage) ProvideUser(ctx context.Context, email string) (*models.User,
 
 	query := `
 		SELECT users.id,
-		users.password
+		users.email,
+		users.password,
+		users.created_at,
+		users.is_active,
+		users.blocked_at,
+		users.block_reason,
+		users.email_verified_at
 		FROM users
 		WHERE email = $1
 		LIMIT 1;
 		`
 	var user models.User
 
-	err := s.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.PasswordHashed)
+	err := s.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Email, &user.PasswordHashed, &user.CreatedAt, &user.IsActive,
+		&user.BlockedAt, &user.BlockReason, &user.EmailVerifiedAt)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return &user, auth.ErrUserNotFound
 	} else if err != nil {
@@ -123,7 +150,7 @@ func (s *Storage) ListUsers(ctx context.Context, limit, offset int) ([]models.Us
 	const op = "postgres.ListUsers"
 
 	query := `
-		SELECT id, email, created_at, is_active
+		SELECT id, email, created_at, is_active, blocked_at, block_reason, email_verified_at
 		FROM users
 		ORDER BY created_at DESC
 		LIMIT $1 OFFSET $2;
@@ -138,7 +165,8 @@ func (s *Storage) ListUsers(ctx context.Context, limit, offset int) ([]models.Us
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Email, &user.CreatedAt, &user.IsActive); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.CreatedAt, &user.IsActive,
+			&user.BlockedAt, &user.BlockReason, &user.EmailVerifiedAt); err != nil {
 			return nil, fmt.Errorf("%s: %w", op, err)
 		}
 		users = append(users, user)
@@ -155,14 +183,15 @@ func (s *Storage) GetUserByID(ctx context.Context, userID int64) (*models.User,
 	const op = "postgres.GetUserByID"
 
 	query := `
-		SELECT id, email, password, created_at, is_active
+		SELECT id, email, password, created_at, is_active, blocked_at, block_reason, email_verified_at
 		FROM users
 		WHERE id = $1
 		LIMIT 1;
 	`
 
 	var user models.User
-	err := s.db.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Email, &user.PasswordHashed, &user.CreatedAt, &user.IsActive)
+	err := s.db.QueryRow(ctx, query, userID).Scan(&user.ID, &user.Email, &user.PasswordHashed, &user.CreatedAt, &user.IsActive,
+		&user.BlockedAt, &user.BlockReason, &user.EmailVerifiedAt)
 	if errors.Is(err, pgx.ErrNoRows) {
 		return nil, auth.ErrUserNotFound
 	} else if err != nil {
@@ -172,12 +201,37 @@ func (s *Storage) GetUserByID(ctx context.Context, userID int64) (*models.User,
 	return &user, nil
 }
 
-func (s *Storage) BlockUserByID(ctx context.Context, userID int64) error {
+func (s *Storage) BlockUserByID(ctx context.Context, userID int64, reason string) error {
 	const op = "postgres.BlockUserByID"
 
 	query := `
 		UPDATE users
-		SET is_active = false
+		SET is_active = false,
+		    blocked_at = CURRENT_TIMESTAMP,
+		    block_reason = NULLIF($2, '')
+		WHERE id = $1;
+	`
+
+	cmdTag, err := s.db.Exec(ctx, query, userID, reason)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrUserNotFound
+	}
+
+	return nil
+}
+
+func (s *Storage) UnblockUserByID(ctx context.Context, userID int64) error {
+	const op = "postgres.UnblockUserByID"
+
+	query := `
+		UPDATE users
+		SET is_active = true,
+		    blocked_at = NULL,
+		    block_reason = NULL
 		WHERE id = $1;
 	`
 
@@ -193,6 +247,21 @@ func (s *Storage) BlockUserByID(ctx context.Context, userID int64) error {
 	return nil
 }
 
+func (s *Storage) UpdatePasswordHash(ctx context.Context, userID int64, passHash []byte) error {
+	const op = "postgres.UpdatePasswordHash"
+
+	cmdTag, err := s.db.Exec(ctx, `UPDATE users SET password = $2 WHERE id = $1;`, userID, passHash)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrUserNotFound
+	}
+
+	return nil
+}
+
 func (s *Storage) GetUserMessages(ctx context.Context, userID int64, limit, offset int) ([]models.Message, error) {
 	const op = "postgres.GetUserMessages"
 
@@ -226,11 +295,54 @@ func (s *Storage) GetUserMessages(ctx context.Context, userID int64, limit, offs
 	return messages, nil
 }
 
-func (s *Storage) SaveMessage(ctx context.Context, message models.Message) error {
+func (s *Storage) GetGuestMessages(ctx context.Context, guestID int64, limit, offset int) ([]models.Message, error) {
+	const op = "postgres.GetGuestMessages"
+
+	query := `
+		SELECT id, anonymous_user_id, message_text, sender_type, created_at
+		FROM user_messages
+		WHERE anonymous_user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3;
+	`
+
+	rows, err := s.db.Query(ctx, query, guestID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var messages []models.Message
+	for rows.Next() {
+		var message models.Message
+		if err := rows.Scan(&message.ID, &message.AnonymousUserID, &message.MessageText, &message.SenderType, &message.CreatedAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return messages, nil
+}
+
+// SaveMessage stores a message of a user or, if AnonymousUserID is set, of a
+// guest, and sets its ID.
+func (s *Storage) SaveMessage(ctx context.Context, message *models.Message) error {
+	const op = "postgres.SaveMessage"
+
 	query := `
-		INSERT INTO user_messages (user_id, message_text, sender_type, created_at)
-		VALUES ($1, $2, $3, $4);
+		INSERT INTO user_messages (user_id, anonymous_user_id, message_text, sender_type, created_at)
+		VALUES (NULLIF($1, 0), $2, $3, $4, $5)
+		RETURNING id;
 	`
-	_, err := s.db.Exec(ctx, query, message.UserID, message.MessageText, message.SenderType, message.CreatedAt)
-	return err
+	err := s.db.QueryRow(ctx, query, message.UserID, message.AnonymousUserID, message.MessageText,
+		message.SenderType, message.CreatedAt).Scan(&message.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
 }
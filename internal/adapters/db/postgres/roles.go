@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func (s *Storage) AssignRole(ctx context.Context, userID int64, role string) error {
+	const op = "postgres.AssignRole"
+
+	if err := assignRole(ctx, s.db, userID, role); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// assignRole grants the role through q, so that users get their role in the
+// transaction creating them.
+func assignRole(ctx context.Context, q execer, userID int64, role string) error {
+	_, err := q.Exec(ctx, `
+		INSERT INTO user_roles (user_id, role_id)
+		SELECT $1, id FROM roles WHERE name = $2
+		ON CONFLICT DO NOTHING;
+	`, userID, role)
+	return err
+}
+
+func (s *Storage) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	const op = "postgres.UserRoles"
+
+	query := `
+		SELECT roles.name
+		FROM user_roles
+		JOIN roles ON roles.id = user_roles.role_id
+		WHERE user_roles.user_id = $1
+		ORDER BY roles.name;
+	`
+
+	roles, err := s.queryStrings(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return roles, nil
+}
+
+func (s *Storage) UserPermissions(ctx context.Context, userID int64) ([]string, error) {
+	const op = "postgres.UserPermissions"
+
+	query := `
+		SELECT DISTINCT permissions.name
+		FROM user_roles
+		JOIN role_permissions ON role_permissions.role_id = user_roles.role_id
+		JOIN permissions ON permissions.id = role_permissions.permission_id
+		WHERE user_roles.user_id = $1;
+	`
+
+	permissions, err := s.queryStrings(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return permissions, nil
+}
+
+func (s *Storage) queryStrings(ctx context.Context, query string, args ...any) ([]string, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+
+	return values, rows.Err()
+}
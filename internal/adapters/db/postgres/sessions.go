@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgInvalidTextRepresentation is raised when a malformed UUID is compared
+// against a uuid column.
+const pgInvalidTextRepresentation = "22P02"
+
+// CreateSession stores a new session and the first refresh token of its
+// family. The generated session id is written back to both.
+func (s *Storage) CreateSession(ctx context.Context, session *models.Session, refresh *models.RefreshToken) error {
+	const op = "postgres.CreateSession"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, user_agent, ip, expires_at, impersonator_id)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id::text, created_at, last_seen_at;
+	`, session.UserID, session.UserAgent, session.IP, session.ExpiresAt, session.ImpersonatorID).
+		Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	refresh.FamilyID = session.ID
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2::uuid, $3, $4)
+		RETURNING id, created_at;
+	`, refresh.UserID, refresh.FamilyID, refresh.TokenHash, refresh.ExpiresAt).
+		Scan(&refresh.ID, &refresh.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) SessionByID(ctx context.Context, sessionID string) (*models.Session, error) {
+	const op = "postgres.SessionByID"
+
+	query := `
+		SELECT id::text, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, impersonator_id
+		FROM sessions
+		WHERE id = $1::uuid
+		LIMIT 1;
+	`
+
+	var session models.Session
+	err := s.db.QueryRow(ctx, query, sessionID).Scan(
+		&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt, &session.ImpersonatorID,
+	)
+	if errors.Is(err, pgx.ErrNoRows) || isInvalidUUID(err) {
+		return nil, auth.ErrSessionNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &session, nil
+}
+
+// TouchSession bumps last_seen_at, at most once a minute to keep writes cheap.
+func (s *Storage) TouchSession(ctx context.Context, sessionID string) error {
+	const op = "postgres.TouchSession"
+
+	query := `
+		UPDATE sessions
+		SET last_seen_at = CURRENT_TIMESTAMP
+		WHERE id = $1::uuid AND last_seen_at < CURRENT_TIMESTAMP - INTERVAL '1 minute';
+	`
+
+	if _, err := s.db.Exec(ctx, query, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListUserSessions(ctx context.Context, userID int64) ([]models.Session, error) {
+	const op = "postgres.ListUserSessions"
+
+	query := `
+		SELECT id::text, user_id, user_agent, ip, created_at, last_seen_at, expires_at, revoked_at, impersonator_id
+		FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC;
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+			&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt,
+			&session.ImpersonatorID); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession revokes one live session of the user. It returns
+// auth.ErrSessionNotFound if there is no such session.
+func (s *Storage) RevokeSession(ctx context.Context, userID int64, sessionID string) error {
+	const op = "postgres.RevokeSession"
+
+	var exists bool
+	err := s.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM sessions
+			WHERE id = $1::uuid AND user_id = $2 AND revoked_at IS NULL
+		);
+	`, sessionID, userID).Scan(&exists)
+	if isInvalidUUID(err) {
+		return auth.ErrSessionNotFound
+	} else if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !exists {
+		return auth.ErrSessionNotFound
+	}
+
+	if err := s.revokeSessions(ctx, `id = $1::uuid`, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RevokeUserSessions(ctx context.Context, userID int64) error {
+	const op = "postgres.RevokeUserSessions"
+
+	if err := s.revokeSessions(ctx, `user_id = $1`, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeOtherSessions revokes every session of the user except keepID.
+func (s *Storage) RevokeOtherSessions(ctx context.Context, userID int64, keepID string) error {
+	const op = "postgres.RevokeOtherSessions"
+
+	if err := s.revokeSessions(ctx, `user_id = $1 AND id <> $2::uuid`, userID, keepID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// revokeSessions revokes the sessions matching where together with all of
+// their refresh tokens.
+func (s *Storage) revokeSessions(ctx context.Context, where string, args ...any) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE `+where+` AND revoked_at IS NULL;
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE family_id IN (SELECT id FROM sessions WHERE `+where+`) AND revoked_at IS NULL;
+	`, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func isInvalidUUID(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgInvalidTextRepresentation
+}
@@ -0,0 +1,98 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) RefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	const op = "postgres.RefreshTokenByHash"
+
+	query := `
+		SELECT id, user_id, family_id::text, token_hash, created_at, expires_at, rotated_at, revoked_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		LIMIT 1;
+	`
+
+	var token models.RefreshToken
+	err := s.db.QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.CreatedAt, &token.ExpiresAt, &token.RotatedAt, &token.RevokedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, auth.ErrInvalidToken
+	} else if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken marks the old token as rotated, stores its successor and
+// extends the session in one transaction. It returns auth.ErrRefreshTokenReused
+// when the old token was already rotated or revoked in the meantime.
+func (s *Storage) RotateRefreshToken(ctx context.Context, oldID int64, next *models.RefreshToken) error {
+	const op = "postgres.RotateRefreshToken"
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	cmdTag, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET rotated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL;
+	`, oldID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if cmdTag.RowsAffected() == 0 {
+		return auth.ErrRefreshTokenReused
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, $2::uuid, $3, $4)
+		RETURNING id, created_at;
+	`, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt).Scan(&next.ID, &next.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions
+		SET expires_at = $2, last_seen_at = CURRENT_TIMESTAMP
+		WHERE id = $1::uuid;
+	`, next.FamilyID, next.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// RevokeTokenFamily revokes every refresh token of the family together with the
+// session it belongs to.
+func (s *Storage) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	const op = "postgres.RevokeTokenFamily"
+
+	if err := s.revokeSessions(ctx, `id = $1::uuid`, familyID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"web_auth/internal/modules/auth"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SaveWebAuthnCeremony stores the server side state of a registration or login
+// ceremony and returns its id.
+func (s *Storage) SaveWebAuthnCeremony(ctx context.Context, kind string, userID int64, sessionData []byte, expiresAt time.Time,
+) (string, error) {
+	const op = "postgres.SaveWebAuthnCeremony"
+
+	query := `
+		INSERT INTO webauthn_ceremonies (kind, user_id, session_data, expires_at)
+		VALUES ($1, NULLIF($2, 0), $3, $4)
+		RETURNING id::text;
+	`
+
+	var id string
+	if err := s.db.QueryRow(ctx, query, kind, userID, sessionData, expiresAt).Scan(&id); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+// TakeWebAuthnCeremony deletes and returns a pending ceremony, so every
+// challenge can be answered only once. It returns auth.ErrInvalidToken for
+// unknown or expired ceremonies.
+func (s *Storage) TakeWebAuthnCeremony(ctx context.Context, kind, ceremonyID string) (int64, []byte, error) {
+	const op = "postgres.TakeWebAuthnCeremony"
+
+	query := `
+		DELETE FROM webauthn_ceremonies
+		WHERE id = $1::uuid AND kind = $2
+		RETURNING COALESCE(user_id, 0), session_data, expires_at;
+	`
+
+	var (
+		userID      int64
+		sessionData []byte
+		expiresAt   time.Time
+	)
+
+	err := s.db.QueryRow(ctx, query, ceremonyID, kind).Scan(&userID, &sessionData, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) || isInvalidUUID(err) {
+		return 0, nil, auth.ErrInvalidToken
+	} else if err != nil {
+		return 0, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if time.Now().After(expiresAt) {
+		return 0, nil, auth.ErrInvalidToken
+	}
+
+	return userID, sessionData, nil
+}
+
+func (s *Storage) SaveWebAuthnCredential(ctx context.Context, userID int64, credential *webauthn.Credential) error {
+	const op = "postgres.SaveWebAuthnCredential"
+
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		INSERT INTO webauthn_credentials (user_id, credential_id, public_key, credential)
+		VALUES ($1, $2, $3, $4);
+	`
+
+	_, err = s.db.Exec(ctx, query, userID, credential.ID, credential.PublicKey, raw)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return auth.ErrCredentialExists
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) WebAuthnCredentials(ctx context.Context, userID int64) ([]webauthn.Credential, error) {
+	const op = "postgres.WebAuthnCredentials"
+
+	query := `
+		SELECT credential
+		FROM webauthn_credentials
+		WHERE user_id = $1
+		ORDER BY created_at;
+	`
+
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var credentials []webauthn.Credential
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		var credential webauthn.Credential
+		if err := json.Unmarshal(raw, &credential); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		credentials = append(credentials, credential)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return credentials, nil
+}
+
+// UpdateWebAuthnCredential stores the sign counter and flags reported by the
+// last successful assertion.
+func (s *Storage) UpdateWebAuthnCredential(ctx context.Context, credential *webauthn.Credential) error {
+	const op = "postgres.UpdateWebAuthnCredential"
+
+	raw, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	query := `
+		UPDATE webauthn_credentials
+		SET credential = $2, last_used_at = CURRENT_TIMESTAMP
+		WHERE credential_id = $1;
+	`
+
+	if _, err := s.db.Exec(ctx, query, credential.ID, raw); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package ldap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+const (
+	attrMemberOf = "memberOf"
+
+	// attrNone requests no attributes, only the DNs.
+	attrNone = "1.1"
+
+	// maxGroups caps the group search, users are rarely in more.
+	maxGroups = 1000
+)
+
+var ErrInvalidConfig = errors.New("invalid ldap directory config")
+
+// Directory authenticates users with a simple bind as the user. The bind DN
+// is built from a template or looked up with a service account first.
+type Directory struct {
+	name        string
+	url         string
+	serverName  string
+	startTLS    bool
+	timeout     time.Duration
+	userDN      string
+	bindDN      string
+	bindPass    string
+	baseDN      string
+	userFilter  string
+	groupBaseDN string
+	groupFilter string
+	// groupRoles is keyed by normalized group DN.
+	groupRoles map[string]string
+	managed    []string
+}
+
+func New(cfg config.LDAPDirectory) (*Directory, error) {
+	const op = "ldap.New"
+
+	if cfg.Name == "" || cfg.URL == "" || len(cfg.Domains) == 0 {
+		return nil, fmt.Errorf("%s: %w: name, url and domains are required", op, ErrInvalidConfig)
+	}
+	if cfg.UserDN == "" && (cfg.BaseDN == "" || cfg.UserFilter == "") {
+		return nil, fmt.Errorf("%s: %w: either user_dn or base_dn and user_filter are required", op, ErrInvalidConfig)
+	}
+	if (cfg.GroupBaseDN == "") != (cfg.GroupFilter == "") {
+		return nil, fmt.Errorf("%s: %w: group_base_dn and group_filter go together", op, ErrInvalidConfig)
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		return nil, fmt.Errorf("%s: %w: url must be ldap:// or ldaps://", op, ErrInvalidConfig)
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+
+	d := &Directory{
+		name:        cfg.Name,
+		url:         cfg.URL,
+		serverName:  u.Hostname(),
+		startTLS:    cfg.StartTLS,
+		timeout:     timeout,
+		userDN:      cfg.UserDN,
+		bindDN:      cfg.BindDN,
+		bindPass:    cfg.BindPassword,
+		baseDN:      cfg.BaseDN,
+		userFilter:  cfg.UserFilter,
+		groupBaseDN: cfg.GroupBaseDN,
+		groupFilter: cfg.GroupFilter,
+		groupRoles:  make(map[string]string, len(cfg.GroupRoles)),
+	}
+
+	for group, role := range cfg.GroupRoles {
+		d.groupRoles[normalizeDN(group)] = role
+		if !slices.Contains(d.managed, role) {
+			d.managed = append(d.managed, role)
+		}
+	}
+
+	return d, nil
+}
+
+func (d *Directory) ManagedRoles() []string {
+	return d.managed
+}
+
+// Authenticate binds as the user. Unknown users and wrong passwords are both
+// reported as auth.ErrInvalidCredentials.
+func (d *Directory) Authenticate(ctx context.Context, email, password string) (*models.DirectoryUser, error) {
+	const op = "ldap.Authenticate"
+
+	// an empty password would be an unauthenticated bind, which most servers
+	// accept for any DN
+	if password == "" {
+		return nil, auth.ErrInvalidCredentials
+	}
+
+	username, _, _ := strings.Cut(email, "@")
+
+	conn, err := d.dial()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+	// go-ldap has no context support, closing the connection aborts the
+	// pending operation
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var dn string
+	var memberOf []string
+	if d.userDN != "" {
+		dn = expand(d.userDN, goldap.EscapeDN, username, email, "")
+	} else {
+		dn, memberOf, err = d.findUser(conn, username, email)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	if err := conn.Bind(dn, password); err != nil {
+		if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+			return nil, auth.ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%s: bind as user: %w", op, err)
+	}
+
+	groups, err := d.groups(conn, dn, username, email, memberOf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user := &models.DirectoryUser{DN: dn, Email: email, Groups: groups}
+	for _, group := range groups {
+		role, ok := d.groupRoles[normalizeDN(group)]
+		if ok && !slices.Contains(user.Roles, role) {
+			user.Roles = append(user.Roles, role)
+		}
+	}
+
+	return user, nil
+}
+
+// dial connects and, for ldap:// URLs, upgrades the connection if StartTLS
+// is set.
+func (d *Directory) dial() (*goldap.Conn, error) {
+	tlsConfig := &tls.Config{ServerName: d.serverName, MinVersion: tls.VersionTLS12}
+
+	conn, err := goldap.DialURL(d.url,
+		goldap.DialWithDialer(&net.Dialer{Timeout: d.timeout}),
+		goldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", d.name, err)
+	}
+	conn.SetTimeout(d.timeout)
+
+	if d.startTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls %s: %w", d.name, err)
+		}
+	}
+
+	return conn, nil
+}
+
+// findUser looks the user up with the service account and returns its DN and
+// memberOf values. Anything but exactly one match is an unknown user.
+func (d *Directory) findUser(conn *goldap.Conn, username, email string) (string, []string, error) {
+	if err := d.serviceBind(conn); err != nil {
+		return "", nil, err
+	}
+
+	filter := expand(d.userFilter, goldap.EscapeFilter, username, email, "")
+	req := goldap.NewSearchRequest(d.baseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		2, int(d.timeout.Seconds()), false, filter, []string{attrMemberOf}, nil)
+
+	res, err := conn.Search(req)
+	if goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return "", nil, auth.ErrInvalidCredentials
+	} else if err != nil {
+		return "", nil, fmt.Errorf("search user: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return "", nil, auth.ErrInvalidCredentials
+	}
+
+	entry := res.Entries[0]
+	return entry.DN, entry.GetAttributeValues(attrMemberOf), nil
+}
+
+// serviceBind binds as the service account, searches run anonymously
+// without one.
+func (d *Directory) serviceBind(conn *goldap.Conn) error {
+	if d.bindDN == "" {
+		return nil
+	}
+
+	if err := conn.Bind(d.bindDN, d.bindPass); err != nil {
+		return fmt.Errorf("bind as service account: %w", err)
+	}
+
+	return nil
+}
+
+// groups returns the DNs of the user's groups. It runs bound as the user, so
+// the user must be allowed to read them.
+func (d *Directory) groups(conn *goldap.Conn, dn, username, email string, memberOf []string) ([]string, error) {
+	if d.groupFilter == "" {
+		// already read by findUser
+		if d.userDN == "" {
+			return memberOf, nil
+		}
+
+		req := goldap.NewSearchRequest(dn, goldap.ScopeBaseObject, goldap.NeverDerefAliases,
+			1, int(d.timeout.Seconds()), false, "(objectClass=*)", []string{attrMemberOf}, nil)
+		res, err := conn.Search(req)
+		if err != nil {
+			return nil, fmt.Errorf("read memberOf: %w", err)
+		}
+		if len(res.Entries) == 0 {
+			return nil, nil
+		}
+		return res.Entries[0].GetAttributeValues(attrMemberOf), nil
+	}
+
+	filter := expand(d.groupFilter, goldap.EscapeFilter, username, email, dn)
+	req := goldap.NewSearchRequest(d.groupBaseDN, goldap.ScopeWholeSubtree, goldap.NeverDerefAliases,
+		maxGroups, int(d.timeout.Seconds()), false, filter, []string{attrNone}, nil)
+
+	res, err := conn.Search(req)
+	if err != nil {
+		return nil, fmt.Errorf("search groups: %w", err)
+	}
+
+	groups := make([]string, 0, len(res.Entries))
+	for _, entry := range res.Entries {
+		groups = append(groups, entry.DN)
+	}
+
+	return groups, nil
+}
+
+// expand fills in a template, escaping the values for where they end up.
+func expand(template string, escape func(string) string, username, email, dn string) string {
+	return strings.NewReplacer(
+		"{username}", escape(username),
+		"{email}", escape(email),
+		"{dn}", escape(dn),
+	).Replace(template)
+}
+
+// normalizeDN makes DNs comparable regardless of case and spacing.
+func normalizeDN(dn string) string {
+	parsed, err := goldap.ParseDN(dn)
+	if err != nil {
+		return strings.ToLower(dn)
+	}
+
+	return strings.ToLower(parsed.String())
+}
@@ -0,0 +1,466 @@
+package ldap
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"web_auth/internal/config"
+	"web_auth/internal/modules/auth"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// stubEntry is an entry of the stand-in directory. Entries with a password
+// can bind.
+type stubEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// stubServer is an in-process stand-in for an LDAP server. It speaks just
+// enough of the protocol for Directory: simple binds and searches with
+// and, or, not, equality and presence filters.
+type stubServer struct {
+	t        *testing.T
+	listener net.Listener
+	entries  []stubEntry
+
+	mu sync.Mutex
+	// binds are the DNs of all bind requests, successful or not.
+	binds []string
+}
+
+func newStubServer(t *testing.T, entries ...stubEntry) *stubServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	s := &stubServer{t: t, listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *stubServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *stubServer) bindDNs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.binds...)
+}
+
+func (s *stubServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		messageID, _ := packet.Children[0].Value.(int64)
+		request := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch request.Tag {
+		case goldap.ApplicationBindRequest:
+			responses = []*ber.Packet{s.bind(request)}
+		case goldap.ApplicationSearchRequest:
+			responses = s.search(request)
+		case goldap.ApplicationUnbindRequest:
+			return
+		default:
+			responses = []*ber.Packet{result(goldap.ApplicationExtendedResponse,
+				goldap.LDAPResultUnwillingToPerform, "not supported")}
+		}
+
+		for _, response := range responses {
+			envelope := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			envelope.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID,
+				"MessageID"))
+			envelope.AppendChild(response)
+			if _, err := conn.Write(envelope.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *stubServer) bind(request *ber.Packet) *ber.Packet {
+	dn := request.Children[1].Data.String()
+	password := request.Children[2].Data.String()
+
+	s.mu.Lock()
+	s.binds = append(s.binds, dn)
+	s.mu.Unlock()
+
+	// anonymous bind
+	if dn == "" && password == "" {
+		return result(goldap.ApplicationBindResponse, goldap.LDAPResultSuccess, "")
+	}
+
+	entry, ok := s.entry(dn)
+	if !ok || entry.password == "" || entry.password != password {
+		return result(goldap.ApplicationBindResponse, goldap.LDAPResultInvalidCredentials, "")
+	}
+	return result(goldap.ApplicationBindResponse, goldap.LDAPResultSuccess, "")
+}
+
+func (s *stubServer) search(request *ber.Packet) []*ber.Packet {
+	baseDN := normalizeDN(request.Children[0].Data.String())
+	scope, _ := request.Children[1].Value.(int64)
+	sizeLimit, _ := request.Children[3].Value.(int64)
+	filter := request.Children[6]
+
+	var attributes []string
+	for _, attr := range request.Children[7].Children {
+		attributes = append(attributes, attr.Data.String())
+	}
+
+	var responses []*ber.Packet
+	for _, entry := range s.entries {
+		dn := normalizeDN(entry.dn)
+		inScope := dn == baseDN
+		if scope == goldap.ScopeWholeSubtree {
+			inScope = inScope || strings.HasSuffix(dn, ","+baseDN)
+		}
+		if !inScope || !matches(entry, filter) {
+			continue
+		}
+
+		if sizeLimit > 0 && int64(len(responses)) == sizeLimit {
+			return append(responses, result(goldap.ApplicationSearchResultDone,
+				goldap.LDAPResultSizeLimitExceeded, ""))
+		}
+		responses = append(responses, searchEntry(entry, attributes))
+	}
+
+	return append(responses, result(goldap.ApplicationSearchResultDone, goldap.LDAPResultSuccess, ""))
+}
+
+func (s *stubServer) entry(dn string) (stubEntry, bool) {
+	for _, entry := range s.entries {
+		if normalizeDN(entry.dn) == normalizeDN(dn) {
+			return entry, true
+		}
+	}
+	return stubEntry{}, false
+}
+
+func matches(entry stubEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case goldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matches(entry, child) {
+				return false
+			}
+		}
+		return true
+	case goldap.FilterOr:
+		for _, child := range filter.Children {
+			if matches(entry, child) {
+				return true
+			}
+		}
+		return false
+	case goldap.FilterNot:
+		return !matches(entry, filter.Children[0])
+	case goldap.FilterEqualityMatch:
+		values := entry.values(filter.Children[0].Data.String())
+		want := filter.Children[1].Data.String()
+		return slices.ContainsFunc(values, func(v string) bool {
+			return strings.EqualFold(v, want) || normalizeDN(v) == normalizeDN(want)
+		})
+	case goldap.FilterPresent:
+		attr := filter.Data.String()
+		return strings.EqualFold(attr, "objectClass") || len(entry.values(attr)) > 0
+	default:
+		return false
+	}
+}
+
+func (e stubEntry) values(attr string) []string {
+	for name, values := range e.attrs {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+	return nil
+}
+
+func searchEntry(entry stubEntry, attributes []string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationSearchResultEntry, nil,
+		"Search Result Entry")
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "DN"))
+
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, name := range attributes {
+		values := entry.values(name)
+		if len(values) == 0 {
+			continue
+		}
+
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	packet.AppendChild(list)
+
+	return packet
+}
+
+func result(tag ber.Tag, code uint16, message string) *ber.Packet {
+	packet := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code),
+		"Result Code"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	packet.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, message,
+		"Diagnostic Message"))
+	return packet
+}
+
+const (
+	aliceDN    = "uid=alice,ou=people,dc=corp,dc=example"
+	bobDN      = "uid=bob,ou=people,dc=corp,dc=example"
+	serviceDN  = "cn=web_auth,ou=services,dc=corp,dc=example"
+	adminsDN   = "cn=admins,ou=groups,dc=corp,dc=example"
+	staffDN    = "cn=staff,ou=groups,dc=corp,dc=example"
+	servicePwd = "service-secret"
+)
+
+// corpDirectory has alice in admins and staff and bob in staff only.
+func corpDirectory(t *testing.T) *stubServer {
+	t.Helper()
+
+	return newStubServer(t,
+		stubEntry{dn: serviceDN, password: servicePwd},
+		stubEntry{dn: aliceDN, password: "alice-secret", attrs: map[string][]string{
+			"uid":      {"alice"},
+			"mail":     {"alice@corp.example"},
+			"memberOf": {adminsDN, staffDN},
+		}},
+		stubEntry{dn: bobDN, password: "bob-secret", attrs: map[string][]string{
+			"uid":      {"bob"},
+			"mail":     {"bob@corp.example"},
+			"memberOf": {staffDN},
+		}},
+		stubEntry{dn: adminsDN, attrs: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {aliceDN},
+		}},
+		stubEntry{dn: staffDN, attrs: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {aliceDN, bobDN},
+		}},
+	)
+}
+
+func newTestDirectory(t *testing.T, cfg config.LDAPDirectory) *Directory {
+	t.Helper()
+
+	cfg.Name = "corp"
+	cfg.Domains = []string{"corp.example"}
+	if cfg.GroupRoles == nil {
+		// the group DN is spelled differently on purpose
+		cfg.GroupRoles = map[string]string{"CN=Admins, OU=Groups, DC=corp, DC=example": "admin"}
+	}
+
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return d
+}
+
+func TestAuthenticate(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  config.LDAPDirectory
+		// wantBinds are the bind DNs of alice's login.
+		wantBinds []string
+	}{
+		{
+			name:      "user dn template",
+			cfg:       config.LDAPDirectory{UserDN: "uid={username},ou=people,dc=corp,dc=example"},
+			wantBinds: []string{aliceDN},
+		},
+		{
+			name: "search then bind",
+			cfg: config.LDAPDirectory{
+				BindDN:       serviceDN,
+				BindPassword: servicePwd,
+				BaseDN:       "dc=corp,dc=example",
+				UserFilter:   "(&(uid=*)(mail={email}))",
+			},
+			wantBinds: []string{serviceDN, aliceDN},
+		},
+		{
+			name: "group search",
+			cfg: config.LDAPDirectory{
+				UserDN:      "uid={username},ou=people,dc=corp,dc=example",
+				GroupBaseDN: "ou=groups,dc=corp,dc=example",
+				GroupFilter: "(&(objectClass=groupOfNames)(member={dn}))",
+			},
+			wantBinds: []string{aliceDN},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := corpDirectory(t)
+			tc.cfg.URL = server.url()
+			d := newTestDirectory(t, tc.cfg)
+
+			user, err := d.Authenticate(context.Background(), "alice@corp.example", "alice-secret")
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+
+			if user.DN != aliceDN {
+				t.Errorf("DN = %q, want %q", user.DN, aliceDN)
+			}
+			slices.Sort(user.Groups)
+			if want := []string{adminsDN, staffDN}; !slices.Equal(user.Groups, want) {
+				t.Errorf("groups = %v, want %v", user.Groups, want)
+			}
+			if want := []string{"admin"}; !slices.Equal(user.Roles, want) {
+				t.Errorf("roles = %v, want %v", user.Roles, want)
+			}
+			if binds := server.bindDNs(); !slices.Equal(binds, tc.wantBinds) {
+				t.Errorf("binds = %v, want %v", binds, tc.wantBinds)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUnmappedGroups(t *testing.T) {
+	server := corpDirectory(t)
+	d := newTestDirectory(t, config.LDAPDirectory{
+		URL:    server.url(),
+		UserDN: "uid={username},ou=people,dc=corp,dc=example",
+	})
+
+	user, err := d.Authenticate(context.Background(), "bob@corp.example", "bob-secret")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	if len(user.Roles) != 0 {
+		t.Errorf("roles = %v, want none", user.Roles)
+	}
+	if want := []string{"admin"}; !slices.Equal(d.ManagedRoles(), want) {
+		t.Errorf("managed roles = %v, want %v", d.ManagedRoles(), want)
+	}
+}
+
+func TestAuthenticateRejects(t *testing.T) {
+	templateCfg := config.LDAPDirectory{UserDN: "uid={username},ou=people,dc=corp,dc=example"}
+	searchCfg := config.LDAPDirectory{
+		BindDN:       serviceDN,
+		BindPassword: servicePwd,
+		BaseDN:       "dc=corp,dc=example",
+		UserFilter:   "(mail={email})",
+	}
+
+	for _, tc := range []struct {
+		name     string
+		cfg      config.LDAPDirectory
+		email    string
+		password string
+	}{
+		{name: "wrong password", cfg: templateCfg, email: "alice@corp.example", password: "bob-secret"},
+		{name: "unknown user", cfg: templateCfg, email: "carol@corp.example", password: "secret"},
+		{name: "unknown user by search", cfg: searchCfg, email: "carol@corp.example", password: "secret"},
+		{name: "wrong password by search", cfg: searchCfg, email: "bob@corp.example", password: "alice-secret"},
+		{
+			// the search has to match exactly one entry
+			name: "ambiguous search",
+			cfg: config.LDAPDirectory{
+				BindDN:       serviceDN,
+				BindPassword: servicePwd,
+				BaseDN:       "ou=people,dc=corp,dc=example",
+				UserFilter:   "(|(mail={email})(uid=*))",
+			},
+			email:    "alice@corp.example",
+			password: "alice-secret",
+		},
+		{
+			// the filter value is escaped, so this doesn't match everyone
+			name:     "filter injection",
+			cfg:      searchCfg,
+			email:    "*)(uid=*@corp.example",
+			password: "alice-secret",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := corpDirectory(t)
+			tc.cfg.URL = server.url()
+			d := newTestDirectory(t, tc.cfg)
+
+			_, err := d.Authenticate(context.Background(), tc.email, tc.password)
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Fatalf("Authenticate error = %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateEmptyPassword(t *testing.T) {
+	// many servers treat a bind with a DN and no password as an anonymous
+	// bind and report success
+	server := corpDirectory(t)
+	d := newTestDirectory(t, config.LDAPDirectory{
+		URL:    server.url(),
+		UserDN: "uid={username},ou=people,dc=corp,dc=example",
+	})
+
+	_, err := d.Authenticate(context.Background(), "alice@corp.example", "")
+	if !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want ErrInvalidCredentials", err)
+	}
+	if binds := server.bindDNs(); len(binds) != 0 {
+		t.Errorf("binds = %v, want none", binds)
+	}
+}
+
+func TestAuthenticateServiceAccountFailure(t *testing.T) {
+	server := corpDirectory(t)
+	d := newTestDirectory(t, config.LDAPDirectory{
+		URL:          server.url(),
+		BindDN:       serviceDN,
+		BindPassword: "rotated",
+		BaseDN:       "dc=corp,dc=example",
+		UserFilter:   "(mail={email})",
+	})
+
+	// a broken service account is an outage, not a wrong password
+	_, err := d.Authenticate(context.Background(), "alice@corp.example", "alice-secret")
+	if err == nil || errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want a non credentials error", err)
+	}
+}
@@ -0,0 +1,100 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps failed login counters in process memory. Counters are lost
+// on restart and aren't shared between instances, so it only suits single
+// instance deployments and local runs.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+type entry struct {
+	failures      int
+	lastFailureAt time.Time
+	lockedUntil   time.Time
+}
+
+// quietSince reports when the key stopped failing and being locked.
+func (e *entry) quietSince() time.Time {
+	if e.lockedUntil.After(e.lastFailureAt) {
+		return e.lockedUntil
+	}
+	return e.lastFailureAt
+}
+
+func NewMemory() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]*entry)}
+}
+
+func (m *MemoryStore) AttemptLockout(_ context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return 0, nil
+	}
+
+	return max(time.Until(e.lockedUntil), 0), nil
+}
+
+func (m *MemoryStore) RecordFailedAttempt(_ context.Context, key string, window time.Duration) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.sweep(now, window)
+
+	e, ok := m.entries[key]
+	if !ok || now.Sub(e.quietSince()) > window {
+		e = &entry{}
+		m.entries[key] = e
+	}
+
+	e.failures++
+	e.lastFailureAt = now
+
+	return e.failures, nil
+}
+
+func (m *MemoryStore) LockAttempts(_ context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if e, ok := m.entries[key]; ok {
+		e.lockedUntil = time.Now().Add(d)
+	}
+
+	return nil
+}
+
+func (m *MemoryStore) ResetAttempts(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+
+	return nil
+}
+
+// sweep drops keys that have been quiet for window, at most once per window,
+// so that guesses against random emails don't grow the map forever.
+func (m *MemoryStore) sweep(now time.Time, window time.Duration) {
+	if now.Sub(m.lastSweep) < window {
+		return
+	}
+	m.lastSweep = now
+
+	for key, e := range m.entries {
+		if now.Sub(e.quietSince()) > window {
+			delete(m.entries, key)
+		}
+	}
+}
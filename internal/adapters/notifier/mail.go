@@ -0,0 +1,47 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+)
+
+// Mail sends new login alerts by email.
+type Mail struct {
+	mailer auth.Mailer
+}
+
+func NewMail(mailer auth.Mailer) *Mail {
+	return &Mail{mailer: mailer}
+}
+
+func (m *Mail) NotifyNewLogin(ctx context.Context, user *models.User, login *models.LoginAttempt,
+	origin *models.LoginOrigin,
+) error {
+	const op = "notifier.Mail.NotifyNewLogin"
+
+	var what string
+	switch {
+	case !origin.KnownDevice && !origin.KnownIPRange:
+		what = "a new device and network"
+	case !origin.KnownDevice:
+		what = "a new device"
+	default:
+		what = "a new network"
+	}
+
+	body := fmt.Sprintf("Your account was signed in to from %s.\n\n"+
+		"Time: %s\nIP address: %s\nDevice: %s\n\n"+
+		"If this was you, there is nothing to do. Otherwise change your password right away "+
+		"and end the sessions you don't recognize.",
+		what, login.CreatedAt.UTC().Format(time.RFC1123), login.IP, login.UserAgent)
+
+	if err := m.mailer.Send(ctx, user.Email, "New sign in to your account", body); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
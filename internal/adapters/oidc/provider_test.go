@@ -0,0 +1,340 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"web_auth/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "web_auth"
+	testClientSecret = "secret"
+	testRedirectURL  = "https://app.example.test/oidc/callback"
+	testCode         = "auth-code"
+	testVerifier     = "code-verifier"
+	testNonce        = "nonce"
+	testKeyID        = "key-1"
+)
+
+// stubIdP is an OpenID Connect provider good enough for the code flow. Tests
+// shape the ID token it issues with claims and signingKey.
+type stubIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// issuer is what discovery advertises, the server URL by default.
+	issuer string
+	// claims are merged into the ID token claims, nil values are removed.
+	claims jwt.MapClaims
+	// signingKey signs the ID token instead of key if set.
+	signingKey *rsa.PrivateKey
+	// userInfo is served at the userinfo endpoint if set.
+	userInfo map[string]any
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	idp := &stubIdP{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("/jwks", idp.jwks)
+	mux.HandleFunc("/token", idp.token)
+	mux.HandleFunc("/userinfo", idp.userinfo)
+
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (s *stubIdP) provider() *Provider {
+	s.t.Helper()
+
+	p, err := New(config.OIDCProvider{
+		Name:         "stub",
+		Issuer:       s.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+	}, testRedirectURL, s.server.Client())
+	if err != nil {
+		s.t.Fatalf("New: %v", err)
+	}
+	return p
+}
+
+func (s *stubIdP) discovery(w http.ResponseWriter, _ *http.Request) {
+	meta := map[string]string{
+		"issuer":                 s.issuer,
+		"authorization_endpoint": s.server.URL + "/authorize",
+		"token_endpoint":         s.server.URL + "/token",
+		"jwks_uri":               s.server.URL + "/jwks",
+	}
+	if s.userInfo != nil {
+		meta["userinfo_endpoint"] = s.server.URL + "/userinfo"
+	}
+	_ = json.NewEncoder(w).Encode(meta)
+}
+
+func (s *stubIdP) jwks(w http.ResponseWriter, _ *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"kid": testKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *stubIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, _ := r.BasicAuth()
+	if clientID != testClientID || secret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != testCode ||
+		r.PostFormValue("code_verifier") != testVerifier || r.PostFormValue("redirect_uri") != testRedirectURL {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     s.idToken(),
+	})
+}
+
+func (s *stubIdP) userinfo(w http.ResponseWriter, r *http.Request) {
+	if s.userInfo == nil || r.Header.Get("Authorization") != "Bearer access-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(s.userInfo)
+}
+
+func (s *stubIdP) idToken() string {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            s.server.URL,
+		"aud":            testClientID,
+		"sub":            "external-42",
+		"email":          "alice@example.com",
+		"email_verified": true,
+		"nonce":          testNonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Minute).Unix(),
+	}
+	for name, value := range s.claims {
+		if value == nil {
+			delete(claims, name)
+			continue
+		}
+		claims[name] = value
+	}
+
+	key := s.key
+	if s.signingKey != nil {
+		key = s.signingKey
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(key)
+	if err != nil {
+		s.t.Fatalf("sign id token: %v", err)
+	}
+	return signed
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newStubIdP(t)
+
+	raw, err := idp.provider().AuthCodeURL(context.Background(), "state", testNonce, "challenge")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatalf("parse auth url: %v", err)
+	}
+	if got, want := u.Scheme+"://"+u.Host+u.Path, idp.server.URL+"/authorize"; got != want {
+		t.Errorf("endpoint = %q, want %q", got, want)
+	}
+
+	q := u.Query()
+	for param, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid email",
+		"state":                 "state",
+		"nonce":                 testNonce,
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+	} {
+		if got := q.Get(param); got != want {
+			t.Errorf("%s = %q, want %q", param, got, want)
+		}
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newStubIdP(t)
+	// a provider must not be able to speak for another issuer
+	idp.issuer = "https://evil.example.test"
+
+	_, err := idp.provider().AuthCodeURL(context.Background(), "state", testNonce, "challenge")
+	if !errors.Is(err, ErrDiscovery) {
+		t.Fatalf("AuthCodeURL error = %v, want ErrDiscovery", err)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	idp := newStubIdP(t)
+
+	identity, err := idp.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	if identity.Provider != "stub" || identity.Subject != "external-42" ||
+		identity.Email != "alice@example.com" || !identity.EmailVerified {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestExchangeEmailVerifiedAsString(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.claims = jwt.MapClaims{"email_verified": "false"}
+
+	identity, err := idp.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if identity.EmailVerified {
+		t.Error(`email_verified "false" taken as verified`)
+	}
+}
+
+func TestExchangeRejectsBadCode(t *testing.T) {
+	idp := newStubIdP(t)
+
+	_, err := idp.provider().Exchange(context.Background(), "other-code", testVerifier, testNonce)
+	if !errors.Is(err, ErrTokenExchange) {
+		t.Fatalf("Exchange error = %v, want ErrTokenExchange", err)
+	}
+}
+
+func TestExchangeRejectsInvalidIDToken(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name       string
+		claims     jwt.MapClaims
+		signingKey *rsa.PrivateKey
+	}{
+		{name: "foreign signature", signingKey: otherKey},
+		{name: "wrong issuer", claims: jwt.MapClaims{"iss": "https://evil.example.test"}},
+		{name: "wrong audience", claims: jwt.MapClaims{"aud": "other-client"}},
+		{name: "several audiences without azp", claims: jwt.MapClaims{"aud": []string{testClientID, "other-client"}}},
+		{
+			name:   "several audiences for another party",
+			claims: jwt.MapClaims{"aud": []string{testClientID, "other-client"}, "azp": "other-client"},
+		},
+		{name: "nonce mismatch", claims: jwt.MapClaims{"nonce": "replayed"}},
+		{name: "no nonce", claims: jwt.MapClaims{"nonce": nil}},
+		{name: "expired", claims: jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}},
+		{name: "no expiry", claims: jwt.MapClaims{"exp": nil}},
+		{name: "no subject", claims: jwt.MapClaims{"sub": nil}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			idp.claims = tc.claims
+			idp.signingKey = tc.signingKey
+
+			_, err := idp.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("Exchange error = %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+}
+
+func TestExchangeSeveralAudiencesForUs(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.claims = jwt.MapClaims{"aud": []string{testClientID, "other-client"}, "azp": testClientID}
+
+	if _, err := idp.provider().Exchange(context.Background(), testCode, testVerifier, testNonce); err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+}
+
+func TestExchangeUserInfoFallback(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		userInfo map[string]any
+		wantErr  error
+	}{
+		{
+			name:     "same subject",
+			userInfo: map[string]any{"sub": "external-42", "email": "alice@example.com", "email_verified": true},
+		},
+		{
+			name:     "other subject",
+			userInfo: map[string]any{"sub": "external-7", "email": "mallory@example.com", "email_verified": true},
+			wantErr:  ErrInvalidIDToken,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp := newStubIdP(t)
+			idp.claims = jwt.MapClaims{"email": nil, "email_verified": nil}
+			idp.userInfo = tc.userInfo
+
+			identity, err := idp.provider().Exchange(context.Background(), testCode, testVerifier, testNonce)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Exchange error = %v, want %v", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if identity.Email != "alice@example.com" || !identity.EmailVerified {
+				t.Errorf("identity = %+v", identity)
+			}
+		})
+	}
+}
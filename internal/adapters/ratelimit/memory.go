@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/modules/ratelimit"
+)
+
+// MemoryStore keeps token buckets in process memory, so limits apply per
+// instance.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	// full is when the bucket refills completely if left alone.
+	full      time.Time
+	updatedAt time.Time
+}
+
+func NewMemory() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *MemoryStore) Take(_ context.Context, key string, rule config.RateLimitRule) (ratelimit.Result, error) {
+	burst := rule.Burst
+	if burst <= 0 {
+		burst = rule.Requests
+	}
+	// time to refill one token, counted in durations rather than a per second
+	// rate so waiting exactly RetryAfter isn't lost to rounding
+	perToken := float64(rule.Period) / float64(rule.Requests)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updatedAt: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(burst), b.tokens+float64(now.Sub(b.updatedAt))/perToken)
+	b.updatedAt = now
+
+	res := ratelimit.Result{Limit: burst}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = ceilDuration((1 - b.tokens) * perToken)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = ceilDuration((float64(burst) - b.tokens) * perToken)
+	b.full = now.Add(res.Reset)
+
+	return res, nil
+}
+
+// sweep drops full buckets once a minute, they are equal to fresh ones.
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// ceilDuration rounds up, a client waiting the returned time must find the
+// token refilled.
+func ceilDuration(ns float64) time.Duration {
+	return time.Duration(math.Ceil(ns))
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"web_auth/internal/config"
+)
+
+// newTestStore returns a store whose clock only moves through advance.
+func newTestStore() (*MemoryStore, func(d time.Duration)) {
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	return m, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestTakeBurstAndRefill(t *testing.T) {
+	m, advance := newTestStore()
+	// one token every 6 seconds, up to 3 at once
+	rule := config.RateLimitRule{Requests: 10, Period: time.Minute, Burst: 3}
+
+	for i := range 3 {
+		res, _ := m.Take(context.Background(), "ip:1", rule)
+		if !res.Allowed || res.Limit != 3 || res.Remaining != 2-i {
+			t.Fatalf("request %d: %+v, want allowed with %d remaining", i+1, res, 2-i)
+		}
+	}
+
+	res, _ := m.Take(context.Background(), "ip:1", rule)
+	if res.Allowed {
+		t.Fatal("request over the burst allowed")
+	}
+	if res.RetryAfter != 6*time.Second || res.Reset != 18*time.Second {
+		t.Errorf("retry after %v, reset %v; want 6s and 18s", res.RetryAfter, res.Reset)
+	}
+
+	advance(5 * time.Second)
+	res, _ = m.Take(context.Background(), "ip:1", rule)
+	if res.Allowed {
+		t.Fatal("request allowed before a token was refilled")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("retry after %v, want 1s", res.RetryAfter)
+	}
+
+	advance(time.Second)
+	if res, _ = m.Take(context.Background(), "ip:1", rule); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("request after refill: %+v, want allowed", res)
+	}
+
+	// an idle bucket fills up to the burst, not beyond
+	advance(time.Hour)
+	for i := range 3 {
+		if res, _ = m.Take(context.Background(), "ip:1", rule); !res.Allowed {
+			t.Fatalf("request %d after idling denied", i+1)
+		}
+	}
+	if res, _ = m.Take(context.Background(), "ip:1", rule); res.Allowed {
+		t.Error("idle bucket refilled over the burst")
+	}
+}
+
+func TestTakeBurstDefaultsToRequests(t *testing.T) {
+	m, _ := newTestStore()
+	rule := config.RateLimitRule{Requests: 2, Period: time.Minute}
+
+	for range 2 {
+		if res, _ := m.Take(context.Background(), "ip:1", rule); !res.Allowed || res.Limit != 2 {
+			t.Fatalf("%+v, want allowed with limit 2", res)
+		}
+	}
+	if res, _ := m.Take(context.Background(), "ip:1", rule); res.Allowed {
+		t.Error("third request allowed")
+	}
+}
+
+func TestTakeSeparateKeys(t *testing.T) {
+	m, _ := newTestStore()
+	rule := config.RateLimitRule{Requests: 1, Period: time.Minute}
+
+	if res, _ := m.Take(context.Background(), "auth:ip:1", rule); !res.Allowed {
+		t.Fatal("first request denied")
+	}
+	if res, _ := m.Take(context.Background(), "auth:ip:1", rule); res.Allowed {
+		t.Fatal("second request of the same key allowed")
+	}
+
+	for _, key := range []string{"auth:ip:2", "api:ip:1"} {
+		if res, _ := m.Take(context.Background(), key, rule); !res.Allowed {
+			t.Errorf("%s shares a bucket with auth:ip:1", key)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"web_auth/internal/modules/auth"
+)
+
+func ChangePasswordHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		session, _ := SessionFromContext(r.Context())
+
+		var req struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		err := authService.ChangePassword(r.Context(), user, session.ID, req.CurrentPassword, req.NewPassword,
+			clientInfo(r))
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ChangeEmailHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		var req struct {
+			Email           string `json:"email"`
+			CurrentPassword string `json:"current_password"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if ok := isValidEmail(req.Email); !ok {
+			http.Error(w, "Invalid email format", http.StatusBadRequest)
+			return
+		}
+
+		err := authService.RequestEmailChange(r.Context(), user, req.Email, req.CurrentPassword, clientInfo(r))
+		if err != nil {
+			writeAccountError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+func ConfirmEmailChangeHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		changeToken := r.URL.Query().Get("token")
+		if changeToken == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := authService.ConfirmEmailChange(r.Context(), changeToken, clientInfo(r)); err != nil {
+			writeAccountError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"email_changed": true,
+		})
+	}
+}
+
+func writeAccountError(w http.ResponseWriter, err error) {
+	if writeTooManyAttempts(w, err) || writePasswordPolicyError(w, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		http.Error(w, "current password is invalid", http.StatusForbidden)
+	case errors.Is(err, auth.ErrInvalidToken):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, auth.ErrUserExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
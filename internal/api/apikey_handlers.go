@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"web_auth/internal/modules/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func CreateAPIKeyHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		var req struct {
+			Name      string     `json:"name"`
+			Scopes    []string   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		key, err := authService.CreateAPIKey(r.Context(), user.ID, req.Name, req.Scopes, req.ExpiresAt,
+			clientInfo(r))
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidAPIKey) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(key)
+	}
+}
+
+func ListAPIKeysHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		keys, err := authService.ListAPIKeys(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+func RevokeAPIKeyHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		err := authService.RevokeAPIKey(r.Context(), user.ID, chi.URLParam(r, "keyID"), clientInfo(r))
+		if err != nil {
+			if errors.Is(err, auth.ErrAPIKeyNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/audit"
+)
+
+// ListAuditEventsHandler returns audit events, newest first. user_id, type,
+// from and to (RFC 3339) narrow the result.
+func ListAuditEventsHandler(auditService *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		limit, err := strconv.Atoi(query.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 10 // Значение по умолчанию
+		}
+		offset, err := strconv.Atoi(query.Get("offset"))
+		if err != nil || offset < 0 {
+			offset = 0 // Значение по умолчанию
+		}
+
+		filter := models.AuditFilter{
+			Type:   query.Get("type"),
+			Limit:  limit,
+			Offset: offset,
+		}
+
+		if v := query.Get("user_id"); v != "" {
+			userID, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid user_id", http.StatusBadRequest)
+				return
+			}
+			filter.UserID = &userID
+		}
+
+		if filter.From, err = timeParam(r, "from"); err != nil {
+			http.Error(w, "Invalid from, expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+		if filter.To, err = timeParam(r, "to"); err != nil {
+			http.Error(w, "Invalid to, expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+
+		events, err := auditService.List(r.Context(), filter)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(events)
+	}
+}
+
+// VerifyAuditLogHandler checks the audit log hash chain.
+func VerifyAuditLogHandler(auditService *audit.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		result, err := auditService.Verify(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(result)
+	}
+}
+
+// timeParam parses an optional RFC 3339 query parameter.
+func timeParam(r *http.Request, name string) (*time.Time, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -2,8 +2,10 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"regexp"
+	"strconv"
 
 	"web_auth/internal/modules/auth"
 )
@@ -11,8 +13,9 @@ import (
 func RegisterHandler(authService *auth.Auth) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email      string `json:"email"`
+			Password   string `json:"password"`
+			GuestToken string `json:"guest_token"`
 		}
 
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -25,8 +28,16 @@ func RegisterHandler(authService *auth.Auth) http.HandlerFunc {
 			return
 		}
 
-		userID, err := authService.RegisterNewUser(r.Context(), req.Password, req.Email)
+		userID, err := authService.RegisterNewUser(r.Context(), req.Password, req.Email, req.GuestToken,
+			clientInfo(r))
 		if err != nil {
+			if writePasswordPolicyError(w, err) {
+				return
+			}
+			if errors.Is(err, auth.ErrInvalidToken) {
+				http.Error(w, "Invalid guest token", http.StatusBadRequest)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -49,16 +60,188 @@ func LoginHandler(authService *auth.Auth) http.HandlerFunc {
 			return
 		}
 
-		err := authService.Login(r.Context(), req.Email, req.Password)
+		token, challenge, err := authService.Login(r.Context(), req.Email, req.Password, clientInfo(r))
 		if err != nil {
+			if writeTooManyAttempts(w, err) {
+				return
+			}
+			if errors.Is(err, auth.ErrUserBlocked) {
+				http.Error(w, auth.ErrUserBlocked.Error(), http.StatusForbidden)
+				return
+			}
+			if errors.Is(err, auth.ErrEmailNotVerified) {
+				http.Error(w, auth.ErrEmailNotVerified.Error(), http.StatusForbidden)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		if challenge != nil {
+			json.NewEncoder(w).Encode(challenge)
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+func RefreshTokenHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		token, err := authService.RefreshTokens(r.Context(), req.RefreshToken)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if errors.Is(err, auth.ErrUserBlocked) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+func ForgotPasswordHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if ok := isValidEmail(req.Email); !ok {
+			http.Error(w, "Invalid email format", http.StatusBadRequest)
+			return
+		}
+
+		if err := authService.ForgotPassword(r.Context(), req.Email); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
 	}
 }
 
+func ResetPasswordHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := authService.ResetPassword(r.Context(), req.Token, req.Password, clientInfo(r)); err != nil {
+			if writePasswordPolicyError(w, err) {
+				return
+			}
+			if errors.Is(err, auth.ErrInvalidToken) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func VerifyEmailHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		verificationToken := r.URL.Query().Get("token")
+		if verificationToken == "" {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := authService.VerifyEmail(r.Context(), verificationToken); err != nil {
+			if errors.Is(err, auth.ErrInvalidToken) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"email_verified": true,
+		})
+	}
+}
+
+func ResendVerificationEmailHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := authService.ResendVerificationEmail(r.Context(), req.Email); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// writeTooManyAttempts answers 429 with Retry-After if err is a lockout.
+func writeTooManyAttempts(w http.ResponseWriter, err error) bool {
+	var lockErr *auth.TooManyAttemptsError
+	if !errors.As(err, &lockErr) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(lockErr.RetryAfter), 1)))
+	http.Error(w, lockErr.Error(), http.StatusTooManyRequests)
+
+	return true
+}
+
+// writePasswordPolicyError answers 400 with the broken rules if err is a
+// password policy rejection.
+func writePasswordPolicyError(w http.ResponseWriter, err error) bool {
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      policyErr.Error(),
+		"violations": policyErr.Violations,
+	})
+
+	return true
+}
+
 func isValidEmail(email string) bool {
 	// Простое регулярное выражение для проверки формата email
 	const emailRegex = `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
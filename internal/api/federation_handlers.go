@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"web_auth/internal/modules/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// federatedStateCookie binds a sign in at an identity provider to the browser
+// that started it.
+const federatedStateCookie = "oidc_state"
+
+// BeginFederatedLoginHandler redirects the browser to the identity provider.
+func BeginFederatedLoginHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := chi.URLParam(r, "provider")
+
+		authURL, state, err := authService.BeginFederatedLogin(r.Context(), provider)
+		if err != nil {
+			if errors.Is(err, auth.ErrProviderNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     federatedStateCookie,
+			Value:    state,
+			Path:     "/login/oidc/" + provider,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			// the provider redirects back with a top level GET, which Lax
+			// cookies survive
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// FederatedLoginCallbackHandler is where the identity provider sends the user
+// back to. It answers like LoginHandler.
+func FederatedLoginCallbackHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := chi.URLParam(r, "provider")
+
+		var boundState string
+		if cookie, err := r.Cookie(federatedStateCookie); err == nil {
+			boundState = cookie.Value
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     federatedStateCookie,
+			Path:     "/login/oidc/" + provider,
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		query := r.URL.Query()
+		if providerErr := query.Get("error"); providerErr != "" {
+			http.Error(w, "Sign in failed: "+providerErr, http.StatusUnauthorized)
+			return
+		}
+
+		token, challenge, err := authService.CompleteFederatedLogin(r.Context(), provider,
+			query.Get("state"), boundState, query.Get("code"), clientInfo(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrProviderNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrFederationFailed):
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrUserBlocked), errors.Is(err, auth.ErrEmailNotVerified):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, auth.ErrIdentityLinkRefused):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if challenge != nil {
+			json.NewEncoder(w).Encode(challenge)
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+func ListFederatedIdentitiesHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		identities, err := authService.ListFederatedIdentities(r.Context(), user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(identities)
+	}
+}
+
+func UnlinkFederatedIdentityHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		err := authService.UnlinkFederatedIdentity(r.Context(), user, chi.URLParam(r, "provider"))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrIdentityNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, auth.ErrLastSignInMethod):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"web_auth/internal/modules/auth"
+	"web_auth/internal/modules/messages"
+)
+
+func CreateGuestHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guestToken, err := authService.CreateGuest(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(guestToken)
+	}
+}
+
+func GetGuestMessagesHandler(messageService *messages.MessageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guest, _ := GuestFromContext(r.Context())
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 10 // Значение по умолчанию
+		}
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil || offset < 0 {
+			offset = 0 // Значение по умолчанию
+		}
+
+		messages, err := messageService.GetGuestMessages(r.Context(), guest.ID, limit, offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(messages)
+	}
+}
+
+func CreateGuestMessageHandler(messageService *messages.MessageService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		guest, _ := GuestFromContext(r.Context())
+
+		var req struct {
+			MessageText string `json:"message_text"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		message, err := messageService.CreateGuestMessage(r.Context(), guest.ID, req.MessageText)
+		if err != nil {
+			if errors.Is(err, messages.ErrInvalidMessage) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(message)
+	}
+}
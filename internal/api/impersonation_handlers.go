@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"web_auth/internal/modules/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ImpersonateHandler starts a session as the user in {userID}. It answers
+// with tokens like LoginHandler.
+func ImpersonateHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		var req struct {
+			Reason string `json:"reason"`
+		}
+
+		// the body is optional
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		actor, _ := UserFromContext(r.Context())
+		session, _ := SessionFromContext(r.Context())
+
+		token, err := authService.Impersonate(r.Context(), actor, session, userID, req.Reason, clientInfo(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrUserNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, auth.ErrForbidden), errors.Is(err, auth.ErrImpersonating):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, auth.ErrUserBlocked):
+				http.Error(w, err.Error(), http.StatusConflict)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+// StopImpersonationHandler ends the impersonation session of the request.
+func StopImpersonationHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		session, _ := SessionFromContext(r.Context())
+
+		if err := authService.StopImpersonation(r.Context(), user, session, clientInfo(r)); err != nil {
+			if errors.Is(err, auth.ErrNotImpersonating) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"web_auth/internal/modules/auth"
+)
+
+const (
+	// magicLinkNonceCookie binds a magic link to the browser that asked for
+	// it.
+	magicLinkNonceCookie = "magic_link_nonce"
+	magicLinkCookiePath  = "/login/magic-link"
+)
+
+// RequestMagicLinkHandler mails a sign in link. It answers 202 for unknown
+// emails too.
+func RequestMagicLinkHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if ok := isValidEmail(req.Email); !ok {
+			http.Error(w, "Invalid email format", http.StatusBadRequest)
+			return
+		}
+
+		nonce, err := authService.RequestMagicLink(r.Context(), req.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     magicLinkNonceCookie,
+			Value:    nonce,
+			Path:     magicLinkCookiePath,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			// opening the link from a mail client is a top level GET, which
+			// Lax cookies survive
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// MagicLinkCallbackHandler is the link sent by mail. It answers like
+// LoginHandler.
+func MagicLinkCallbackHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var nonce string
+		if cookie, err := r.Cookie(magicLinkNonceCookie); err == nil {
+			nonce = cookie.Value
+		}
+
+		token, challenge, err := authService.CompleteMagicLinkLogin(r.Context(), r.URL.Query().Get("token"),
+			nonce, clientInfo(r))
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidToken):
+				// a mangled or stale link leaves the browser's pending
+				// one usable
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrUserBlocked), errors.Is(err, auth.ErrEmailNotVerified):
+				// the link was used up before the account was checked
+				clearMagicLinkNonce(w, r)
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		clearMagicLinkNonce(w, r)
+
+		if challenge != nil {
+			json.NewEncoder(w).Encode(challenge)
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+func clearMagicLinkNonce(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Path:     magicLinkCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
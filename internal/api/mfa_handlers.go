@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"web_auth/internal/modules/auth"
+)
+
+func MFALoginHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			MFAToken string `json:"mfa_token"`
+			Code     string `json:"code"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		token, err := authService.CompleteMFALogin(r.Context(), req.MFAToken, req.Code, clientInfo(r))
+		if err != nil {
+			if writeTooManyAttempts(w, err) {
+				return
+			}
+
+			switch {
+			case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrInvalidOTP):
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			case errors.Is(err, auth.ErrUserBlocked), errors.Is(err, auth.ErrEmailNotVerified):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+func EnrollTOTPHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		enrollment, err := authService.EnrollTOTP(r.Context(), user)
+		if err != nil {
+			writeMFAError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(enrollment)
+	}
+}
+
+func ConfirmTOTPHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		var req struct {
+			Code string `json:"code"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		codes, err := authService.ConfirmTOTP(r.Context(), user.ID, req.Code, clientInfo(r))
+		if err != nil {
+			writeMFAError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func DisableTOTPHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		var req struct {
+			Code string `json:"code"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		if err := authService.DisableTOTP(r.Context(), user.ID, req.Code, clientInfo(r)); err != nil {
+			writeMFAError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func writeMFAError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidOTP):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrTOTPAlreadyEnabled), errors.Is(err, auth.ErrTOTPNotEnabled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
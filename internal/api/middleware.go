@@ -0,0 +1,234 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ctxKey int
+
+const (
+	userCtxKey ctxKey = iota
+	sessionCtxKey
+	guestCtxKey
+)
+
+// Authenticate validates the bearer access token and puts the token owner and
+// session into the request context. Requests without a valid token get 401,
+// blocked users get 403.
+func Authenticate(authService *auth.Auth) func(http.Handler) http.Handler {
+	return authenticate(authService, false)
+}
+
+// AuthenticateWithAPIKey works like Authenticate but also accepts API keys.
+// API key requests have no session in the context.
+func AuthenticateWithAPIKey(authService *auth.Auth) func(http.Handler) http.Handler {
+	return authenticate(authService, true)
+}
+
+func authenticate(authService *auth.Auth, allowAPIKeys bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accessToken, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			var (
+				user    *models.User
+				session *models.Session
+				err     error
+			)
+			if allowAPIKeys && auth.IsAPIKey(accessToken) {
+				user, err = authService.AuthenticateAPIKey(r.Context(), accessToken)
+			} else {
+				user, session, err = authService.AuthenticateAccessToken(r.Context(), accessToken)
+			}
+			if err != nil {
+				switch {
+				case errors.Is(err, auth.ErrInvalidToken):
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+				case errors.Is(err, auth.ErrUserBlocked):
+					http.Error(w, err.Error(), http.StatusForbidden)
+				default:
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+				}
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), userCtxKey, user)
+			if session != nil {
+				ctx = context.WithValue(ctx, sessionCtxKey, session)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AuthenticateGuest requires a guest token and puts the guest into the
+// request context.
+func AuthenticateGuest(authService *auth.Auth) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			guestToken, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+				return
+			}
+
+			guest, err := authService.AuthenticateGuest(r.Context(), guestToken)
+			if err != nil {
+				if errors.Is(err, auth.ErrInvalidToken) {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), guestCtxKey, guest)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// UserFromContext returns the user loaded by Authenticate.
+func UserFromContext(ctx context.Context) (*models.User, bool) {
+	user, ok := ctx.Value(userCtxKey).(*models.User)
+	return user, ok
+}
+
+// SessionFromContext returns the session loaded by Authenticate.
+func SessionFromContext(ctx context.Context) (*models.Session, bool) {
+	session, ok := ctx.Value(sessionCtxKey).(*models.Session)
+	return session, ok
+}
+
+// ActorFromContext returns the id of the admin acting as the context user if
+// the request was made with an impersonation session.
+func ActorFromContext(ctx context.Context) (int64, bool) {
+	session, ok := SessionFromContext(ctx)
+	if !ok || !session.Impersonated() {
+		return 0, false
+	}
+
+	return *session.ImpersonatorID, true
+}
+
+// actorID returns who is really behind the request for the audit log: the
+// impersonating admin if there is one, the context user otherwise.
+func actorID(ctx context.Context) int64 {
+	if id, ok := ActorFromContext(ctx); ok {
+		return id
+	}
+
+	user, _ := UserFromContext(ctx)
+	return user.ID
+}
+
+func GuestFromContext(ctx context.Context) (*models.Guest, bool) {
+	guest, ok := ctx.Value(guestCtxKey).(*models.Guest)
+	return guest, ok
+}
+
+func clientInfo(r *http.Request) models.ClientInfo {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return models.ClientInfo{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+
+	return token, token != ""
+}
+
+// RequirePermission only lets through users holding permission. It must be
+// mounted after Authenticate.
+func RequirePermission(authService *auth.Auth, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := UserFromContext(r.Context())
+
+			if err := authService.Authorize(r.Context(), user, permission); err != nil {
+				writeAuthzError(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireOwnerOrPermission lets users access routes whose {userID} is their own
+// id and requires permission for any other id. It must be mounted after
+// Authenticate.
+func RequireOwnerOrPermission(authService *auth.Auth, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := UserFromContext(r.Context())
+
+			ownerID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid user id", http.StatusBadRequest)
+				return
+			}
+
+			if err := authService.AuthorizeOwnerOr(r.Context(), user, ownerID, permission); err != nil {
+				writeAuthzError(w, err)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DenyImpersonation refuses requests made with an impersonation session, for
+// routes changing credentials that only the user themselves may touch. It
+// must be mounted after Authenticate.
+func DenyImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := ActorFromContext(r.Context()); ok {
+			http.Error(w, auth.ErrImpersonating.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeAuthzError(w http.ResponseWriter, err error) {
+	if errors.Is(err, auth.ErrForbidden) || errors.Is(err, auth.ErrMFARequired) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"web_auth/internal/modules/oauth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// writeOAuthError reports protocol errors as JSON (RFC 6749 section 5.2) and
+// anything else as a plain 500.
+func writeOAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	var oauthErr *oauth.Error
+	if !errors.As(err, &oauthErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == oauth.CodeInvalidClient {
+		status = http.StatusUnauthorized
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(oauthErr)
+}
+
+// clientCredentials reads the client id and secret from HTTP Basic
+// authentication or, failing that, from the form body.
+func clientCredentials(r *http.Request) (string, string) {
+	if id, secret, ok := r.BasicAuth(); ok {
+		// RFC 6749 section 2.3.1: both parts are form url encoded
+		if decoded, err := url.QueryUnescape(id); err == nil {
+			id = decoded
+		}
+		if decoded, err := url.QueryUnescape(secret); err == nil {
+			secret = decoded
+		}
+		return id, secret
+	}
+
+	return r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+}
+
+// OAuthAuthorizeHandler is called by the frontend once the user is signed in
+// and agreed to the request. The parameters are the ones the client sent to
+// the authorization endpoint, the response tells where to redirect the user.
+func OAuthAuthorizeHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		redirectTo, err := oauthServer.Authorize(r.Context(), user, oauth.AuthorizeRequest{
+			ResponseType:        r.Form.Get("response_type"),
+			ClientID:            r.Form.Get("client_id"),
+			RedirectURI:         r.Form.Get("redirect_uri"),
+			Scope:               r.Form.Get("scope"),
+			State:               r.Form.Get("state"),
+			CodeChallenge:       r.Form.Get("code_challenge"),
+			CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+			Nonce:               r.Form.Get("nonce"),
+		})
+		if err != nil {
+			writeOAuthError(w, r, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]string{"redirect_to": redirectTo})
+	}
+}
+
+func OAuthTokenHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, r, &oauth.Error{Code: oauth.CodeInvalidRequest, Description: "malformed form body"})
+			return
+		}
+
+		clientID, clientSecret := clientCredentials(r)
+
+		resp, err := oauthServer.Token(r.Context(), oauth.TokenRequest{
+			GrantType:    r.PostFormValue("grant_type"),
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			Code:         r.PostFormValue("code"),
+			RedirectURI:  r.PostFormValue("redirect_uri"),
+			CodeVerifier: r.PostFormValue("code_verifier"),
+			RefreshToken: r.PostFormValue("refresh_token"),
+			Scope:        r.PostFormValue("scope"),
+		})
+		if err != nil {
+			writeOAuthError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func OAuthIntrospectHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret := clientCredentials(r)
+
+		resp, err := oauthServer.Introspect(r.Context(), clientID, clientSecret, r.PostFormValue("token"))
+		if err != nil {
+			writeOAuthError(w, r, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func OAuthRevokeHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret := clientCredentials(r)
+
+		if err := oauthServer.Revoke(r.Context(), clientID, clientSecret, r.PostFormValue("token")); err != nil {
+			writeOAuthError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func OIDCDiscoveryHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(oauthServer.Discovery())
+	}
+}
+
+func JWKSHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys, err := oauthServer.JWKS(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// short enough for relying parties to pick up a rotated key quickly
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(keys)
+	}
+}
+
+// UserInfoHandler serves the OpenID Connect userinfo endpoint. It takes an
+// OAuth access token, not a session token, and reports errors the RFC 6750
+// way.
+func UserInfoHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accessToken, ok := bearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		info, err := oauthServer.UserInfo(r.Context(), accessToken)
+		if err != nil {
+			var oauthErr *oauth.Error
+			if !errors.As(err, &oauthErr) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			status := http.StatusUnauthorized
+			if oauthErr.Code == oauth.CodeInsufficientScope {
+				status = http.StatusForbidden
+			}
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer error=%q, error_description=%q`, oauthErr.Code, oauthErr.Description))
+			http.Error(w, oauthErr.Description, status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(info)
+	}
+}
+
+func RegisterOAuthClientHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req oauth.ClientRegistration
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		client, err := oauthServer.RegisterClient(r.Context(), actorID(r.Context()), req, clientInfo(r))
+		if err != nil {
+			writeOAuthError(w, r, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(client)
+	}
+}
+
+func ListOAuthClientsHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clients, err := oauthServer.ListClients(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(clients)
+	}
+}
+
+func DeleteOAuthClientHandler(oauthServer *oauth.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := oauthServer.DeleteClient(r.Context(), actorID(r.Context()), chi.URLParam(r, "clientID"), clientInfo(r))
+		if err != nil {
+			if errors.Is(err, oauth.ErrClientNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/modules/ratelimit"
+)
+
+// RateLimitKeyFunc returns the identity a request is counted against.
+type RateLimitKeyFunc func(r *http.Request) string
+
+// RateLimitByIP counts requests per client IP.
+func RateLimitByIP(r *http.Request) string {
+	return "ip:" + clientInfo(r).IP
+}
+
+// RateLimitByUser counts requests per authenticated user and falls back to
+// the client IP outside of Authenticate.
+func RateLimitByUser(r *http.Request) string {
+	if user, ok := UserFromContext(r.Context()); ok {
+		return "user:" + strconv.FormatInt(user.ID, 10)
+	}
+	return RateLimitByIP(r)
+}
+
+// RateLimit limits requests of the named route group with a token bucket and
+// reports the bucket state in RateLimit-* headers. Store errors let the
+// request through, an unavailable limiter shouldn't take the API down.
+func RateLimit(store ratelimit.Store, group string, rule config.RateLimitRule, key RateLimitKeyFunc) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if store == nil || rule.Requests <= 0 || rule.Period <= 0 {
+			return next
+		}
+
+		policy := fmt.Sprintf("%d;w=%d", rule.Requests, int(rule.Period.Seconds()))
+		if rule.Burst > 0 {
+			policy += ";burst=" + strconv.Itoa(rule.Burst)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := store.Take(r.Context(), group+":"+key(r), rule)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Policy", policy)
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(ceilSeconds(res.RetryAfter), 1)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
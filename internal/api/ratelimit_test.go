@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ratelimitstore "web_auth/internal/adapters/ratelimit"
+	"web_auth/internal/config"
+)
+
+func TestRateLimit(t *testing.T) {
+	rule := config.RateLimitRule{Requests: 10, Period: time.Minute, Burst: 2}
+	handler := RateLimit(ratelimitstore.NewMemory(), "auth", rule, RateLimitByIP)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}),
+	)
+
+	do := func(ip string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.RemoteAddr = ip + ":41000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	for i, wantRemaining := range []string{"1", "0"} {
+		w := do("203.0.113.5")
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d, want %d", i+1, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get("RateLimit-Remaining"); got != wantRemaining {
+			t.Errorf("request %d: RateLimit-Remaining = %q, want %q", i+1, got, wantRemaining)
+		}
+	}
+
+	w := do("203.0.113.5")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("request over the burst: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	for header, want := range map[string]string{
+		"Retry-After":         "6",
+		"RateLimit-Policy":    "10;w=60;burst=2",
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "0",
+		"RateLimit-Reset":     "12",
+	} {
+		if got := w.Header().Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	// another client has its own bucket
+	if w := do("203.0.113.6"); w.Code != http.StatusNoContent {
+		t.Errorf("other client: status %d, want %d", w.Code, http.StatusNoContent)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := RateLimit(ratelimitstore.NewMemory(), "auth", config.RateLimitRule{}, RateLimitByIP)(next)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("rule without requests limited the route, RateLimit-Limit = %q", got)
+	}
+}
@@ -2,23 +2,150 @@ package api
 
 import (
 	"net/http"
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+	"web_auth/internal/modules/audit"
 	"web_auth/internal/modules/auth"
 	"web_auth/internal/modules/messages"
+	"web_auth/internal/modules/oauth"
+	"web_auth/internal/modules/ratelimit"
 
 	"github.com/go-chi/chi/v5"
 )
 
-func NewRouter(authService *auth.Auth, messageService *messages.MessageService) http.Handler {
+// NewRouter builds the REST API. limiter may be nil to turn rate limiting off.
+func NewRouter(authService *auth.Auth, messageService *messages.MessageService, oauthServer *oauth.Server,
+	auditService *audit.Service, limiter ratelimit.Store, limits config.RateLimit,
+) http.Handler {
 	r := chi.NewRouter()
 
-	r.Post("/register", RegisterHandler(authService))
-	r.Post("/login", LoginHandler(authService))
+	r.Get("/healthz", HealthHandler())
+	r.Get("/.well-known/openid-configuration", OIDCDiscoveryHandler(oauthServer))
+	r.Get("/.well-known/jwks.json", JWKSHandler(oauthServer))
 
-	r.Get("/users", ListUsersHandler(authService))
-	r.Get("/users/{userID}", GetUserHandler(authService))
-	r.Post("/users/{userID}/block", BlockUserHandler(authService))
+	r.Group(func(r chi.Router) {
+		r.Use(RateLimit(limiter, "auth", limits.Auth, RateLimitByIP))
 
-	r.Get("/users/{userID}/messages", GetUserMessagesHandler(messageService))
+		r.Post("/register", RegisterHandler(authService))
+		r.Post("/login", LoginHandler(authService))
+		r.Post("/login/2fa", MFALoginHandler(authService))
+		r.Post("/login/webauthn/begin", BeginWebAuthnLoginHandler(authService))
+		r.Post("/login/webauthn/finish", FinishWebAuthnLoginHandler(authService))
+		r.Get("/login/oidc/{provider}", BeginFederatedLoginHandler(authService))
+		r.Get("/login/oidc/{provider}/callback", FederatedLoginCallbackHandler(authService))
+		r.Post("/login/magic-link", RequestMagicLinkHandler(authService))
+		r.Get("/login/magic-link/callback", MagicLinkCallbackHandler(authService))
+		r.Post("/token/refresh", RefreshTokenHandler(authService))
+		r.Post("/password/forgot", ForgotPasswordHandler(authService))
+		r.Post("/password/reset", ResetPasswordHandler(authService))
+		r.Get("/verify-email", VerifyEmailHandler(authService))
+		r.Post("/verify-email/resend", ResendVerificationEmailHandler(authService))
+		r.Get("/email/confirm", ConfirmEmailChangeHandler(authService))
+		r.Post("/anonymous", CreateGuestHandler(authService))
+
+		r.Post("/oauth/token", OAuthTokenHandler(oauthServer))
+		r.Post("/oauth/introspect", OAuthIntrospectHandler(oauthServer))
+		r.Post("/oauth/revoke", OAuthRevokeHandler(oauthServer))
+		r.Get("/userinfo", UserInfoHandler(oauthServer))
+		r.Post("/userinfo", UserInfoHandler(oauthServer))
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Use(AuthenticateGuest(authService))
+		r.Use(RateLimit(limiter, "messages", limits.Messages, RateLimitByIP))
+
+		r.Get("/anonymous/messages", GetGuestMessagesHandler(messageService))
+		r.Post("/anonymous/messages", CreateGuestMessageHandler(messageService))
+	})
+
+	// Routes acting on the caller's own account need a login session.
+	r.Group(func(r chi.Router) {
+		r.Use(Authenticate(authService))
+		r.Use(RateLimit(limiter, "api", limits.API, RateLimitByUser))
+
+		r.Post("/logout", LogoutHandler(authService))
+		r.Get("/me/sessions", ListSessionsHandler(authService))
+		r.Get("/me/logins", ListLoginsHandler(authService))
+
+		r.Post("/impersonation/stop", StopImpersonationHandler(authService))
+
+		// Credentials are the user's own business, an admin acting as the
+		// user can't change them.
+		r.Group(func(r chi.Router) {
+			r.Use(DenyImpersonation)
+
+			r.Delete("/me/sessions", RevokeOtherSessionsHandler(authService))
+			r.Delete("/me/sessions/{sessionID}", RevokeSessionHandler(authService))
+			r.Put("/me/password", ChangePasswordHandler(authService))
+			r.Post("/me/email", ChangeEmailHandler(authService))
+
+			r.Post("/me/2fa/totp", EnrollTOTPHandler(authService))
+			r.Post("/me/2fa/totp/confirm", ConfirmTOTPHandler(authService))
+			r.Delete("/me/2fa/totp", DisableTOTPHandler(authService))
+
+			r.Post("/me/webauthn/register/begin", BeginWebAuthnRegistrationHandler(authService))
+			r.Post("/me/webauthn/register/finish", FinishWebAuthnRegistrationHandler(authService))
+
+			r.Post("/me/api-keys", CreateAPIKeyHandler(authService))
+			r.Delete("/me/api-keys/{keyID}", RevokeAPIKeyHandler(authService))
+			r.Delete("/me/identities/{provider}", UnlinkFederatedIdentityHandler(authService))
+
+			r.Get("/oauth/authorize", OAuthAuthorizeHandler(oauthServer))
+			r.Post("/oauth/authorize", OAuthAuthorizeHandler(oauthServer))
+
+			r.With(RequirePermission(authService, models.PermissionUsersImpersonate)).
+				Post("/users/{userID}/impersonate", ImpersonateHandler(authService))
+		})
+
+		r.Get("/me/api-keys", ListAPIKeysHandler(authService))
+		r.Get("/me/identities", ListFederatedIdentitiesHandler(authService))
+	})
+
+	// Data routes also accept API keys, limited to their scopes.
+	r.Group(func(r chi.Router) {
+		r.Use(AuthenticateWithAPIKey(authService))
+
+		r.Group(func(r chi.Router) {
+			r.Use(RateLimit(limiter, "api", limits.API, RateLimitByUser))
+
+			r.With(RequirePermission(authService, models.PermissionUsersList)).
+				Get("/users", ListUsersHandler(authService))
+			r.With(RequireOwnerOrPermission(authService, models.PermissionUsersRead)).
+				Get("/users/{userID}", GetUserHandler(authService))
+			r.With(RequirePermission(authService, models.PermissionUsersBlock)).
+				Post("/users/{userID}/block", BlockUserHandler(authService))
+			r.With(RequirePermission(authService, models.PermissionUsersBlock)).
+				Post("/users/{userID}/unblock", UnblockUserHandler(authService))
+			r.With(RequirePermission(authService, models.PermissionUsersBlock)).
+				Delete("/users/{userID}/lockout", ClearLockoutHandler(authService))
+
+			r.Route("/oauth/clients", func(r chi.Router) {
+				r.Use(RequirePermission(authService, models.PermissionOAuthClients))
+
+				r.Post("/", RegisterOAuthClientHandler(oauthServer))
+				r.Get("/", ListOAuthClientsHandler(oauthServer))
+				r.Delete("/{clientID}", DeleteOAuthClientHandler(oauthServer))
+			})
+
+			r.Route("/audit", func(r chi.Router) {
+				r.Use(RequirePermission(authService, models.PermissionAuditRead))
+
+				r.Get("/", ListAuditEventsHandler(auditService))
+				r.Get("/verify", VerifyAuditLogHandler(auditService))
+			})
+		})
+
+		r.With(
+			RateLimit(limiter, "messages", limits.Messages, RateLimitByUser),
+			RequireOwnerOrPermission(authService, models.PermissionMessagesRead),
+		).Get("/users/{userID}/messages", GetUserMessagesHandler(messageService))
+	})
 
 	return r
 }
+
+func HealthHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+}
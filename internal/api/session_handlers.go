@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"web_auth/internal/modules/auth"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func LogoutHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		session, _ := SessionFromContext(r.Context())
+
+		var err error
+		// logging out of an impersonation session is stopping it
+		if session.Impersonated() {
+			err = authService.StopImpersonation(r.Context(), user, session, clientInfo(r))
+		} else {
+			err = authService.Logout(r.Context(), user.ID, session.ID)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ListLoginsHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 10 // Значение по умолчанию
+		}
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil || offset < 0 {
+			offset = 0 // Значение по умолчанию
+		}
+
+		logins, err := authService.ListLogins(r.Context(), user.ID, limit, offset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(logins)
+	}
+}
+
+func ListSessionsHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		session, _ := SessionFromContext(r.Context())
+
+		sessions, err := authService.ListSessions(r.Context(), user.ID, session.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(sessions)
+	}
+}
+
+// RevokeOtherSessionsHandler logs the user out on every other device.
+func RevokeOtherSessionsHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		session, _ := SessionFromContext(r.Context())
+
+		if err := authService.RevokeOtherSessions(r.Context(), user.ID, session.ID, clientInfo(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func RevokeSessionHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		err := authService.RevokeSession(r.Context(), user.ID, chi.URLParam(r, "sessionID"), clientInfo(r))
+		if err != nil {
+			if errors.Is(err, auth.ErrSessionNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -2,6 +2,8 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -50,8 +52,22 @@ func BlockUserHandler(authService *auth.Auth) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, _ := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
 
-		err := authService.BlockUser(r.Context(), userID)
+		var req struct {
+			Reason string `json:"reason"`
+		}
+
+		// Тело запроса необязательное
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		err := authService.BlockUser(r.Context(), actorID(r.Context()), userID, req.Reason, clientInfo(r))
 		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -62,6 +78,44 @@ func BlockUserHandler(authService *auth.Auth) http.HandlerFunc {
 	}
 }
 
+func UnblockUserHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+
+		err := authService.UnblockUser(r.Context(), actorID(r.Context()), userID, clientInfo(r))
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"successfully user unblocked by id:": userID,
+		})
+	}
+}
+
+func ClearLockoutHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, _ := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+
+		err := authService.ClearLockout(r.Context(), actorID(r.Context()), userID, clientInfo(r))
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
 func GetUserMessagesHandler(messageService *messages.MessageService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		userID, _ := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"web_auth/internal/modules/auth"
+)
+
+type webAuthnFinishRequest struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+func BeginWebAuthnRegistrationHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		ceremony, err := authService.BeginWebAuthnRegistration(r.Context(), user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(ceremony)
+	}
+}
+
+func FinishWebAuthnRegistrationHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+
+		var req webAuthnFinishRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		err := authService.FinishWebAuthnRegistration(r.Context(), user, req.CeremonyID, req.Credential)
+		if err != nil {
+			writeWebAuthnError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func BeginWebAuthnLoginHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+
+		// Без email выполняется вход по discoverable-ключу
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		ceremony, err := authService.BeginWebAuthnLogin(r.Context(), req.Email)
+		if err != nil {
+			writeWebAuthnError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(ceremony)
+	}
+}
+
+func FinishWebAuthnLoginHandler(authService *auth.Auth) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req webAuthnFinishRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		token, err := authService.FinishWebAuthnLogin(r.Context(), req.CeremonyID, req.Credential, clientInfo(r))
+		if err != nil {
+			writeWebAuthnError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(token)
+	}
+}
+
+func writeWebAuthnError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidToken),
+		errors.Is(err, auth.ErrWebAuthnFailed),
+		errors.Is(err, auth.ErrInvalidCredentials):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, auth.ErrUserBlocked), errors.Is(err, auth.ErrEmailNotVerified):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, auth.ErrCredentialExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -8,10 +8,23 @@ import (
 )
 
 type Config struct {
-	Env      string         `yaml:"env"`
-	Postgres PostgresConfig `yaml:"postgres"`
-	REST     REST           `yaml:"rest"`
-	MockDB   MockDB         `yaml:"mock_db"`
+	Env       string         `yaml:"env"`
+	Postgres  PostgresConfig `yaml:"postgres"`
+	REST      REST           `yaml:"rest"`
+	MockDB    MockDB         `yaml:"mock_db"`
+	Token     Token          `yaml:"token"`
+	Auth      Auth           `yaml:"auth"`
+	Password  Password       `yaml:"password"`
+	WebAuthn  WebAuthn       `yaml:"webauthn"`
+	Mail      Mail           `yaml:"mail"`
+	RateLimit RateLimit      `yaml:"rate_limit"`
+	OAuth     OAuth          `yaml:"oauth"`
+	// OIDCProviders are the external identity providers users can sign in
+	// with.
+	OIDCProviders []OIDCProvider `yaml:"oidc_providers"`
+	// LDAP lists the directories that authenticate users of their email
+	// domains instead of the local password.
+	LDAP []LDAPDirectory `yaml:"ldap"`
 }
 
 type PostgresConfig struct {
@@ -34,6 +47,185 @@ type MockDB struct {
 	MsgCount  int `yaml:"msg_count"`
 }
 
+type Token struct {
+	// Algorithm is one of HS256, RS256 or EdDSA.
+	Algorithm      string        `yaml:"algorithm" env-default:"HS256"`
+	Secret         string        `yaml:"secret" env:"TOKEN_SECRET"`
+	PrivateKeyPath string        `yaml:"private_key_path" env:"TOKEN_PRIVATE_KEY_PATH"`
+	PublicKeyPath  string        `yaml:"public_key_path" env:"TOKEN_PUBLIC_KEY_PATH"`
+	Issuer         string        `yaml:"issuer" env-default:"web_auth"`
+	AccessTTL      time.Duration `yaml:"access_ttl" env-default:"15m"`
+	RefreshTTL     time.Duration `yaml:"refresh_ttl" env-default:"720h"`
+}
+
+type Auth struct {
+	// PublicURL is the externally visible base URL used in links sent by mail.
+	PublicURL        string        `yaml:"public_url" env-default:"http://localhost:8080"`
+	TOTPIssuer       string        `yaml:"totp_issuer" env-default:"web_auth"`
+	TOTPSkew         int           `yaml:"totp_skew" env-default:"1"`
+	MFATokenTTL      time.Duration `yaml:"mfa_token_ttl" env-default:"5m"`
+	PasswordResetTTL time.Duration `yaml:"password_reset_ttl" env-default:"1h"`
+	// PasswordResetURL is the frontend page asking for the new password, the
+	// reset token is added as its token query parameter. Without it reset
+	// emails only carry the token.
+	PasswordResetURL string `yaml:"password_reset_url"`
+	// RequireVerifiedEmail makes Login refuse accounts that haven't confirmed
+	// their email address yet.
+	RequireVerifiedEmail bool          `yaml:"require_verified_email" env-default:"false"`
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl" env-default:"24h"`
+	GuestTokenTTL        time.Duration `yaml:"guest_token_ttl" env-default:"720h"`
+	// FederatedLoginTTL is how long a user may take to sign in at an
+	// external identity provider.
+	FederatedLoginTTL time.Duration `yaml:"federated_login_ttl" env-default:"10m"`
+	MagicLinkTTL      time.Duration `yaml:"magic_link_ttl" env-default:"15m"`
+	// ImpersonationTTL is how long an admin may act as another user before
+	// having to start over.
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl" env-default:"1h"`
+	// LoginNotifier alerts users of logins from new devices and networks,
+	// "mail" or "none".
+	LoginNotifier string  `yaml:"login_notifier" env-default:"mail"`
+	Lockout       Lockout `yaml:"lockout"`
+	// AdminEmails are granted the admin role at startup, once their accounts
+	// exist and have a confirmed email.
+	AdminEmails []string `yaml:"admin_emails" env:"ADMIN_EMAILS" env-separator:","`
+}
+
+// Lockout configures brute-force protection of the login endpoints. Once a key
+// (an account or a client IP) reaches its attempt limit it is locked for
+// BaseDelay, doubling with every further failure up to MaxDelay. Failures are
+// forgotten after the key has been quiet for Window.
+type Lockout struct {
+	// Store is "postgres" or "memory".
+	Store         string        `yaml:"store" env-default:"postgres"`
+	MaxAttempts   int           `yaml:"max_attempts" env-default:"5"`
+	MaxIPAttempts int           `yaml:"max_ip_attempts" env-default:"20"`
+	Window        time.Duration `yaml:"window" env-default:"15m"`
+	BaseDelay     time.Duration `yaml:"base_delay" env-default:"30s"`
+	MaxDelay      time.Duration `yaml:"max_delay" env-default:"1h"`
+}
+
+// Password selects how new password hashes are produced. Hashes made with
+// other settings still verify and are upgraded on the next login.
+type Password struct {
+	// Algorithm is "argon2id" or "bcrypt".
+	Algorithm  string `yaml:"algorithm" env-default:"argon2id"`
+	BcryptCost int    `yaml:"bcrypt_cost" env-default:"10"`
+	// Argon2Memory is in KiB.
+	Argon2Memory      uint32         `yaml:"argon2_memory" env-default:"65536"`
+	Argon2Iterations  uint32         `yaml:"argon2_iterations" env-default:"3"`
+	Argon2Parallelism uint32         `yaml:"argon2_parallelism" env-default:"2"`
+	Argon2SaltLength  uint32         `yaml:"argon2_salt_length" env-default:"16"`
+	Argon2KeyLength   uint32         `yaml:"argon2_key_length" env-default:"32"`
+	Policy            PasswordPolicy `yaml:"policy"`
+}
+
+// PasswordPolicy is checked whenever a user chooses a new password.
+type PasswordPolicy struct {
+	MinLength     int  `yaml:"min_length" env-default:"8"`
+	MaxLength     int  `yaml:"max_length" env-default:"128"`
+	RequireLower  bool `yaml:"require_lower" env-default:"false"`
+	RequireUpper  bool `yaml:"require_upper" env-default:"false"`
+	RequireDigit  bool `yaml:"require_digit" env-default:"false"`
+	RequireSymbol bool `yaml:"require_symbol" env-default:"false"`
+	// DisallowEmail rejects passwords containing the local part of the email.
+	DisallowEmail bool `yaml:"disallow_email" env-default:"true"`
+	// MinStrength is the lowest accepted strength score, 0 (guessable in a
+	// few tries) to 4 (very strong).
+	MinStrength int `yaml:"min_strength" env-default:"2"`
+	// BreachedDir holds breached password SHA-1 hashes split into files by
+	// their first 5 hex characters, e.g. 5BAA6.txt with "SUFFIX:COUNT" lines,
+	// the layout of the Have I Been Pwned range downloads. Empty disables the
+	// check.
+	BreachedDir string `yaml:"breached_dir" env:"PASSWORD_BREACHED_DIR"`
+}
+
+type WebAuthn struct {
+	RPID          string        `yaml:"rp_id" env-default:"localhost"`
+	RPDisplayName string        `yaml:"rp_display_name" env-default:"web_auth"`
+	RPOrigins     []string      `yaml:"rp_origins" env-default:"http://localhost:8080"`
+	Timeout       time.Duration `yaml:"timeout" env-default:"5m"`
+}
+
+type Mail struct {
+	// Driver is "log" or "file".
+	Driver string `yaml:"driver" env-default:"log"`
+	From   string `yaml:"from" env-default:"no-reply@web-auth.local"`
+	Dir    string `yaml:"dir" env-default:"mail"`
+}
+
+// OAuth configures the OAuth 2.0 authorization server and its OpenID Connect
+// layer.
+type OAuth struct {
+	// Issuer is the OpenID Provider identifier, the public base URL the
+	// discovery document is served under.
+	Issuer               string        `yaml:"issuer" env:"OAUTH_ISSUER" env-default:"http://localhost:8080"`
+	AuthorizationCodeTTL time.Duration `yaml:"authorization_code_ttl" env-default:"5m"`
+	AccessTokenTTL       time.Duration `yaml:"access_token_ttl" env-default:"1h"`
+	RefreshTokenTTL      time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	IDTokenTTL           time.Duration `yaml:"id_token_ttl" env-default:"1h"`
+	// SigningKeyRotation is how long an ID token signing key is used before a
+	// new one is generated.
+	SigningKeyRotation time.Duration `yaml:"signing_key_rotation" env-default:"720h"`
+}
+
+// OIDCProvider is an upstream identity provider. Its endpoints and keys are
+// discovered from the issuer, the callback is
+// {auth.public_url}/login/oidc/{name}/callback.
+type OIDCProvider struct {
+	Name         string   `yaml:"name"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret"`
+	Scopes       []string `yaml:"scopes"`
+}
+
+// LDAPDirectory authenticates the users of Domains by binding to the
+// directory. The user's DN is either built from UserDN or, if that is empty,
+// searched under BaseDN with UserFilter. In UserDN, UserFilter and
+// GroupFilter {username} is the local part of the email and {email} the whole
+// address; GroupFilter also knows {dn}, the user's DN.
+type LDAPDirectory struct {
+	Name    string   `yaml:"name"`
+	Domains []string `yaml:"domains"`
+	// URL is ldap://host:389 or ldaps://host:636.
+	URL      string        `yaml:"url"`
+	StartTLS bool          `yaml:"start_tls"`
+	Timeout  time.Duration `yaml:"timeout" env-default:"5s"`
+	UserDN   string        `yaml:"user_dn"`
+	// BindDN and BindPassword are the service account searching the
+	// directory, anonymous if empty.
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"bind_password"`
+	BaseDN       string `yaml:"base_dn"`
+	UserFilter   string `yaml:"user_filter"`
+	// GroupBaseDN and GroupFilter find the user's groups. Without them the
+	// memberOf attribute of the user entry is used.
+	GroupBaseDN string `yaml:"group_base_dn"`
+	GroupFilter string `yaml:"group_filter"`
+	// GroupRoles maps group DNs to roles. Mapped roles are granted and
+	// revoked on every login, other roles are left alone.
+	GroupRoles map[string]string `yaml:"group_roles"`
+}
+
+// RateLimit holds the token bucket limits of the REST route groups. Public
+// auth endpoints are limited per client IP, the rest per authenticated user.
+type RateLimit struct {
+	// Store is "memory", the only built-in backend for now.
+	Store    string        `yaml:"store" env-default:"memory"`
+	Auth     RateLimitRule `yaml:"auth"`
+	API      RateLimitRule `yaml:"api"`
+	Messages RateLimitRule `yaml:"messages"`
+}
+
+// RateLimitRule allows Requests per Period on average with bursts of up to
+// Burst requests (Requests if unset). A rule with no requests disables the
+// limit.
+type RateLimitRule struct {
+	Requests int           `yaml:"requests"`
+	Period   time.Duration `yaml:"period"`
+	Burst    int           `yaml:"burst"`
+}
+
 func MustLoad() *Config {
 	err := godotenv.Load()
 	if err != nil {
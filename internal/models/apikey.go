@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// APIKey lets a program act as its owner, limited to Scopes.
+type APIKey struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"-"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// Active reports whether the key can still be used at t.
+func (k *APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// NewAPIKey is returned once on creation, the secret key can't be shown again.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// Audit event types.
+const (
+	AuditUserRegister        = "user.register"
+	AuditUserLogin           = "user.login"
+	AuditUserBlock           = "user.block"
+	AuditUserUnblock         = "user.unblock"
+	AuditLockoutClear        = "lockout.clear"
+	AuditPasswordChange      = "password.change"
+	AuditPasswordReset       = "password.reset"
+	AuditImpersonationStart  = "impersonation.start"
+	AuditImpersonationStop   = "impersonation.stop"
+	AuditEmailChange         = "email.change"
+	AuditTOTPEnable          = "totp.enable"
+	AuditTOTPDisable         = "totp.disable"
+	AuditAPIKeyCreate        = "api_key.create"
+	AuditAPIKeyRevoke        = "api_key.revoke"
+	AuditSessionRevoke       = "session.revoke"
+	AuditSessionRevokeOthers = "session.revoke_others"
+	AuditOAuthClientCreate   = "oauth_client.create"
+	AuditOAuthClientDelete   = "oauth_client.delete"
+	AuditRoleGrant           = "role.grant"
+)
+
+// AuditEvent is an entry of the security audit log. Entries form a hash
+// chain: Hash covers the entry's fields and PrevHash, the Hash of the entry
+// before it.
+type AuditEvent struct {
+	ID      int64  `json:"id"`
+	Type    string `json:"type"`
+	Outcome string `json:"outcome"`
+	// ActorID is who did it, TargetID whom it was done to. Either is unset
+	// if unknown, e.g. a login with an unregistered email.
+	ActorID   *int64 `json:"actor_id,omitempty"`
+	TargetID  *int64 `json:"target_id,omitempty"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	// Details is free-form context such as a block reason or why the
+	// action failed.
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// AuditFilter selects audit events. Zero fields don't filter.
+type AuditFilter struct {
+	// UserID matches events where the user is the actor or the target.
+	UserID *int64
+	Type   string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+// AuditVerification is the result of checking the audit log hash chain.
+type AuditVerification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// BrokenAt is the first event that doesn't match its hash or
+	// predecessor.
+	BrokenAt *int64 `json:"broken_at,omitempty"`
+}
@@ -0,0 +1,10 @@
+package models
+
+// DirectoryUser is a user authenticated by an LDAP directory.
+type DirectoryUser struct {
+	DN     string
+	Email  string
+	Groups []string
+	// Roles are the roles the user's groups map to.
+	Roles []string
+}
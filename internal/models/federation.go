@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// FederatedIdentity links an account at an external identity provider to a
+// local user.
+type FederatedIdentity struct {
+	UserID      int64      `json:"-"`
+	Provider    string     `json:"provider"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// ExternalIdentity is what an identity provider asserted about the user who
+// just signed in there.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// FederatedLogin is a sign in started at an identity provider that hasn't
+// come back yet.
+type FederatedLogin struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Guest is an anonymous identity that can own data before registering.
+type Guest struct {
+	ID         int64     `json:"-"`
+	Identifier string    `json:"guest_id"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// GuestToken is returned when a guest identity is created.
+type GuestToken struct {
+	GuestID    string    `json:"guest_id"`
+	GuestToken string    `json:"guest_token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
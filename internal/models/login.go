@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// Login attempt results.
+const (
+	LoginSuccess = "success"
+	LoginFailure = "failure"
+	// LoginMFARequired is a first factor that passed, the second factor
+	// attempt is recorded separately.
+	LoginMFARequired = "mfa_required"
+)
+
+// Login methods.
+const (
+	LoginMethodPassword     = "password"
+	LoginMethodLDAP         = "ldap"
+	LoginMethodSecondFactor = "second_factor"
+	LoginMethodPasskey      = "passkey"
+	LoginMethodOIDC         = "oidc"
+	LoginMethodMagicLink    = "magic_link"
+)
+
+// LoginAttempt is an entry of a user's login history.
+type LoginAttempt struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"-"`
+	Method    string `json:"method"`
+	Result    string `json:"result"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	// Device fingerprints the client, IPRange is the network IP belongs to.
+	// They are what new device alerts compare.
+	Device    string    `json:"-"`
+	IPRange   string    `json:"ip_range"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// LoginOrigin tells which parts of a login's origin the user has
+// successfully signed in from before.
+type LoginOrigin struct {
+	// FirstLogin is set if the user never signed in successfully.
+	FirstLogin   bool
+	KnownDevice  bool
+	KnownIPRange bool
+}
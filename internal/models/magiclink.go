@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// MagicLink is an emailed sign in link. Only the hash of the nonce kept in
+// the requesting browser is stored.
+type MagicLink struct {
+	ID        string
+	UserID    int64
+	Email     string
+	NonceHash string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type TOTP struct {
+	UserID       int64
+	Secret       string
+	LastUsedStep int64
+	CreatedAt    time.Time
+	ConfirmedAt  *time.Time
+}
+
+// TOTPEnrollment is returned once when a user starts enrolling an
+// authenticator app.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFAChallenge is returned by login instead of tokens when the account has a
+// second factor enabled.
+type MFAChallenge struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// WebAuthnCeremony carries the options for navigator.credentials.create() or
+// .get() and the id the client must send back with the authenticator response.
+type WebAuthnCeremony struct {
+	ID      string      `json:"ceremony_id"`
+	Options interface{} `json:"options"`
+}
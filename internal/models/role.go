@@ -0,0 +1,28 @@
+package models
+
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+const (
+	PermissionUsersList    = "users:list"
+	PermissionUsersRead    = "users:read"
+	PermissionUsersBlock   = "users:block"
+	PermissionMessagesRead = "messages:read"
+	PermissionOAuthClients = "oauth:clients"
+	PermissionAuditRead    = "audit:read"
+	// PermissionUsersImpersonate isn't an API key scope, impersonation needs
+	// a login session.
+	PermissionUsersImpersonate = "users:impersonate"
+)
+
+// Permissions lists every permission, they double as API key scopes.
+var Permissions = []string{
+	PermissionUsersList,
+	PermissionUsersRead,
+	PermissionUsersBlock,
+	PermissionMessagesRead,
+	PermissionOAuthClients,
+	PermissionAuditRead,
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID         string     `json:"id"`
+	UserID     int64      `json:"-"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"-"`
+	// ImpersonatorID is the admin acting as the user in this session.
+	ImpersonatorID *int64 `json:"impersonator_id,omitempty"`
+	Current        bool   `json:"current"`
+}
+
+// Impersonated reports whether someone else acts as the user.
+func (s *Session) Impersonated() bool {
+	return s.ImpersonatorID != nil
+}
+
+// Active reports whether the session can still be used at t.
+func (s *Session) Active(t time.Time) bool {
+	return s.RevokedAt == nil && t.Before(s.ExpiresAt)
+}
+
+// ClientInfo describes the device a request came from.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
@@ -3,9 +3,16 @@ package models
 import "time"
 
 type User struct {
-	ID             int64     `json:"id"`
-	Email          string    `json:"email"`
-	PasswordHashed string    `json:"-"`
-	CreatedAt      time.Time `json:"created_at"`
-	IsActive       bool      `json:"is_active"`
+	ID              int64      `json:"id"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	PasswordHashed  string     `json:"-"`
+	CreatedAt       time.Time  `json:"created_at"`
+	IsActive        bool       `json:"is_active"`
+	BlockedAt       *time.Time `json:"blocked_at,omitempty"`
+	BlockReason     *string    `json:"block_reason,omitempty"`
+	Roles           []string   `json:"roles,omitempty"`
+	// APIKey is the key the current request was authenticated with, nil for
+	// session tokens. Its scopes narrow down what the user may do.
+	APIKey *APIKey `json:"-"`
 }
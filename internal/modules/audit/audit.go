@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"web_auth/internal/models"
+)
+
+// verifyBatchSize is how many events Verify loads at a time.
+const verifyBatchSize = 500
+
+type Store interface {
+	// AppendAuditEvent sets the event's PrevHash to the hash of the last
+	// event and its CreatedAt, then stores it with the Hash computed by
+	// hash. Appends must be serialized so the chain doesn't fork.
+	AppendAuditEvent(ctx context.Context, event *models.AuditEvent, hash func(*models.AuditEvent) string) error
+	ListAuditEvents(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error)
+	// AuditEventsAfter returns up to limit events with an id above afterID,
+	// oldest first.
+	AuditEventsAfter(ctx context.Context, afterID int64, limit int) ([]models.AuditEvent, error)
+}
+
+// Service keeps the append-only security audit log.
+type Service struct {
+	log   *slog.Logger
+	store Store
+}
+
+func New(log *slog.Logger, store Store) *Service {
+	return &Service{
+		log:   log,
+		store: store,
+	}
+}
+
+// Record appends the event to the log.
+func (s *Service) Record(ctx context.Context, event *models.AuditEvent) error {
+	const op = "audit.Record"
+
+	if err := s.store.AppendAuditEvent(ctx, event, Hash); err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to append audit event",
+			slog.String("type", event.Type), "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// List returns the events matching filter, newest first.
+func (s *Service) List(ctx context.Context, filter models.AuditFilter) ([]models.AuditEvent, error) {
+	const op = "audit.List"
+
+	log := s.log.With(slog.String("op", op))
+	log.Info("list audit events attempt")
+
+	events, err := s.store.ListAuditEvents(ctx, filter)
+	if err != nil {
+		log.Error("failed to list audit events", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return events, nil
+}
+
+// Verify walks the whole chain and reports the first event that was altered
+// or whose predecessor was removed. Removing events from the end of the log
+// can't be detected by the chain alone.
+func (s *Service) Verify(ctx context.Context) (*models.AuditVerification, error) {
+	const op = "audit.Verify"
+
+	log := s.log.With(slog.String("op", op))
+	log.Info("verify audit log attempt")
+
+	result := &models.AuditVerification{Valid: true}
+
+	var lastID int64
+	var prevHash string
+	for {
+		events, err := s.store.AuditEventsAfter(ctx, lastID, verifyBatchSize)
+		if err != nil {
+			log.Error("failed to load audit events", "err", err)
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for i := range events {
+			event := &events[i]
+			result.Checked++
+
+			if event.PrevHash != prevHash || Hash(event) != event.Hash {
+				log.Warn("audit log chain broken", slog.Int64("eventID", event.ID))
+				result.Valid = false
+				result.BrokenAt = &event.ID
+				return result, nil
+			}
+
+			prevHash = event.Hash
+			lastID = event.ID
+		}
+
+		if len(events) < verifyBatchSize {
+			break
+		}
+	}
+
+	log.Info("audit log verified", slog.Int("checked", result.Checked))
+	return result, nil
+}
+
+// Hash returns the hex SHA-256 of the event's fields and PrevHash. ID and
+// Hash itself are left out.
+func Hash(event *models.AuditEvent) string {
+	// a fixed struct keeps the field order, and so the hash, stable
+	canonical, _ := json.Marshal(struct {
+		PrevHash  string `json:"prev_hash"`
+		Type      string `json:"type"`
+		Outcome   string `json:"outcome"`
+		ActorID   *int64 `json:"actor_id"`
+		TargetID  *int64 `json:"target_id"`
+		IP        string `json:"ip"`
+		UserAgent string `json:"user_agent"`
+		Details   string `json:"details"`
+		CreatedAt string `json:"created_at"`
+	}{
+		PrevHash:  event.PrevHash,
+		Type:      event.Type,
+		Outcome:   event.Outcome,
+		ActorID:   event.ActorID,
+		TargetID:  event.TargetID,
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		Details:   event.Details,
+		CreatedAt: event.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+)
+
+// ChangePassword replaces the user's password after checking the current one
+// and logs out every other session. Wrong current passwords count towards the
+// account lockout like failed logins.
+func (a *Auth) ChangePassword(ctx context.Context, user *models.User, sessionID, currentPassword, newPassword string,
+	client models.ClientInfo,
+) (err error) {
+	const op = "auth.ChangePassword"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID))
+	log.Info("change password attempt")
+
+	defer a.audit(ctx, newAuditEvent(models.AuditPasswordChange, &user.ID, &user.ID, client, ""), &err)
+
+	if err := a.verifyCurrentPassword(ctx, log, user, currentPassword, client); err != nil {
+		return err
+	}
+
+	if err := a.checkPasswordPolicy(log, newPassword, user.Email); err != nil {
+		return err
+	}
+
+	passwordHashed, err := a.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.usrSaver.UpdatePasswordHash(ctx, user.ID, []byte(passwordHashed)); err != nil {
+		log.Error("failed to update password hash", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.sessionStore.RevokeOtherSessions(ctx, user.ID, sessionID); err != nil {
+		log.Error("failed to revoke other sessions", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password changed successfully")
+	return nil
+}
+
+// RequestEmailChange mails a confirmation link to the new address. The email
+// is only swapped once the link is opened, the old address gets a notice.
+func (a *Auth) RequestEmailChange(ctx context.Context, user *models.User, newEmail, currentPassword string,
+	client models.ClientInfo,
+) error {
+	const op = "auth.RequestEmailChange"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID))
+	log.Info("email change attempt")
+
+	if err := a.verifyCurrentPassword(ctx, log, user, currentPassword, client); err != nil {
+		return err
+	}
+
+	if strings.EqualFold(newEmail, user.Email) {
+		log.Warn("email change to the current address")
+		return ErrUserExists
+	}
+
+	_, err := a.userProvider.ProvideUser(ctx, newEmail)
+	if err == nil {
+		log.Warn("email change to a taken address")
+		return ErrUserExists
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		log.Error("failed to provide user", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	raw, err := token.NewOpaque()
+	if err != nil {
+		log.Error("failed to generate email change token", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	expiresAt := time.Now().Add(a.cfg.EmailVerificationTTL)
+	if err := a.emailStore.SaveEmailChangeToken(ctx, user.ID, newEmail, token.Hash(raw), expiresAt); err != nil {
+		log.Error("failed to save email change token", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	link := a.cfg.PublicURL + "/email/confirm?token=" + url.QueryEscape(raw)
+	body := fmt.Sprintf("Confirm %s as the new email address of your account by opening %s\n\n"+
+		"The link expires at %s.",
+		newEmail, link, expiresAt.UTC().Format(time.RFC1123))
+
+	if err := a.mailer.Send(ctx, newEmail, "Confirm your new email", body); err != nil {
+		log.Error("failed to send email change confirmation", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	notice := fmt.Sprintf("A change of your account email to %s was requested. "+
+		"If it wasn't you, change your password.", newEmail)
+	if err := a.mailer.Send(ctx, user.Email, "Email change requested", notice); err != nil {
+		log.Warn("failed to notify the current address", "err", err)
+	}
+
+	log.Info("email change confirmation sent")
+	return nil
+}
+
+// ConfirmEmailChange swaps the email using a token from RequestEmailChange and
+// logs the user out of every session.
+func (a *Auth) ConfirmEmailChange(ctx context.Context, changeToken string, client models.ClientInfo) (err error) {
+	const op = "auth.ConfirmEmailChange"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("email change confirmation attempt")
+
+	// the link is opened without a login, the user is only known once the
+	// token is burnt
+	event := newAuditEvent(models.AuditEmailChange, nil, nil, client, "")
+	defer a.audit(ctx, event, &err)
+
+	userID, err := a.emailStore.ChangeEmail(ctx, token.Hash(changeToken))
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("invalid email change token")
+			return ErrInvalidToken
+		}
+		if errors.Is(err, ErrUserExists) {
+			log.Warn("email was taken before confirmation")
+			return ErrUserExists
+		}
+		log.Error("failed to change email", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	event.ActorID, event.TargetID = &userID, &userID
+
+	if err := a.RevokeAllSessions(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email changed successfully", slog.Int64("userID", userID))
+	return nil
+}
+
+func (a *Auth) verifyCurrentPassword(ctx context.Context, log *slog.Logger, user *models.User, currentPassword string,
+	client models.ClientInfo,
+) error {
+	attemptKeys := a.attemptKeys(user.Email, client.IP)
+	if err := a.checkLockout(ctx, attemptKeys); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			log.Warn("password check while locked out")
+			return err
+		}
+		log.Error("failed to check lockout", "err", err)
+		return fmt.Errorf("auth.verifyCurrentPassword: %w", err)
+	}
+
+	var ok bool
+	if user.PasswordHashed != "" {
+		var err error
+		ok, err = a.hasher.Verify(user.PasswordHashed, currentPassword)
+		if err != nil {
+			log.Error("failed to verify password hash", "err", err)
+		}
+	}
+	if !ok {
+		log.Warn("invalid current password")
+		a.registerFailure(ctx, log, attemptKeys)
+		return ErrInvalidCredentials
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+)
+
+// APIKeyPrefix starts every API key, which tells keys apart from JWTs.
+const APIKeyPrefix = "wak_"
+
+// IsAPIKey reports whether a bearer credential looks like an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// CreateAPIKey issues a key acting as the user within scopes. Keys have the
+// form wak_<id>_<secret>: the short id part is kept in clear to recognise the
+// key later, the whole key is stored only as a hash.
+func (a *Auth) CreateAPIKey(ctx context.Context, userID int64, name string, scopes []string, expiresAt *time.Time,
+	client models.ClientInfo,
+) (_ *models.NewAPIKey, err error) {
+	const op = "auth.CreateAPIKey"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+	log.Info("create api key attempt")
+
+	event := newAuditEvent(models.AuditAPIKeyCreate, &userID, &userID, client, "")
+	defer a.audit(ctx, event, &err)
+
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, fmt.Errorf("%w: name must be 1 to 100 characters long", ErrInvalidAPIKey)
+	}
+
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPIKey)
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(models.Permissions, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidAPIKey, scope)
+		}
+	}
+	slices.Sort(scopes)
+	scopes = slices.Compact(scopes)
+
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: expiry must be in the future", ErrInvalidAPIKey)
+	}
+
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		log.Error("failed to generate api key id", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	secret, err := token.NewOpaque()
+	if err != nil {
+		log.Error("failed to generate api key secret", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	prefix := APIKeyPrefix + hex.EncodeToString(id)
+	raw := prefix + "_" + secret
+
+	key := models.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := a.apiKeyStore.SaveAPIKey(ctx, &key, token.Hash(raw)); err != nil {
+		log.Error("failed to save api key", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	event.Details = "key: " + key.ID
+	log.Info("api key created", slog.String("keyID", key.ID))
+
+	return &models.NewAPIKey{APIKey: key, Key: raw}, nil
+}
+
+func (a *Auth) ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error) {
+	const op = "auth.ListAPIKeys"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("list api keys attempt", slog.Int64("userID", userID))
+
+	keys, err := a.apiKeyStore.ListAPIKeys(ctx, userID)
+	if err != nil {
+		log.Error("failed to list api keys", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return keys, nil
+}
+
+func (a *Auth) RevokeAPIKey(ctx context.Context, userID int64, keyID string, client models.ClientInfo) (err error) {
+	const op = "auth.RevokeAPIKey"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("revoke api key attempt", slog.Int64("userID", userID), slog.String("keyID", keyID))
+
+	defer a.audit(ctx, newAuditEvent(models.AuditAPIKeyRevoke, &userID, &userID, client, "key: "+keyID), &err)
+
+	if err := a.apiKeyStore.RevokeAPIKey(ctx, userID, keyID); err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			log.Warn("api key not found", slog.Int64("userID", userID))
+			return ErrAPIKeyNotFound
+		}
+		log.Error("failed to revoke api key", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("api key revoked", slog.Int64("userID", userID))
+	return nil
+}
+
+// AuthenticateAPIKey loads the owner of an API key. The returned user carries
+// the key, so Authorize limits it to the key's scopes.
+func (a *Auth) AuthenticateAPIKey(ctx context.Context, rawKey string) (*models.User, error) {
+	const op = "auth.AuthenticateAPIKey"
+
+	log := a.log.With(slog.String("op", op))
+
+	key, err := a.apiKeyStore.APIKeyByHash(ctx, token.Hash(rawKey))
+	if err != nil {
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			log.Warn("unknown api key presented")
+			return nil, ErrInvalidToken
+		}
+		log.Error("failed to get api key", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.String("keyID", key.ID), slog.Int64("userID", key.UserID))
+
+	if !key.Active(time.Now()) {
+		log.Warn("revoked or expired api key presented")
+		return nil, ErrInvalidToken
+	}
+
+	user, err := a.userProvider.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidToken
+		}
+		log.Error("failed to get user", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !user.IsActive {
+		log.Warn("api key of blocked user presented")
+		return nil, ErrUserBlocked
+	}
+
+	user.Roles, err = a.roleStore.UserRoles(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get user roles", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user.APIKey = key
+
+	if err := a.apiKeyStore.TouchAPIKey(ctx, key.ID); err != nil {
+		log.Warn("failed to touch api key", "err", err)
+	}
+
+	return user, nil
+}
+
+// checkScope returns ErrForbidden if the request is made with an API key
+// lacking permission in its scopes.
+func checkScope(user *models.User, permission string) error {
+	if user.APIKey != nil && !slices.Contains(user.APIKey.Scopes, permission) {
+		return ErrForbidden
+	}
+	return nil
+}
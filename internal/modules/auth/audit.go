@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+
+	"web_auth/internal/models"
+)
+
+// AuditLog keeps the security audit trail.
+type AuditLog interface {
+	Record(ctx context.Context, event *models.AuditEvent) error
+}
+
+func newAuditEvent(eventType string, actorID, targetID *int64, client models.ClientInfo, details string,
+) *models.AuditEvent {
+	return &models.AuditEvent{
+		Type:      eventType,
+		ActorID:   actorID,
+		TargetID:  targetID,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Details:   details,
+	}
+}
+
+// audit records event with the outcome of *errp. It is meant to be deferred
+// right after the event is created, so every return is covered; fields
+// learned later, like the target of a login, can still be filled in. A
+// failed write is logged but doesn't fail the audited operation.
+func (a *Auth) audit(ctx context.Context, event *models.AuditEvent, errp *error) {
+	event.Outcome = models.AuditOutcomeSuccess
+	if *errp != nil {
+		event.Outcome = models.AuditOutcomeFailure
+		if event.Details != "" {
+			event.Details += ": "
+		}
+		event.Details += (*errp).Error()
+	}
+
+	// a client hanging up must not lose the trail of what it did
+	if err := a.auditLog.Record(context.WithoutCancel(ctx), event); err != nil {
+		a.log.Error("failed to record audit event", slog.String("type", event.Type), "err", err)
+	}
+}
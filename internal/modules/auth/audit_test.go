@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"web_auth/internal/models"
+)
+
+func TestAccountChangesAudited(t *testing.T) {
+	client := models.ClientInfo{IP: "203.0.113.5", UserAgent: "test"}
+
+	for _, tc := range []struct {
+		name        string
+		eventType   string
+		do          func(a *Auth, userID int64) error
+		wantOutcome string
+		wantDetails string
+	}{
+		{
+			name:      "session revoked",
+			eventType: models.AuditSessionRevoke,
+			do: func(a *Auth, userID int64) error {
+				return a.RevokeSession(context.Background(), userID, "lost-phone", client)
+			},
+			wantOutcome: models.AuditOutcomeSuccess,
+			wantDetails: "session: lost-phone",
+		},
+		{
+			name:      "other sessions revoked",
+			eventType: models.AuditSessionRevokeOthers,
+			do: func(a *Auth, userID int64) error {
+				return a.RevokeOtherSessions(context.Background(), userID, "this-laptop", client)
+			},
+			wantOutcome: models.AuditOutcomeSuccess,
+			wantDetails: "kept session: this-laptop",
+		},
+		{
+			name:      "second factor disabled without one enabled",
+			eventType: models.AuditTOTPDisable,
+			do: func(a *Auth, userID int64) error {
+				return a.DisableTOTP(context.Background(), userID, "123456", client)
+			},
+			wantOutcome: models.AuditOutcomeFailure,
+			wantDetails: ErrTOTPNotEnabled.Error(),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			user := store.addUser("alice@example.com")
+			store.sessions["lost-phone"] = &models.Session{ID: "lost-phone", UserID: user.ID}
+			a := newTestAuth(t, store)
+
+			_ = tc.do(a, user.ID)
+
+			event, ok := store.lastEvent(tc.eventType)
+			if !ok {
+				t.Fatalf("no %s event recorded", tc.eventType)
+			}
+			if event.Outcome != tc.wantOutcome {
+				t.Errorf("outcome = %q, want %q", event.Outcome, tc.wantOutcome)
+			}
+			if event.ActorID == nil || *event.ActorID != user.ID || event.TargetID == nil || *event.TargetID != user.ID {
+				t.Errorf("actor = %v, target = %v, want both %d", event.ActorID, event.TargetID, user.ID)
+			}
+			if event.IP != client.IP || !strings.Contains(event.Details, tc.wantDetails) {
+				t.Errorf("ip = %q, details = %q, want %q and %q", event.IP, event.Details, client.IP, tc.wantDetails)
+			}
+		})
+	}
+}
@@ -5,27 +5,87 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"web_auth/internal/config"
 	"web_auth/internal/models"
+	"web_auth/internal/utils/password"
+	"web_auth/internal/utils/token"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/go-webauthn/webauthn/webauthn"
 )
 
 var (
-	ErrUserExists         = errors.New("user already exists")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrUserExists          = errors.New("user already exists")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrInvalidCredentials  = errors.New("invalid email or password")
+	ErrUserBlocked         = errors.New("user is blocked")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrForbidden           = errors.New("permission denied")
+	ErrSessionNotFound     = errors.New("session not found")
+	ErrTOTPAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrInvalidOTP          = errors.New("invalid one-time code")
+	ErrMFARequired         = errors.New("two-factor authentication must be enabled for this operation")
+	ErrCredentialExists    = errors.New("credential already registered")
+	ErrWebAuthnFailed      = errors.New("passkey verification failed")
+	ErrEmailNotVerified    = errors.New("email is not verified")
+	ErrTooManyAttempts     = errors.New("too many failed login attempts")
+	ErrWeakPassword        = errors.New("password does not meet the policy")
+	ErrGuestNotFound       = errors.New("guest not found")
+	ErrAPIKeyNotFound      = errors.New("api key not found")
+	ErrInvalidAPIKey       = errors.New("invalid api key request")
+	ErrProviderNotFound    = errors.New("identity provider not found")
+	ErrFederationFailed    = errors.New("sign in with identity provider failed")
+	ErrIdentityNotFound    = errors.New("identity not found")
+	ErrIdentityLinkRefused = errors.New("identity can't be linked to the account with this email")
+	ErrLastSignInMethod    = errors.New("can't remove the only sign in method")
+	ErrImpersonating       = errors.New("not allowed while impersonating")
+	ErrNotImpersonating    = errors.New("session is not impersonating")
 )
 
+const tokenTypeBearer = "Bearer"
+
 type Auth struct {
-	log          *slog.Logger
-	usrSaver     UserSaver
-	userProvider UserProvider
+	log           *slog.Logger
+	cfg           config.Auth
+	usrSaver      UserSaver
+	userProvider  UserProvider
+	tokenManager  TokenManager
+	tokenStore    TokenStore
+	roleStore     RoleStore
+	sessionStore  SessionStore
+	totpStore     TOTPStore
+	passkeys      *webauthn.WebAuthn
+	webAuthnStore WebAuthnStore
+	resetStore    PasswordResetStore
+	emailStore    EmailVerificationStore
+	guestStore    GuestStore
+	apiKeyStore   APIKeyStore
+	attemptStore  AttemptStore
+	hasher        PasswordHasher
+	policy        PasswordPolicy
+	mailer        Mailer
+
+	federationStore FederationStore
+	directoryStore  DirectoryStore
+	magicLinkStore  MagicLinkStore
+	auditLog        AuditLog
+	loginHistory    LoginHistoryStore
+	// loginNotifier is nil if new login alerts are off.
+	loginNotifier LoginNotifier
+	// directories are keyed by lowercased email domain
+	directories       map[string]Directory
+	identityProviders map[string]IdentityProvider
 }
 
 type UserSaver interface {
+	// SaveUser creates a user with the default role.
 	SaveUser(ctx context.Context, email string, passHash []byte) (uid int64, err error)
-	BlockUserByID(ctx context.Context, userID int64) error
+	UpdatePasswordHash(ctx context.Context, userID int64, passHash []byte) error
+	BlockUserByID(ctx context.Context, userID int64, reason string) error
+	UnblockUserByID(ctx context.Context, userID int64) error
 }
 
 type UserProvider interface {
@@ -34,18 +94,183 @@ type UserProvider interface {
 	ListUsers(ctx context.Context, limit, offset int) ([]models.User, error)
 }
 
-func New(log *slog.Logger,
-	userSaver UserSaver,
-	userProvider UserProvider,
-) *Auth {
+type TokenStore interface {
+	RefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldID int64, next *models.RefreshToken) error
+	RevokeTokenFamily(ctx context.Context, familyID string) error
+}
+
+type RoleStore interface {
+	AssignRole(ctx context.Context, userID int64, role string) error
+	UserRoles(ctx context.Context, userID int64) ([]string, error)
+	UserPermissions(ctx context.Context, userID int64) ([]string, error)
+}
+
+type SessionStore interface {
+	CreateSession(ctx context.Context, session *models.Session, refresh *models.RefreshToken) error
+	SessionByID(ctx context.Context, sessionID string) (*models.Session, error)
+	TouchSession(ctx context.Context, sessionID string) error
+	ListUserSessions(ctx context.Context, userID int64) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID int64, sessionID string) error
+	RevokeUserSessions(ctx context.Context, userID int64) error
+	RevokeOtherSessions(ctx context.Context, userID int64, keepID string) error
+}
+
+type TOTPStore interface {
+	SaveTOTPSecret(ctx context.Context, userID int64, secret string) error
+	TOTPByUserID(ctx context.Context, userID int64) (*models.TOTP, error)
+	UseTOTPStep(ctx context.Context, userID, step int64) error
+	ConfirmTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error
+	DeleteTOTP(ctx context.Context, userID int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash string) error
+}
+
+type WebAuthnStore interface {
+	SaveWebAuthnCeremony(ctx context.Context, kind string, userID int64, sessionData []byte, expiresAt time.Time) (string, error)
+	TakeWebAuthnCeremony(ctx context.Context, kind, ceremonyID string) (userID int64, sessionData []byte, err error)
+	SaveWebAuthnCredential(ctx context.Context, userID int64, credential *webauthn.Credential) error
+	WebAuthnCredentials(ctx context.Context, userID int64) ([]webauthn.Credential, error)
+	UpdateWebAuthnCredential(ctx context.Context, credential *webauthn.Credential) error
+}
+
+type PasswordResetStore interface {
+	SavePasswordResetToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	// PasswordResetUser returns the owner of a live reset token without
+	// using it up.
+	PasswordResetUser(ctx context.Context, tokenHash string) (userID int64, err error)
+	ResetPassword(ctx context.Context, tokenHash string, passHash []byte) (userID int64, err error)
+}
+
+type EmailVerificationStore interface {
+	SaveEmailVerificationToken(ctx context.Context, userID int64, tokenHash string, expiresAt time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash string) (userID int64, err error)
+	SaveEmailChangeToken(ctx context.Context, userID int64, newEmail, tokenHash string, expiresAt time.Time) error
+	ChangeEmail(ctx context.Context, tokenHash string) (userID int64, err error)
+}
+
+type GuestStore interface {
+	CreateGuest(ctx context.Context) (*models.Guest, error)
+	GuestByIdentifier(ctx context.Context, identifier string) (*models.Guest, error)
+	// SaveUserFromGuest creates a user with the default role and moves the
+	// guest's data to it, all or nothing.
+	SaveUserFromGuest(ctx context.Context, email string, passHash []byte, identifier string) (uid int64, err error)
+}
+
+type APIKeyStore interface {
+	SaveAPIKey(ctx context.Context, key *models.APIKey, keyHash string) error
+	APIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID int64) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID int64, keyID string) error
+	TouchAPIKey(ctx context.Context, keyID string) error
+}
+
+// AttemptStore counts failed logins per key. Durations are used instead of
+// deadlines so the store can rely on its own clock.
+type AttemptStore interface {
+	// AttemptLockout returns how long the key stays locked, zero if it isn't.
+	AttemptLockout(ctx context.Context, key string) (time.Duration, error)
+	// RecordFailedAttempt increments the key's failures, starting over if the
+	// key has been quiet for window, and returns the new count.
+	RecordFailedAttempt(ctx context.Context, key string, window time.Duration) (int, error)
+	LockAttempts(ctx context.Context, key string, d time.Duration) error
+	ResetAttempts(ctx context.Context, key string) error
+}
+
+// PasswordHasher hashes passwords with the current algorithm and verifies
+// hashes produced by any algorithm it ever used.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// PasswordPolicy validates new passwords. email may be empty if the owner
+// isn't known.
+type PasswordPolicy interface {
+	Check(password, email string) ([]password.Violation, error)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type TokenManager interface {
+	NewAccessToken(user *models.User, session *models.Session) (token string, expiresAt time.Time, err error)
+	NewRefreshToken() (raw, hash string, expiresAt time.Time, err error)
+	NewScopedToken(subject, audience string, ttl time.Duration) (token string, expiresAt time.Time, err error)
+	Parse(token string) (*token.Claims, error)
+	ParseScoped(token, audience string) (*token.Claims, error)
+}
+
+// Deps are the collaborators of Auth. In production most of the stores are
+// the same storage, the fields keep which role it plays readable.
+type Deps struct {
+	UserSaver     UserSaver
+	UserProvider  UserProvider
+	TokenManager  TokenManager
+	TokenStore    TokenStore
+	RoleStore     RoleStore
+	SessionStore  SessionStore
+	TOTPStore     TOTPStore
+	Passkeys      *webauthn.WebAuthn
+	WebAuthnStore WebAuthnStore
+	ResetStore    PasswordResetStore
+	EmailStore    EmailVerificationStore
+	GuestStore    GuestStore
+	APIKeyStore   APIKeyStore
+	AttemptStore  AttemptStore
+	Hasher        PasswordHasher
+	Policy        PasswordPolicy
+	Mailer        Mailer
+
+	FederationStore FederationStore
+	DirectoryStore  DirectoryStore
+	MagicLinkStore  MagicLinkStore
+	AuditLog        AuditLog
+	LoginHistory    LoginHistoryStore
+	// LoginNotifier is nil if new login alerts are off.
+	LoginNotifier LoginNotifier
+	// Directories are keyed by lowercased email domain.
+	Directories       map[string]Directory
+	IdentityProviders map[string]IdentityProvider
+}
+
+func New(log *slog.Logger, cfg config.Auth, deps Deps) *Auth {
 	return &Auth{
-		usrSaver:     userSaver,
-		userProvider: userProvider,
-		log:          log,
+		log:           log,
+		cfg:           cfg,
+		usrSaver:      deps.UserSaver,
+		userProvider:  deps.UserProvider,
+		tokenManager:  deps.TokenManager,
+		tokenStore:    deps.TokenStore,
+		roleStore:     deps.RoleStore,
+		sessionStore:  deps.SessionStore,
+		totpStore:     deps.TOTPStore,
+		passkeys:      deps.Passkeys,
+		webAuthnStore: deps.WebAuthnStore,
+		resetStore:    deps.ResetStore,
+		emailStore:    deps.EmailStore,
+		guestStore:    deps.GuestStore,
+		apiKeyStore:   deps.APIKeyStore,
+		attemptStore:  deps.AttemptStore,
+		hasher:        deps.Hasher,
+		policy:        deps.Policy,
+		mailer:        deps.Mailer,
+
+		federationStore:   deps.FederationStore,
+		directoryStore:    deps.DirectoryStore,
+		magicLinkStore:    deps.MagicLinkStore,
+		auditLog:          deps.AuditLog,
+		loginHistory:      deps.LoginHistory,
+		loginNotifier:     deps.LoginNotifier,
+		directories:       deps.Directories,
+		identityProviders: deps.IdentityProviders,
 	}
 }
 
-func (a *Auth) RegisterNewUser(ctx context.Context, password, email string,
+// RegisterNewUser creates an account. If guestToken is set, the guest's data
+// is merged into the new account and the guest identity stops working.
+func (a *Auth) RegisterNewUser(ctx context.Context, password, email, guestToken string, client models.ClientInfo,
 ) (userID int64, err error) {
 	const op = "auth.RegisterNewUser"
 
@@ -53,69 +278,199 @@ func (a *Auth) RegisterNewUser(ctx context.Context, password, email string,
 
 	log.Info("register new user")
 
-	passwordHashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	event := newAuditEvent(models.AuditUserRegister, nil, nil, client, "email: "+email)
+	defer a.audit(ctx, event, &err)
+
+	var guestID string
+	if guestToken != "" {
+		guestID, err = a.parseGuestToken(guestToken)
+		if err != nil {
+			log.Warn("invalid guest token", "err", err)
+			return 0, ErrInvalidToken
+		}
+	}
+
+	if err := a.checkPasswordPolicy(log, password, email); err != nil {
+		return 0, err
+	}
+
+	passwordHashed, err := a.hasher.Hash(password)
 	if err != nil {
-		log.Error("failed to generate password hash", err)
+		log.Error("failed to generate password hash", "err", err)
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
-	id, err := a.usrSaver.SaveUser(ctx, email, passwordHashed)
+	var id int64
+	if guestID != "" {
+		id, err = a.guestStore.SaveUserFromGuest(ctx, email, []byte(passwordHashed), guestID)
+	} else {
+		id, err = a.usrSaver.SaveUser(ctx, email, []byte(passwordHashed))
+	}
 	if err != nil {
 		if errors.Is(err, ErrUserExists) {
-			log.Warn("user already exists", err)
+			log.Warn("user already exists", "err", err)
 			return 0, ErrUserExists
 		}
-		log.Error("failed to save user", err)
+		if errors.Is(err, ErrGuestNotFound) {
+			log.Warn("guest not found or already merged")
+			return 0, ErrInvalidToken
+		}
+		log.Error("failed to save user", "err", err)
 		return 0, fmt.Errorf("%s: %w", op, err)
 	}
 
+	event.ActorID, event.TargetID = &id, &id
+
+	// The account exists at this point, a lost email can be resent later.
+	if err := a.sendVerificationEmail(ctx, id, email); err != nil {
+		log.Error("failed to send verification email", "err", err)
+	}
+
 	log.Info("user successfully register")
 
 	return id, nil
 }
 
-func (a *Auth) Login(ctx context.Context, email, password string,
-) error {
+// Login checks the user's password, against the LDAP directory serving the
+// email's domain if there is one. If the account has a second factor
+// enabled no tokens are issued yet; instead a challenge is returned that has
+// to be completed with CompleteMFALogin.
+func (a *Auth) Login(ctx context.Context, email, password string, client models.ClientInfo,
+) (tokens *models.Token, challenge *models.MFAChallenge, err error) {
 	const op = "auth.Login"
 
 	log := a.log.With(slog.String("op", op))
 
 	log.Info("login attempt")
 
-	user, err := a.userProvider.ProvideUser(ctx, email)
+	event := newAuditEvent(models.AuditUserLogin, nil, nil, client, "method: password, email: "+email)
+	defer a.audit(ctx, event, &err)
+
+	var user *models.User
+	method := models.LoginMethodPassword
+	defer func() { a.recordLogin(ctx, user, method, client, challenge, err) }()
+
+	attemptKeys := a.attemptKeys(email, client.IP)
+	if err := a.checkLockout(ctx, attemptKeys); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			log.Warn("login attempt while locked out")
+			return nil, nil, err
+		}
+		log.Error("failed to check lockout", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if directory, ok := a.directoryFor(email); ok {
+		method = models.LoginMethodLDAP
+		event.Details = "method: ldap, email: " + email
+		user, err = a.directoryLogin(ctx, log, directory, email, password)
+		if errors.Is(err, ErrInvalidCredentials) {
+			a.registerFailure(ctx, log, attemptKeys)
+		}
+	} else {
+		user, err = a.passwordLogin(ctx, log, email, password, attemptKeys)
+	}
 	if err != nil {
-		log.Error("failed to provide user", err)
-		return fmt.Errorf("%s: %w", op, err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if user.ID == 0 {
-		log.Error("user not found", ErrUserNotFound)
-		return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+	event.ActorID, event.TargetID = &user.ID, &user.ID
+
+	if err := a.checkCanLogin(user); err != nil {
+		log.Warn("login refused", slog.Int64("userID", user.ID), "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHashed), []byte(password)); err != nil {
-		a.log.Warn("invalid credentials", ErrInvalidCredentials)
-		return fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+	mfaEnabled, err := a.TOTPEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to check second factor", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	log.Info("user logged in success")
+	if mfaEnabled {
+		challenge, err := a.newMFAChallenge(user)
+		if err != nil {
+			log.Error("failed to issue mfa challenge", "err", err)
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
 
-	return nil
+		// Failures are kept until the second factor succeeds, so knowing the
+		// password doesn't give unlimited OTP guesses.
+		log.Info("second factor required", slog.Int64("userID", user.ID))
+		event.Details += ", second factor required"
+		return nil, challenge, nil
+	}
+
+	tokens, err = a.issueTokens(ctx, user, client)
+	if err != nil {
+		log.Error("failed to issue tokens", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.resetAttempts(ctx, log, user.Email)
+
+	log.Info("user logged in success", slog.Int64("userID", user.ID))
+
+	return tokens, nil, nil
+}
+
+// passwordLogin checks the password against the local hash. On a wrong
+// password the user is returned along with ErrInvalidCredentials, so the
+// attempt lands in the user's login history.
+func (a *Auth) passwordLogin(ctx context.Context, log *slog.Logger, email, password string, attemptKeys []attemptKey,
+) (*models.User, error) {
+	user, err := a.userProvider.ProvideUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("user not found")
+			// Unknown emails are counted too, otherwise the lockout would
+			// reveal which accounts exist.
+			a.registerFailure(ctx, log, attemptKeys)
+			return nil, ErrInvalidCredentials
+		}
+		log.Error("failed to provide user", "err", err)
+		return nil, err
+	}
+
+	var ok bool
+	// accounts created through an identity provider have no password
+	if user.PasswordHashed != "" {
+		ok, err = a.hasher.Verify(user.PasswordHashed, password)
+		if err != nil {
+			log.Error("failed to verify password hash", slog.Int64("userID", user.ID), "err", err)
+		}
+	}
+	if !ok {
+		a.log.Warn("invalid credentials", "err", ErrInvalidCredentials)
+		a.registerFailure(ctx, log, attemptKeys)
+		return user, ErrInvalidCredentials
+	}
+
+	a.rehashPassword(ctx, log, user, password)
+
+	return user, nil
 }
 
-func (a *Auth) BlockUser(ctx context.Context, userID int64) error {
+func (a *Auth) BlockUser(ctx context.Context, actorID, userID int64, reason string, client models.ClientInfo,
+) (err error) {
 	const op = "auth.BlockUser"
 
 	log := a.log.With(slog.String("op", op))
-	log.Info("block user attempt", slog.Int64("userID", userID))
+	log.Info("block user attempt", slog.Int64("userID", userID), slog.String("reason", reason))
 
-	err := a.usrSaver.BlockUserByID(ctx, userID)
+	defer a.audit(ctx, newAuditEvent(models.AuditUserBlock, &actorID, &userID, client, reason), &err)
+
+	err = a.usrSaver.BlockUserByID(ctx, userID, reason)
 	if err != nil {
 		if errors.Is(err, ErrUserNotFound) {
 			log.Warn("user not found for blocking", slog.Int64("userID", userID))
 			return ErrUserNotFound
 		}
-		log.Error("failed to block user", err)
+		log.Error("failed to block user", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.RevokeAllSessions(ctx, userID); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -123,6 +478,28 @@ func (a *Auth) BlockUser(ctx context.Context, userID int64) error {
 	return nil
 }
 
+func (a *Auth) UnblockUser(ctx context.Context, actorID, userID int64, client models.ClientInfo) (err error) {
+	const op = "auth.UnblockUser"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("unblock user attempt", slog.Int64("userID", userID))
+
+	defer a.audit(ctx, newAuditEvent(models.AuditUserUnblock, &actorID, &userID, client, ""), &err)
+
+	err = a.usrSaver.UnblockUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("user not found for unblocking", slog.Int64("userID", userID))
+			return ErrUserNotFound
+		}
+		log.Error("failed to unblock user", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user unblocked successfully", slog.Int64("userID", userID))
+	return nil
+}
+
 func (a *Auth) GetUser(ctx context.Context, userID int64) (*models.User, error) {
 	const op = "auth.GetUser"
 
@@ -135,7 +512,7 @@ func (a *Auth) GetUser(ctx context.Context, userID int64) (*models.User, error)
 			log.Warn("user not found", slog.Int64("userID", userID))
 			return nil, ErrUserNotFound
 		}
-		log.Error("failed to get user", err)
+		log.Error("failed to get user", "err", err)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
@@ -151,10 +528,46 @@ func (a *Auth) ListUsers(ctx context.Context, limit, offset int) ([]models.User,
 
 	users, err := a.userProvider.ListUsers(ctx, limit, offset)
 	if err != nil {
-		log.Error("failed to list users", err)
+		log.Error("failed to list users", "err", err)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	log.Info("users listed successfully", slog.Int("count", len(users)))
 	return users, nil
 }
+
+// checkCanLogin rejects blocked users and, if required by config, users who
+// haven't verified their email.
+func (a *Auth) checkCanLogin(user *models.User) error {
+	if !user.IsActive {
+		return ErrUserBlocked
+	}
+
+	if a.cfg.RequireVerifiedEmail && user.EmailVerifiedAt == nil {
+		return ErrEmailNotVerified
+	}
+
+	return nil
+}
+
+// rehashPassword upgrades a verified password's stored hash to the current
+// algorithm and parameters. Failures only cost the upgrade, not the login.
+func (a *Auth) rehashPassword(ctx context.Context, log *slog.Logger, user *models.User, password string) {
+	if !a.hasher.NeedsRehash(user.PasswordHashed) {
+		return
+	}
+
+	passwordHashed, err := a.hasher.Hash(password)
+	if err != nil {
+		log.Error("failed to generate password hash", "err", err)
+		return
+	}
+
+	if err := a.usrSaver.UpdatePasswordHash(ctx, user.ID, []byte(passwordHashed)); err != nil {
+		log.Error("failed to update password hash", "err", err)
+		return
+	}
+
+	user.PasswordHashed = passwordHashed
+	log.Info("password hash upgraded", slog.Int64("userID", user.ID))
+}
@@ -0,0 +1,629 @@
+package auth
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// memStore keeps everything the tests need in memory. It implements the
+// store interfaces of Auth the tests touch.
+type memStore struct {
+	mu sync.Mutex
+
+	users       map[int64]*models.User
+	roles       map[int64][]string
+	sessions    map[string]*models.Session
+	refresh     []*models.RefreshToken
+	totp        map[int64]*models.TOTP
+	recovery    map[int64]map[string]bool
+	resets      map[string]int64
+	ceremonies  map[string]memCeremony
+	credentials map[int64][]webauthn.Credential
+	logins      []models.LoginAttempt
+	events      []models.AuditEvent
+	nextID      int64
+
+	federatedLogins map[string]*models.FederatedLogin
+	identities      []models.FederatedIdentity
+	attempts        map[string]int
+	// locked holds the remaining lockout per key, tests expire it by hand
+	locked map[string]time.Duration
+}
+
+type memCeremony struct {
+	kind   string
+	userID int64
+	data   []byte
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		users:       make(map[int64]*models.User),
+		roles:       make(map[int64][]string),
+		sessions:    make(map[string]*models.Session),
+		totp:        make(map[int64]*models.TOTP),
+		recovery:    make(map[int64]map[string]bool),
+		resets:      make(map[string]int64),
+		ceremonies:  make(map[string]memCeremony),
+		credentials: make(map[int64][]webauthn.Credential),
+
+		federatedLogins: make(map[string]*models.FederatedLogin),
+		attempts:        make(map[string]int),
+		locked:          make(map[string]time.Duration),
+	}
+}
+
+func (s *memStore) id() int64 {
+	s.nextID++
+	return s.nextID
+}
+
+func (s *memStore) addUser(email string) *models.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := &models.User{ID: s.id(), Email: email, IsActive: true, CreatedAt: time.Now()}
+	s.users[user.ID] = user
+	return user
+}
+
+func (s *memStore) ProvideUser(_ context.Context, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if strings.EqualFold(user.Email, email) {
+			u := *user
+			return &u, nil
+		}
+	}
+	return &models.User{}, ErrUserNotFound
+}
+
+func (s *memStore) GetUserByID(_ context.Context, userID int64) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (s *memStore) SavePasswordResetToken(_ context.Context, userID int64, tokenHash string, _ time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resets[tokenHash] = userID
+	return nil
+}
+
+func (s *memStore) PasswordResetUser(_ context.Context, tokenHash string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.resets[tokenHash]
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	return userID, nil
+}
+
+func (s *memStore) ResetPassword(_ context.Context, tokenHash string, passHash []byte) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userID, ok := s.resets[tokenHash]
+	if !ok {
+		return 0, ErrInvalidToken
+	}
+	delete(s.resets, tokenHash)
+	s.users[userID].PasswordHashed = string(passHash)
+	return userID, nil
+}
+
+func (s *memStore) ListUsers(context.Context, int, int) ([]models.User, error) {
+	return nil, nil
+}
+
+func (s *memStore) AssignRole(_ context.Context, userID int64, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roles[userID] = append(s.roles[userID], role)
+	return nil
+}
+
+func (s *memStore) UserRoles(_ context.Context, userID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.roles[userID]...), nil
+}
+
+func (s *memStore) UserPermissions(context.Context, int64) ([]string, error) {
+	return nil, nil
+}
+
+func (s *memStore) CreateSession(_ context.Context, session *models.Session, refresh *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.ID = "session-" + strconv.FormatInt(s.id(), 10)
+	s.sessions[session.ID] = session
+
+	refresh.FamilyID = session.ID
+	s.saveRefreshToken(refresh)
+	return nil
+}
+
+func (s *memStore) saveRefreshToken(refresh *models.RefreshToken) {
+	refresh.ID = s.id()
+	refresh.CreatedAt = time.Now()
+	stored := *refresh
+	s.refresh = append(s.refresh, &stored)
+}
+
+func (s *memStore) RefreshTokenByHash(_ context.Context, tokenHash string) (*models.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, refresh := range s.refresh {
+		if refresh.TokenHash == tokenHash {
+			stored := *refresh
+			return &stored, nil
+		}
+	}
+	return nil, ErrInvalidToken
+}
+
+func (s *memStore) RotateRefreshToken(_ context.Context, oldID int64, next *models.RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, refresh := range s.refresh {
+		if refresh.ID == oldID {
+			if refresh.RotatedAt != nil || refresh.RevokedAt != nil {
+				return ErrRefreshTokenReused
+			}
+			now := time.Now()
+			refresh.RotatedAt = &now
+			s.saveRefreshToken(next)
+			return nil
+		}
+	}
+	return ErrRefreshTokenReused
+}
+
+func (s *memStore) RevokeTokenFamily(_ context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeSessions(func(session *models.Session) bool { return session.ID == familyID })
+	return nil
+}
+
+// revokeSessions revokes the live sessions matching together with their
+// refresh tokens and returns how many there were.
+func (s *memStore) revokeSessions(match func(session *models.Session) bool) int {
+	now := time.Now()
+
+	revoked := 0
+	for _, session := range s.sessions {
+		if session.RevokedAt != nil || !match(session) {
+			continue
+		}
+		session.RevokedAt = &now
+		revoked++
+
+		for _, refresh := range s.refresh {
+			if refresh.FamilyID == session.ID && refresh.RevokedAt == nil {
+				refresh.RevokedAt = &now
+			}
+		}
+	}
+	return revoked
+}
+
+func (s *memStore) SessionByID(_ context.Context, sessionID string) (*models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, ok := s.sessions[sessionID]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (s *memStore) TouchSession(context.Context, string) error { return nil }
+
+func (s *memStore) ListUserSessions(context.Context, int64) ([]models.Session, error) {
+	return nil, nil
+}
+
+func (s *memStore) RevokeSession(_ context.Context, userID int64, sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revokeSessions(func(session *models.Session) bool {
+		return session.UserID == userID && session.ID == sessionID
+	}) == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *memStore) RevokeUserSessions(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeSessions(func(session *models.Session) bool { return session.UserID == userID })
+	return nil
+}
+
+func (s *memStore) RevokeOtherSessions(_ context.Context, userID int64, keepID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revokeSessions(func(session *models.Session) bool { return session.UserID == userID && session.ID != keepID })
+	return nil
+}
+
+func (s *memStore) SaveTOTPSecret(_ context.Context, userID int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.totp[userID]; ok && t.ConfirmedAt != nil {
+		return ErrTOTPAlreadyEnabled
+	}
+	s.totp[userID] = &models.TOTP{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (s *memStore) TOTPByUserID(_ context.Context, userID int64) (*models.TOTP, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok {
+		return nil, ErrTOTPNotEnabled
+	}
+	stored := *t
+	return &stored, nil
+}
+
+func (s *memStore) UseTOTPStep(_ context.Context, userID, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok || t.LastUsedStep >= step {
+		return ErrInvalidOTP
+	}
+	t.LastUsedStep = step
+	return nil
+}
+
+func (s *memStore) ConfirmTOTP(_ context.Context, userID int64, recoveryCodeHashes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.totp[userID]
+	if !ok || t.ConfirmedAt != nil {
+		return ErrTOTPAlreadyEnabled
+	}
+	now := time.Now()
+	t.ConfirmedAt = &now
+
+	s.recovery[userID] = make(map[string]bool)
+	for _, hash := range recoveryCodeHashes {
+		s.recovery[userID][hash] = false
+	}
+	return nil
+}
+
+func (s *memStore) DeleteTOTP(_ context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.totp, userID)
+	delete(s.recovery, userID)
+	return nil
+}
+
+func (s *memStore) UseRecoveryCode(_ context.Context, userID int64, codeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	used, ok := s.recovery[userID][codeHash]
+	if !ok || used {
+		return ErrInvalidOTP
+	}
+	s.recovery[userID][codeHash] = true
+	return nil
+}
+
+func (s *memStore) SaveWebAuthnCeremony(_ context.Context, kind string, userID int64, sessionData []byte,
+	_ time.Time,
+) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := "ceremony-" + strconv.FormatInt(s.id(), 10)
+	s.ceremonies[id] = memCeremony{kind: kind, userID: userID, data: sessionData}
+	return id, nil
+}
+
+func (s *memStore) TakeWebAuthnCeremony(_ context.Context, kind, ceremonyID string) (int64, []byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ceremony, ok := s.ceremonies[ceremonyID]
+	if !ok || ceremony.kind != kind {
+		return 0, nil, ErrInvalidToken
+	}
+	delete(s.ceremonies, ceremonyID)
+	return ceremony.userID, ceremony.data, nil
+}
+
+func (s *memStore) SaveWebAuthnCredential(_ context.Context, userID int64, credential *webauthn.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.credentials[userID] = append(s.credentials[userID], *credential)
+	return nil
+}
+
+func (s *memStore) WebAuthnCredentials(_ context.Context, userID int64) ([]webauthn.Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]webauthn.Credential(nil), s.credentials[userID]...), nil
+}
+
+func (s *memStore) UpdateWebAuthnCredential(_ context.Context, credential *webauthn.Credential) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for userID, credentials := range s.credentials {
+		for i := range credentials {
+			if string(credentials[i].ID) == string(credential.ID) {
+				s.credentials[userID][i] = *credential
+			}
+		}
+	}
+	return nil
+}
+
+func (s *memStore) SaveFederatedLogin(_ context.Context, stateHash string, login *models.FederatedLogin) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.federatedLogins[stateHash] = login
+	return nil
+}
+
+func (s *memStore) TakeFederatedLogin(_ context.Context, stateHash string) (*models.FederatedLogin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	login, ok := s.federatedLogins[stateHash]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	delete(s.federatedLogins, stateHash)
+	return login, nil
+}
+
+func (s *memStore) FederatedIdentity(_ context.Context, provider, subject string) (*models.FederatedIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, identity := range s.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, ErrIdentityNotFound
+}
+
+func (s *memStore) LinkFederatedIdentity(_ context.Context, identity *models.FederatedIdentity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, linked := range s.identities {
+		if linked.UserID == identity.UserID && linked.Provider == identity.Provider {
+			return ErrUserExists
+		}
+	}
+	s.identities = append(s.identities, *identity)
+	return nil
+}
+
+func (s *memStore) SaveFederatedUser(_ context.Context, identity *models.FederatedIdentity, emailVerified bool,
+) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := &models.User{ID: s.id(), Email: identity.Email, IsActive: true, CreatedAt: time.Now()}
+	if emailVerified {
+		user.EmailVerifiedAt = &user.CreatedAt
+	}
+	s.users[user.ID] = user
+	s.roles[user.ID] = []string{models.RoleUser}
+
+	linked := *identity
+	linked.UserID = user.ID
+	s.identities = append(s.identities, linked)
+	return user.ID, nil
+}
+
+func (s *memStore) TouchFederatedIdentity(context.Context, string, string) error { return nil }
+
+func (s *memStore) ListFederatedIdentities(_ context.Context, userID int64) ([]models.FederatedIdentity, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var identities []models.FederatedIdentity
+	for _, identity := range s.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (s *memStore) UnlinkFederatedIdentity(context.Context, int64, string) error { return nil }
+
+func (s *memStore) SaveDirectoryUser(_ context.Context, email string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user := &models.User{ID: s.id(), Email: email, IsActive: true, CreatedAt: time.Now()}
+	user.EmailVerifiedAt = &user.CreatedAt
+	s.users[user.ID] = user
+	s.roles[user.ID] = []string{models.RoleUser}
+	return user.ID, nil
+}
+
+func (s *memStore) SyncRoles(_ context.Context, userID int64, roles, managed []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var synced []string
+	for _, role := range s.roles[userID] {
+		if !slices.Contains(managed, role) || slices.Contains(roles, role) {
+			synced = append(synced, role)
+		}
+	}
+	for _, role := range roles {
+		if !slices.Contains(synced, role) {
+			synced = append(synced, role)
+		}
+	}
+	s.roles[userID] = synced
+	return nil
+}
+
+func (s *memStore) AttemptLockout(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.locked[key], nil
+}
+
+func (s *memStore) RecordFailedAttempt(_ context.Context, key string, _ time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts[key]++
+	return s.attempts[key], nil
+}
+
+func (s *memStore) LockAttempts(_ context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locked[key] = d
+	return nil
+}
+
+func (s *memStore) ResetAttempts(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+	delete(s.locked, key)
+	return nil
+}
+
+func (s *memStore) SaveLoginAttempt(_ context.Context, attempt *models.LoginAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	attempt.ID = s.id()
+	attempt.CreatedAt = time.Now()
+	s.logins = append(s.logins, *attempt)
+	return nil
+}
+
+func (s *memStore) ListLoginAttempts(context.Context, int64, int, int) ([]models.LoginAttempt, error) {
+	return nil, nil
+}
+
+func (s *memStore) LoginOrigin(context.Context, int64, string, string) (*models.LoginOrigin, error) {
+	return &models.LoginOrigin{FirstLogin: true}, nil
+}
+
+func (s *memStore) Record(_ context.Context, event *models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// lastEvent returns the last audit event of the type.
+func (s *memStore) lastEvent(eventType string) (models.AuditEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.events) - 1; i >= 0; i-- {
+		if s.events[i].Type == eventType {
+			return s.events[i], true
+		}
+	}
+	return models.AuditEvent{}, false
+}
+
+// newTestAuth wires an Auth to store and a real token manager. Tests set
+// the other dependencies they need on the result.
+func newTestAuth(t *testing.T, store *memStore) *Auth {
+	t.Helper()
+
+	tokenManager, err := token.New(config.Token{
+		Algorithm:  "HS256",
+		Secret:     "test-secret",
+		Issuer:     "web_auth",
+		AccessTTL:  time.Minute,
+		RefreshTTL: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("token.New: %v", err)
+	}
+
+	return &Auth{
+		log:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		cfg:           config.Auth{MFATokenTTL: time.Minute},
+		userProvider:  store,
+		tokenManager:  tokenManager,
+		tokenStore:    store,
+		resetStore:    store,
+		roleStore:     store,
+		sessionStore:  store,
+		totpStore:     store,
+		webAuthnStore: store,
+		attemptStore:  store,
+		loginHistory:  store,
+		auditLog:      store,
+
+		federationStore: store,
+		directoryStore:  store,
+	}
+}
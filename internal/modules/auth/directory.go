@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"web_auth/internal/models"
+)
+
+// Directory checks passwords against an external user directory such as
+// LDAP. Wrong passwords and unknown users are reported as
+// ErrInvalidCredentials.
+type Directory interface {
+	Authenticate(ctx context.Context, email, password string) (*models.DirectoryUser, error)
+	// ManagedRoles are the roles the directory grants, the user's other
+	// roles are left alone.
+	ManagedRoles() []string
+}
+
+type DirectoryStore interface {
+	// SaveDirectoryUser creates a user with the default role and without a
+	// password whose email is vouched for by the directory.
+	SaveDirectoryUser(ctx context.Context, email string) (uid int64, err error)
+	// SyncRoles grants roles and revokes the managed roles not among them.
+	SyncRoles(ctx context.Context, userID int64, roles, managed []string) error
+}
+
+// directoryFor returns the directory responsible for the email's domain.
+func (a *Auth) directoryFor(email string) (Directory, bool) {
+	_, domain, found := strings.Cut(email, "@")
+	if !found {
+		return nil, false
+	}
+
+	directory, ok := a.directories[strings.ToLower(domain)]
+	return directory, ok
+}
+
+// directoryLogin authenticates against the directory and returns the local
+// user, creating it on the first login. Roles mapped from directory groups
+// are synced on every login.
+func (a *Auth) directoryLogin(ctx context.Context, log *slog.Logger, directory Directory, email, password string,
+) (*models.User, error) {
+	dirUser, err := directory.Authenticate(ctx, email, password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			log.Warn("directory rejected credentials")
+			return nil, ErrInvalidCredentials
+		}
+		log.Error("directory authentication failed", "err", err)
+		return nil, err
+	}
+
+	log = log.With(slog.String("dn", dirUser.DN))
+
+	user, err := a.userProvider.ProvideUser(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		user, err = a.provisionDirectoryUser(ctx, log, email)
+	}
+	if err != nil {
+		log.Error("failed to provide user", "err", err)
+		return nil, err
+	}
+
+	roles := append([]string{models.RoleUser}, dirUser.Roles...)
+	if err := a.directoryStore.SyncRoles(ctx, user.ID, roles, directory.ManagedRoles()); err != nil {
+		log.Error("failed to sync directory roles", "err", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (a *Auth) provisionDirectoryUser(ctx context.Context, log *slog.Logger, email string) (*models.User, error) {
+	_, err := a.directoryStore.SaveDirectoryUser(ctx, email)
+	if err != nil && !errors.Is(err, ErrUserExists) {
+		return nil, fmt.Errorf("auth.provisionDirectoryUser: %w", err)
+	}
+
+	// ErrUserExists: a concurrent first login created it
+	user, err := a.userProvider.ProvideUser(ctx, email)
+	if err != nil {
+		return nil, fmt.Errorf("auth.provisionDirectoryUser: %w", err)
+	}
+
+	log.Info("directory user provisioned", slog.Int64("userID", user.ID))
+	return user, nil
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"web_auth/internal/models"
+)
+
+// stubDirectory accepts a single password and grants the roles set on it.
+type stubDirectory struct {
+	password string
+	roles    []string
+	managed  []string
+}
+
+func (d *stubDirectory) Authenticate(_ context.Context, email, password string) (*models.DirectoryUser, error) {
+	if password != d.password {
+		return nil, ErrInvalidCredentials
+	}
+	return &models.DirectoryUser{DN: "uid=alice,dc=corp,dc=example", Email: email, Roles: d.roles}, nil
+}
+
+func (d *stubDirectory) ManagedRoles() []string {
+	return d.managed
+}
+
+func newDirectoryAuth(t *testing.T, store *memStore, directory *stubDirectory) *Auth {
+	t.Helper()
+
+	a := newTestAuth(t, store)
+	a.directories = map[string]Directory{"corp.example": directory}
+	return a
+}
+
+func TestDirectoryLoginProvisionsUser(t *testing.T) {
+	store := newMemStore()
+	a := newDirectoryAuth(t, store, &stubDirectory{
+		password: "secret",
+		roles:    []string{models.RoleAdmin},
+		managed:  []string{models.RoleAdmin},
+	})
+
+	tokens, _, err := a.Login(context.Background(), "Alice@Corp.example", "secret", models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	user, err := store.ProvideUser(context.Background(), "alice@corp.example")
+	if err != nil {
+		t.Fatalf("user not provisioned: %v", err)
+	}
+	if id := tokenUserID(t, a, tokens); id != user.ID {
+		t.Errorf("access token subject = %d, want %d", id, user.ID)
+	}
+
+	roles, _ := store.UserRoles(context.Background(), user.ID)
+	slices.Sort(roles)
+	if want := []string{models.RoleAdmin, models.RoleUser}; !slices.Equal(roles, want) {
+		t.Errorf("roles = %v, want %v", roles, want)
+	}
+
+	if len(store.logins) != 1 || store.logins[0].Method != models.LoginMethodLDAP {
+		t.Errorf("login history = %+v, want one ldap login", store.logins)
+	}
+
+	// the next login uses the provisioned account
+	if _, _, err := a.Login(context.Background(), "alice@corp.example", "secret", models.ClientInfo{}); err != nil {
+		t.Fatalf("second Login: %v", err)
+	}
+	if len(store.users) != 1 {
+		t.Errorf("%d users after two logins, want 1", len(store.users))
+	}
+}
+
+func TestDirectoryLoginSyncsRoles(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser("alice@corp.example")
+	store.roles[user.ID] = []string{models.RoleUser, models.RoleAdmin, "support"}
+
+	// alice left the admins group; support isn't the directory's to revoke
+	a := newDirectoryAuth(t, store, &stubDirectory{password: "secret", managed: []string{models.RoleAdmin}})
+
+	if _, _, err := a.Login(context.Background(), "alice@corp.example", "secret", models.ClientInfo{}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	roles, _ := store.UserRoles(context.Background(), user.ID)
+	slices.Sort(roles)
+	if want := []string{"support", models.RoleUser}; !slices.Equal(roles, want) {
+		t.Errorf("roles = %v, want %v", roles, want)
+	}
+}
+
+func TestDirectoryLoginRejected(t *testing.T) {
+	store := newMemStore()
+	a := newDirectoryAuth(t, store, &stubDirectory{password: "secret"})
+
+	_, _, err := a.Login(context.Background(), "alice@corp.example", "wrong", models.ClientInfo{IP: "203.0.113.5"})
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("Login error = %v, want ErrInvalidCredentials", err)
+	}
+
+	if len(store.users) != 0 {
+		t.Errorf("user provisioned on a failed login")
+	}
+	if store.attempts[accountAttemptKey("alice@corp.example")] != 1 || store.attempts["ip:203.0.113.5"] != 1 {
+		t.Errorf("failed attempts = %v, want the account and ip counted", store.attempts)
+	}
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"web_auth/internal/utils/token"
+)
+
+// VerifyEmail confirms the address the verification token was sent to.
+func (a *Auth) VerifyEmail(ctx context.Context, verificationToken string) error {
+	const op = "auth.VerifyEmail"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("email verification attempt")
+
+	userID, err := a.emailStore.VerifyEmail(ctx, token.Hash(verificationToken))
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("invalid verification token")
+			return ErrInvalidToken
+		}
+		log.Error("failed to verify email", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("email verified successfully", slog.Int64("userID", userID))
+	return nil
+}
+
+// ResendVerificationEmail sends a fresh verification link. Like ForgotPassword
+// it doesn't reveal whether the address is registered.
+func (a *Auth) ResendVerificationEmail(ctx context.Context, email string) error {
+	const op = "auth.ResendVerificationEmail"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("verification email requested")
+
+	user, err := a.userProvider.ProvideUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("verification email for unknown address")
+			return nil
+		}
+		log.Error("failed to provide user", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if user.EmailVerifiedAt != nil {
+		log.Info("email already verified", slog.Int64("userID", user.ID))
+		return nil
+	}
+
+	if err := a.sendVerificationEmail(ctx, user.ID, user.Email); err != nil {
+		log.Error("failed to send verification email", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (a *Auth) sendVerificationEmail(ctx context.Context, userID int64, email string) error {
+	raw, err := token.NewOpaque()
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(a.cfg.EmailVerificationTTL)
+	if err := a.emailStore.SaveEmailVerificationToken(ctx, userID, token.Hash(raw), expiresAt); err != nil {
+		return err
+	}
+
+	link := a.cfg.PublicURL + "/verify-email?token=" + url.QueryEscape(raw)
+	body := fmt.Sprintf("Confirm your email address by opening %s\n\n"+
+		"The link expires at %s.",
+		link, expiresAt.UTC().Format(time.RFC1123))
+
+	return a.mailer.Send(ctx, email, "Confirm your email", body)
+}
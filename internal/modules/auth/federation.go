@@ -0,0 +1,296 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+)
+
+// IdentityProvider is an external OpenID Connect provider users can sign in
+// with.
+type IdentityProvider interface {
+	// AuthCodeURL returns where to send the user to sign in. codeChallenge
+	// is the S256 PKCE challenge.
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	// Exchange redeems the authorization code and returns the verified
+	// identity from the ID token.
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*models.ExternalIdentity, error)
+}
+
+type FederationStore interface {
+	SaveFederatedLogin(ctx context.Context, stateHash string, login *models.FederatedLogin) error
+	// TakeFederatedLogin returns and deletes a pending sign in.
+	TakeFederatedLogin(ctx context.Context, stateHash string) (*models.FederatedLogin, error)
+	FederatedIdentity(ctx context.Context, provider, subject string) (*models.FederatedIdentity, error)
+	LinkFederatedIdentity(ctx context.Context, identity *models.FederatedIdentity) error
+	// SaveFederatedUser creates a user with the default role and without a
+	// password together with its identity.
+	SaveFederatedUser(ctx context.Context, identity *models.FederatedIdentity, emailVerified bool) (uid int64, err error)
+	TouchFederatedIdentity(ctx context.Context, provider, subject string) error
+	ListFederatedIdentities(ctx context.Context, userID int64) ([]models.FederatedIdentity, error)
+	UnlinkFederatedIdentity(ctx context.Context, userID int64, provider string) error
+}
+
+// BeginFederatedLogin starts signing in at the provider. It returns the URL
+// to redirect the user to and the state, which the caller must bind to the
+// user's browser and hand back to CompleteFederatedLogin.
+func (a *Auth) BeginFederatedLogin(ctx context.Context, provider string) (authURL, state string, err error) {
+	const op = "auth.BeginFederatedLogin"
+
+	log := a.log.With(slog.String("op", op), slog.String("provider", provider))
+	log.Info("federated login attempt")
+
+	idp, ok := a.identityProviders[provider]
+	if !ok {
+		log.Warn("unknown identity provider")
+		return "", "", ErrProviderNotFound
+	}
+
+	var nonce, verifier string
+	for _, v := range []*string{&state, &nonce, &verifier} {
+		if *v, err = token.NewOpaque(); err != nil {
+			log.Error("failed to generate state", "err", err)
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	login := &models.FederatedLogin{
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(a.cfg.FederatedLoginTTL),
+	}
+
+	if err := a.federationStore.SaveFederatedLogin(ctx, token.Hash(state), login); err != nil {
+		log.Error("failed to save federated login", "err", err)
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+
+	authURL, err = idp.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(challenge[:]))
+	if err != nil {
+		log.Error("failed to build authorization url", "err", err)
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	return authURL, state, nil
+}
+
+// CompleteFederatedLogin finishes a sign in at the provider. state is the
+// value the provider sent back, boundState the one stored in the user's
+// browser; they must match so that a code can't be injected into another
+// browser. The external identity is mapped to a local user: an identity
+// seen before logs into its user, an unknown one is linked to the account
+// with the same email if both sides verified that address, otherwise a new
+// account without a password is created. Like Login, a challenge is returned
+// instead of tokens if the user has a second factor.
+func (a *Auth) CompleteFederatedLogin(ctx context.Context, provider, state, boundState, code string,
+	client models.ClientInfo,
+) (tokens *models.Token, challenge *models.MFAChallenge, err error) {
+	const op = "auth.CompleteFederatedLogin"
+
+	log := a.log.With(slog.String("op", op), slog.String("provider", provider))
+	log.Info("federated login callback")
+
+	event := newAuditEvent(models.AuditUserLogin, nil, nil, client, "method: oidc, provider: "+provider)
+	defer a.audit(ctx, event, &err)
+
+	idp, ok := a.identityProviders[provider]
+	if !ok {
+		log.Warn("unknown identity provider")
+		return nil, nil, ErrProviderNotFound
+	}
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(boundState)) != 1 {
+		log.Warn("state doesn't match the browser")
+		return nil, nil, ErrInvalidToken
+	}
+
+	login, err := a.federationStore.TakeFederatedLogin(ctx, token.Hash(state))
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("unknown or used state")
+			return nil, nil, ErrInvalidToken
+		}
+		log.Error("failed to get federated login", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if login.Provider != provider || time.Now().After(login.ExpiresAt) {
+		log.Warn("expired state or provider mismatch")
+		return nil, nil, ErrInvalidToken
+	}
+
+	external, err := idp.Exchange(ctx, code, login.CodeVerifier, login.Nonce)
+	if err != nil {
+		log.Warn("identity provider rejected the sign in", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w: %v", op, ErrFederationFailed, err)
+	}
+
+	log = log.With(slog.String("subject", external.Subject))
+
+	user, err := a.federatedUser(ctx, log, external)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	event.ActorID, event.TargetID = &user.ID, &user.ID
+	defer func() { a.recordLogin(ctx, user, models.LoginMethodOIDC, client, challenge, err) }()
+
+	if err := a.checkCanLogin(user); err != nil {
+		log.Warn("login refused", slog.Int64("userID", user.ID), "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	mfaEnabled, err := a.TOTPEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to check second factor", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if mfaEnabled {
+		challenge, err := a.newMFAChallenge(user)
+		if err != nil {
+			log.Error("failed to issue mfa challenge", "err", err)
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("second factor required", slog.Int64("userID", user.ID))
+		event.Details += ", second factor required"
+		return nil, challenge, nil
+	}
+
+	tokens, err = a.issueTokens(ctx, user, client)
+	if err != nil {
+		log.Error("failed to issue tokens", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with identity provider", slog.Int64("userID", user.ID))
+
+	return tokens, nil, nil
+}
+
+// federatedUser finds or creates the local user of an external identity.
+func (a *Auth) federatedUser(ctx context.Context, log *slog.Logger, external *models.ExternalIdentity,
+) (*models.User, error) {
+	identity, err := a.federationStore.FederatedIdentity(ctx, external.Provider, external.Subject)
+	switch {
+	case err == nil:
+		if err := a.federationStore.TouchFederatedIdentity(ctx, external.Provider, external.Subject); err != nil {
+			log.Warn("failed to touch identity", "err", err)
+		}
+		return a.userProvider.GetUserByID(ctx, identity.UserID)
+	case !errors.Is(err, ErrIdentityNotFound):
+		log.Error("failed to get identity", "err", err)
+		return nil, err
+	}
+
+	if external.Email == "" {
+		log.Warn("identity provider sent no email")
+		return nil, fmt.Errorf("%w: no email claim", ErrFederationFailed)
+	}
+
+	identity = &models.FederatedIdentity{
+		Provider: external.Provider,
+		Subject:  external.Subject,
+		Email:    external.Email,
+	}
+
+	existing, err := a.userProvider.ProvideUser(ctx, external.Email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Error("failed to provide user", "err", err)
+		return nil, err
+	}
+
+	if err == nil && existing.ID != 0 {
+		// Linking an address either side hasn't verified would let whoever
+		// registered it first take over the other account.
+		if !external.EmailVerified || existing.EmailVerifiedAt == nil {
+			log.Warn("refused to link identity to account with unverified email", slog.Int64("userID", existing.ID))
+			return nil, ErrIdentityLinkRefused
+		}
+
+		identity.UserID = existing.ID
+		if err := a.federationStore.LinkFederatedIdentity(ctx, identity); err != nil {
+			if errors.Is(err, ErrUserExists) {
+				log.Warn("account already linked to another identity of the provider", slog.Int64("userID", existing.ID))
+				return nil, ErrIdentityLinkRefused
+			}
+			log.Error("failed to link identity", "err", err)
+			return nil, err
+		}
+
+		log.Info("identity linked to existing account", slog.Int64("userID", existing.ID))
+		return existing, nil
+	}
+
+	id, err := a.federationStore.SaveFederatedUser(ctx, identity, external.EmailVerified)
+	if err != nil {
+		if errors.Is(err, ErrUserExists) {
+			log.Warn("account created concurrently")
+			return nil, ErrIdentityLinkRefused
+		}
+		log.Error("failed to save user", "err", err)
+		return nil, err
+	}
+
+	log.Info("user registered with identity provider", slog.Int64("userID", id))
+
+	return a.userProvider.GetUserByID(ctx, id)
+}
+
+func (a *Auth) ListFederatedIdentities(ctx context.Context, userID int64) ([]models.FederatedIdentity, error) {
+	const op = "auth.ListFederatedIdentities"
+
+	identities, err := a.federationStore.ListFederatedIdentities(ctx, userID)
+	if err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to list identities", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return identities, nil
+}
+
+// UnlinkFederatedIdentity removes the user's identity at the provider. The
+// last identity of an account without a password can't be removed, the user
+// would be locked out.
+func (a *Auth) UnlinkFederatedIdentity(ctx context.Context, user *models.User, provider string) error {
+	const op = "auth.UnlinkFederatedIdentity"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID), slog.String("provider", provider))
+	log.Info("unlink identity attempt")
+
+	if user.PasswordHashed == "" {
+		identities, err := a.federationStore.ListFederatedIdentities(ctx, user.ID)
+		if err != nil {
+			log.Error("failed to list identities", "err", err)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if len(identities) <= 1 {
+			log.Warn("refused to unlink the only sign in method")
+			return ErrLastSignInMethod
+		}
+	}
+
+	if err := a.federationStore.UnlinkFederatedIdentity(ctx, user.ID, provider); err != nil {
+		if errors.Is(err, ErrIdentityNotFound) {
+			log.Warn("identity not found")
+			return ErrIdentityNotFound
+		}
+		log.Error("failed to unlink identity", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("identity unlinked")
+	return nil
+}
@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"web_auth/internal/models"
+)
+
+const testAuthCode = "auth-code"
+
+// stubProvider stands in for an OpenID Connect provider that already
+// verified the ID token. It checks that the callback hands back the nonce
+// and PKCE verifier of the sign in it started.
+type stubProvider struct {
+	identity models.ExternalIdentity
+
+	nonce, challenge string
+}
+
+func (p *stubProvider) AuthCodeURL(_ context.Context, state, nonce, codeChallenge string) (string, error) {
+	p.nonce, p.challenge = nonce, codeChallenge
+	return "https://idp.example.test/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p *stubProvider) Exchange(_ context.Context, code, codeVerifier, nonce string) (*models.ExternalIdentity, error) {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	if code != testAuthCode || nonce != p.nonce || base64.RawURLEncoding.EncodeToString(sum[:]) != p.challenge {
+		return nil, errors.New("invalid_grant")
+	}
+
+	identity := p.identity
+	return &identity, nil
+}
+
+func newFederationAuth(t *testing.T, store *memStore, identity models.ExternalIdentity) (*Auth, *stubProvider) {
+	t.Helper()
+
+	idp := &stubProvider{identity: identity}
+
+	a := newTestAuth(t, store)
+	a.cfg.FederatedLoginTTL = time.Minute
+	a.identityProviders = map[string]IdentityProvider{"stub": idp}
+	return a, idp
+}
+
+// federatedLogin signs in at the stub provider from a single browser.
+func federatedLogin(t *testing.T, a *Auth) (*models.Token, error) {
+	t.Helper()
+
+	_, state, err := a.BeginFederatedLogin(context.Background(), "stub")
+	if err != nil {
+		t.Fatalf("BeginFederatedLogin: %v", err)
+	}
+
+	tokens, _, err := a.CompleteFederatedLogin(context.Background(), "stub", state, state, testAuthCode,
+		models.ClientInfo{IP: "203.0.113.5", UserAgent: "test"})
+	return tokens, err
+}
+
+func tokenUserID(t *testing.T, a *Auth, tokens *models.Token) int64 {
+	t.Helper()
+
+	claims, err := a.tokenManager.Parse(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("parse access token: %v", err)
+	}
+	id, _ := claims.UserID()
+	return id
+}
+
+func TestFederatedLoginCreatesUser(t *testing.T) {
+	store := newMemStore()
+	a, _ := newFederationAuth(t, store, models.ExternalIdentity{
+		Provider: "stub", Subject: "external-42", Email: "alice@example.com", EmailVerified: true,
+	})
+
+	tokens, err := federatedLogin(t, a)
+	if err != nil {
+		t.Fatalf("CompleteFederatedLogin: %v", err)
+	}
+
+	user, err := store.ProvideUser(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("user not created: %v", err)
+	}
+	if id := tokenUserID(t, a, tokens); id != user.ID {
+		t.Errorf("access token subject = %d, want %d", id, user.ID)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("email verified by the provider not marked verified")
+	}
+	if roles, _ := store.UserRoles(context.Background(), user.ID); len(roles) != 1 || roles[0] != models.RoleUser {
+		t.Errorf("roles = %v, want [%s]", roles, models.RoleUser)
+	}
+
+	// the identity logs into the same account next time
+	tokens, err = federatedLogin(t, a)
+	if err != nil {
+		t.Fatalf("second CompleteFederatedLogin: %v", err)
+	}
+	if id := tokenUserID(t, a, tokens); id != user.ID {
+		t.Errorf("second login subject = %d, want %d", id, user.ID)
+	}
+	if len(store.users) != 1 {
+		t.Errorf("%d users after two logins, want 1", len(store.users))
+	}
+}
+
+func TestFederatedLoginLinksVerifiedEmail(t *testing.T) {
+	store := newMemStore()
+	existing := store.addUser("alice@example.com")
+	verifiedAt := time.Now()
+	existing.EmailVerifiedAt = &verifiedAt
+
+	a, _ := newFederationAuth(t, store, models.ExternalIdentity{
+		Provider: "stub", Subject: "external-42", Email: "Alice@example.com", EmailVerified: true,
+	})
+
+	tokens, err := federatedLogin(t, a)
+	if err != nil {
+		t.Fatalf("CompleteFederatedLogin: %v", err)
+	}
+	if id := tokenUserID(t, a, tokens); id != existing.ID {
+		t.Errorf("access token subject = %d, want %d", id, existing.ID)
+	}
+
+	identity, err := store.FederatedIdentity(context.Background(), "stub", "external-42")
+	if err != nil || identity.UserID != existing.ID {
+		t.Errorf("identity = %+v, %v; want linked to %d", identity, err, existing.ID)
+	}
+}
+
+func TestFederatedLoginRefusesUnverifiedLink(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		localVerified    bool
+		externalVerified bool
+	}{
+		{name: "unverified at the provider", localVerified: true},
+		{name: "unverified locally", externalVerified: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			existing := store.addUser("alice@example.com")
+			if tc.localVerified {
+				verifiedAt := time.Now()
+				existing.EmailVerifiedAt = &verifiedAt
+			}
+
+			a, _ := newFederationAuth(t, store, models.ExternalIdentity{
+				Provider: "stub", Subject: "external-42", Email: "alice@example.com", EmailVerified: tc.externalVerified,
+			})
+
+			if _, err := federatedLogin(t, a); !errors.Is(err, ErrIdentityLinkRefused) {
+				t.Fatalf("CompleteFederatedLogin error = %v, want ErrIdentityLinkRefused", err)
+			}
+			if len(store.identities) != 0 {
+				t.Errorf("identity linked: %+v", store.identities)
+			}
+		})
+	}
+}
+
+func TestFederatedLoginRejectsState(t *testing.T) {
+	identity := models.ExternalIdentity{
+		Provider: "stub", Subject: "external-42", Email: "alice@example.com", EmailVerified: true,
+	}
+
+	for _, tc := range []struct {
+		name string
+		// complete gets the state BeginFederatedLogin returned and
+		// finishes the sign in.
+		complete func(a *Auth, state string) error
+	}{
+		{
+			name: "state not bound to the browser",
+			complete: func(a *Auth, state string) error {
+				_, _, err := a.CompleteFederatedLogin(context.Background(), "stub", state, "other", testAuthCode,
+					models.ClientInfo{})
+				return err
+			},
+		},
+		{
+			name: "empty state",
+			complete: func(a *Auth, _ string) error {
+				_, _, err := a.CompleteFederatedLogin(context.Background(), "stub", "", "", testAuthCode,
+					models.ClientInfo{})
+				return err
+			},
+		},
+		{
+			name: "unknown state",
+			complete: func(a *Auth, _ string) error {
+				_, _, err := a.CompleteFederatedLogin(context.Background(), "stub", "forged", "forged", testAuthCode,
+					models.ClientInfo{})
+				return err
+			},
+		},
+		{
+			name: "replayed state",
+			complete: func(a *Auth, state string) error {
+				if _, _, err := a.CompleteFederatedLogin(context.Background(), "stub", state, state, testAuthCode,
+					models.ClientInfo{}); err != nil {
+					return err
+				}
+				_, _, err := a.CompleteFederatedLogin(context.Background(), "stub", state, state, testAuthCode,
+					models.ClientInfo{})
+				return err
+			},
+		},
+		{
+			name: "state of another provider",
+			complete: func(a *Auth, state string) error {
+				a.identityProviders["other"] = a.identityProviders["stub"]
+				_, _, err := a.CompleteFederatedLogin(context.Background(), "other", state, state, testAuthCode,
+					models.ClientInfo{})
+				return err
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			a, _ := newFederationAuth(t, store, identity)
+
+			_, state, err := a.BeginFederatedLogin(context.Background(), "stub")
+			if err != nil {
+				t.Fatalf("BeginFederatedLogin: %v", err)
+			}
+
+			if err := tc.complete(a, state); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("CompleteFederatedLogin error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestFederatedLoginExpired(t *testing.T) {
+	store := newMemStore()
+	a, _ := newFederationAuth(t, store, models.ExternalIdentity{
+		Provider: "stub", Subject: "external-42", Email: "alice@example.com", EmailVerified: true,
+	})
+	a.cfg.FederatedLoginTTL = -time.Second
+
+	if _, err := federatedLogin(t, a); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("CompleteFederatedLogin error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestFederatedLoginRejectedByProvider(t *testing.T) {
+	store := newMemStore()
+	a, idp := newFederationAuth(t, store, models.ExternalIdentity{
+		Provider: "stub", Subject: "external-42", Email: "alice@example.com", EmailVerified: true,
+	})
+
+	_, state, err := a.BeginFederatedLogin(context.Background(), "stub")
+	if err != nil {
+		t.Fatalf("BeginFederatedLogin: %v", err)
+	}
+	// the provider only redeems the code with the nonce it was given
+	idp.nonce = "other"
+
+	_, _, err = a.CompleteFederatedLogin(context.Background(), "stub", state, state, testAuthCode, models.ClientInfo{})
+	if !errors.Is(err, ErrFederationFailed) {
+		t.Fatalf("CompleteFederatedLogin error = %v, want ErrFederationFailed", err)
+	}
+}
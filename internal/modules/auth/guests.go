@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"web_auth/internal/models"
+)
+
+const guestAudience = "guest"
+
+// CreateGuest starts an anonymous identity and returns a token proving it.
+// Guest tokens are only accepted by AuthenticateGuest and RegisterNewUser.
+func (a *Auth) CreateGuest(ctx context.Context) (*models.GuestToken, error) {
+	const op = "auth.CreateGuest"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("create guest attempt")
+
+	guest, err := a.guestStore.CreateGuest(ctx)
+	if err != nil {
+		log.Error("failed to create guest", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	guestToken, expiresAt, err := a.tokenManager.NewScopedToken(guest.Identifier, guestAudience, a.cfg.GuestTokenTTL)
+	if err != nil {
+		log.Error("failed to issue guest token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("guest created successfully", slog.String("guestID", guest.Identifier))
+
+	return &models.GuestToken{
+		GuestID:    guest.Identifier,
+		GuestToken: guestToken,
+		ExpiresAt:  expiresAt,
+	}, nil
+}
+
+// AuthenticateGuest verifies a guest token. Tokens of guests that were merged
+// into an account are rejected with ErrInvalidToken.
+func (a *Auth) AuthenticateGuest(ctx context.Context, guestToken string) (*models.Guest, error) {
+	const op = "auth.AuthenticateGuest"
+
+	log := a.log.With(slog.String("op", op))
+
+	guestID, err := a.parseGuestToken(guestToken)
+	if err != nil {
+		log.Debug("guest token rejected", "err", err)
+		return nil, ErrInvalidToken
+	}
+
+	guest, err := a.guestStore.GuestByIdentifier(ctx, guestID)
+	if err != nil {
+		if errors.Is(err, ErrGuestNotFound) {
+			log.Warn("token of unknown or merged guest presented", slog.String("guestID", guestID))
+			return nil, ErrInvalidToken
+		}
+		log.Error("failed to get guest", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return guest, nil
+}
+
+func (a *Auth) parseGuestToken(guestToken string) (string, error) {
+	claims, err := a.tokenManager.ParseScoped(guestToken, guestAudience)
+	if err != nil {
+		return "", err
+	}
+
+	if claims.Subject == "" {
+		return "", ErrInvalidToken
+	}
+
+	return claims.Subject, nil
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+)
+
+// Impersonate starts a session in which actor acts as the user, e.g. a
+// support engineer reproducing a problem. The session carries both: its
+// access tokens name the user as subject and actor in the act claim. It
+// expires after ImpersonationTTL and can't be refreshed past that. Admins
+// can't be impersonated and impersonation can't be nested.
+func (a *Auth) Impersonate(ctx context.Context, actor *models.User, actorSession *models.Session, userID int64,
+	reason string, client models.ClientInfo,
+) (tokens *models.Token, err error) {
+	const op = "auth.Impersonate"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("actorID", actor.ID), slog.Int64("userID", userID))
+	log.Info("impersonation attempt")
+
+	event := newAuditEvent(models.AuditImpersonationStart, &actor.ID, &userID, client, reason)
+	defer a.audit(ctx, event, &err)
+
+	if actorSession != nil && actorSession.Impersonated() {
+		log.Warn("nested impersonation refused")
+		return nil, ErrImpersonating
+	}
+
+	if userID == actor.ID {
+		log.Warn("self impersonation refused")
+		return nil, ErrForbidden
+	}
+
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("user not found")
+			return nil, ErrUserNotFound
+		}
+		log.Error("failed to get user", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !user.IsActive {
+		log.Warn("impersonation of blocked user refused")
+		return nil, ErrUserBlocked
+	}
+
+	roles, err := a.roleStore.UserRoles(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get user roles", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if slices.Contains(roles, models.RoleAdmin) {
+		log.Warn("impersonation of admin refused")
+		return nil, ErrForbidden
+	}
+
+	raw, hash, _, err := a.tokenManager.NewRefreshToken()
+	if err != nil {
+		log.Error("failed to issue refresh token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	expiresAt := time.Now().Add(a.cfg.ImpersonationTTL)
+	session := &models.Session{
+		UserID:         user.ID,
+		UserAgent:      client.UserAgent,
+		IP:             client.IP,
+		ExpiresAt:      expiresAt,
+		ImpersonatorID: &actor.ID,
+	}
+	refresh := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := a.sessionStore.CreateSession(ctx, session, refresh); err != nil {
+		log.Error("failed to create session", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err = a.tokenResponse(user, session, raw)
+	if err != nil {
+		log.Error("failed to issue access token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	event.Details = "session: " + session.ID + ", reason: " + reason
+	log.Info("impersonation started", slog.String("sessionID", session.ID), slog.String("reason", reason))
+
+	return tokens, nil
+}
+
+// StopImpersonation ends the impersonation session the request was made
+// with. The actor's own session is left alone.
+func (a *Auth) StopImpersonation(ctx context.Context, user *models.User, session *models.Session,
+	client models.ClientInfo,
+) (err error) {
+	const op = "auth.StopImpersonation"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID))
+
+	if session == nil || !session.Impersonated() {
+		log.Warn("not an impersonation session")
+		return ErrNotImpersonating
+	}
+
+	log = log.With(slog.Int64("actorID", *session.ImpersonatorID), slog.String("sessionID", session.ID))
+
+	event := newAuditEvent(models.AuditImpersonationStop, session.ImpersonatorID, &user.ID, client,
+		"session: "+session.ID)
+	defer a.audit(ctx, event, &err)
+
+	if err := a.sessionStore.RevokeSession(ctx, user.ID, session.ID); err != nil {
+		log.Error("failed to revoke session", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("impersonation stopped")
+
+	return nil
+}
+
+// checkActor makes sure the token's act claim matches the session and that
+// the impersonator is still allowed in: blocking an admin ends their
+// impersonation sessions too.
+func (a *Auth) checkActor(ctx context.Context, log *slog.Logger, claims *token.Claims, session *models.Session) error {
+	if !session.Impersonated() {
+		if claims.Actor != nil {
+			log.Warn("actor claim on a regular session")
+			return ErrInvalidToken
+		}
+		return nil
+	}
+
+	if claims.Actor == nil || claims.Actor.Subject != strconv.FormatInt(*session.ImpersonatorID, 10) {
+		log.Warn("actor claim doesn't match the session")
+		return ErrInvalidToken
+	}
+
+	actor, err := a.userProvider.GetUserByID(ctx, *session.ImpersonatorID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("impersonator not found")
+			return ErrInvalidToken
+		}
+		log.Error("failed to get impersonator", "err", err)
+		return fmt.Errorf("auth.checkActor: %w", err)
+	}
+
+	if !actor.IsActive {
+		log.Warn("blocked impersonator presented access token", slog.Int64("actorID", actor.ID))
+		return ErrInvalidToken
+	}
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"web_auth/internal/models"
+)
+
+// TooManyAttemptsError is returned while a login key is locked out. It
+// matches ErrTooManyAttempts with errors.Is.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return ErrTooManyAttempts.Error()
+}
+
+func (e *TooManyAttemptsError) Unwrap() error {
+	return ErrTooManyAttempts
+}
+
+// attemptKey is a counter of failed logins, either for an account or for a
+// client IP, with its own limit.
+type attemptKey struct {
+	key   string
+	limit int
+}
+
+func accountAttemptKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func (a *Auth) attemptKeys(email, ip string) []attemptKey {
+	keys := []attemptKey{{key: accountAttemptKey(email), limit: a.cfg.Lockout.MaxAttempts}}
+	if ip != "" {
+		keys = append(keys, attemptKey{key: "ip:" + ip, limit: a.cfg.Lockout.MaxIPAttempts})
+	}
+	return keys
+}
+
+// checkLockout returns a *TooManyAttemptsError if any of the keys is locked.
+func (a *Auth) checkLockout(ctx context.Context, keys []attemptKey) error {
+	var retryAfter time.Duration
+
+	for _, k := range keys {
+		remaining, err := a.attemptStore.AttemptLockout(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		retryAfter = max(retryAfter, remaining)
+	}
+
+	if retryAfter > 0 {
+		return &TooManyAttemptsError{RetryAfter: retryAfter}
+	}
+
+	return nil
+}
+
+// registerFailure counts a failed attempt against every key and locks the
+// ones that reached their limit.
+func (a *Auth) registerFailure(ctx context.Context, log *slog.Logger, keys []attemptKey) {
+	for _, k := range keys {
+		failures, err := a.attemptStore.RecordFailedAttempt(ctx, k.key, a.cfg.Lockout.Window)
+		if err != nil {
+			log.Error("failed to record login failure", "err", err)
+			continue
+		}
+
+		if k.limit <= 0 || failures < k.limit {
+			continue
+		}
+
+		delay := a.lockoutDelay(failures - k.limit)
+		if err := a.attemptStore.LockAttempts(ctx, k.key, delay); err != nil {
+			log.Error("failed to lock login attempts", "err", err)
+			continue
+		}
+
+		log.Warn("login attempts locked",
+			slog.String("key", k.key), slog.Int("failures", failures), slog.Duration("for", delay))
+	}
+}
+
+// resetAttempts forgets the account's failures after a successful login. IP
+// counters are left alone so an attacker can't clear them with an account of
+// their own.
+func (a *Auth) resetAttempts(ctx context.Context, log *slog.Logger, email string) {
+	if err := a.attemptStore.ResetAttempts(ctx, accountAttemptKey(email)); err != nil {
+		log.Warn("failed to reset login attempts", "err", err)
+	}
+}
+
+// lockoutDelay doubles the base delay for every failure past the limit.
+func (a *Auth) lockoutDelay(excess int) time.Duration {
+	delay := a.cfg.Lockout.BaseDelay
+	for i := 0; i < excess && delay < a.cfg.Lockout.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, a.cfg.Lockout.MaxDelay)
+}
+
+// ClearLockout resets the failed login counter of the user's account.
+func (a *Auth) ClearLockout(ctx context.Context, actorID, userID int64, client models.ClientInfo) (err error) {
+	const op = "auth.ClearLockout"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("clear lockout attempt", slog.Int64("userID", userID))
+
+	defer a.audit(ctx, newAuditEvent(models.AuditLockoutClear, &actorID, &userID, client, ""), &err)
+
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("user not found for clearing lockout", slog.Int64("userID", userID))
+			return ErrUserNotFound
+		}
+		log.Error("failed to get user", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.attemptStore.ResetAttempts(ctx, accountAttemptKey(user.Email)); err != nil {
+		log.Error("failed to reset login attempts", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("lockout cleared successfully", slog.Int64("userID", userID))
+	return nil
+}
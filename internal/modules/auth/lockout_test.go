@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+	"web_auth/internal/utils/password"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct horse battery staple"
+
+func newPasswordAuth(t *testing.T, store *memStore) *Auth {
+	t.Helper()
+
+	hasher, err := password.New(config.Password{Algorithm: password.AlgBcrypt, BcryptCost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatalf("password.New: %v", err)
+	}
+
+	a := newTestAuth(t, store)
+	a.hasher = hasher
+	a.cfg.Lockout = config.Lockout{
+		MaxAttempts:   3,
+		MaxIPAttempts: 5,
+		Window:        15 * time.Minute,
+		BaseDelay:     30 * time.Second,
+		MaxDelay:      2 * time.Minute,
+	}
+	return a
+}
+
+func addPasswordUser(t *testing.T, a *Auth, store *memStore, email string) *models.User {
+	t.Helper()
+
+	hash, err := a.hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	user := store.addUser(email)
+	user.PasswordHashed = hash
+	return user
+}
+
+func retryAfter(err error) (time.Duration, bool) {
+	var tooMany *TooManyAttemptsError
+	if !errors.As(err, &tooMany) {
+		return 0, false
+	}
+	return tooMany.RetryAfter, true
+}
+
+func TestLockoutDelayDoubles(t *testing.T) {
+	store := newMemStore()
+	a := newPasswordAuth(t, store)
+	// keep the IP out of the way, only the account is locked here
+	a.cfg.Lockout.MaxIPAttempts = 100
+	addPasswordUser(t, a, store, "alice@example.com")
+	client := models.ClientInfo{IP: "203.0.113.5"}
+	key := accountAttemptKey("alice@example.com")
+
+	for i := range 2 {
+		if _, _, err := a.Login(context.Background(), "alice@example.com", "wrong", client); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure %d: err = %v, want ErrInvalidCredentials", i+1, err)
+		}
+		if store.locked[key] != 0 {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+	}
+
+	for i, want := range []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute} {
+		_, _, err := a.Login(context.Background(), "alice@example.com", "wrong", client)
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure %d: err = %v, want ErrInvalidCredentials", i+3, err)
+		}
+		if store.locked[key] != want {
+			t.Fatalf("failure %d: locked for %v, want %v", i+3, store.locked[key], want)
+		}
+
+		// while locked even the right password is refused
+		_, _, err = a.Login(context.Background(), "alice@example.com", testPassword, client)
+		if d, ok := retryAfter(err); !ok || d != want {
+			t.Fatalf("login while locked: err = %v, retry after %v; want ErrTooManyAttempts after %v", err, d, want)
+		}
+
+		// the lock runs out, failures within the window are still counted
+		delete(store.locked, key)
+	}
+}
+
+func TestLockoutPerIP(t *testing.T) {
+	store := newMemStore()
+	a := newPasswordAuth(t, store)
+	addPasswordUser(t, a, store, "alice@example.com")
+	attacker := models.ClientInfo{IP: "203.0.113.5"}
+
+	// one failure each for more accounts than the per-IP limit, none of them
+	// reaches the account limit
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		if _, _, err := a.Login(context.Background(), email, "wrong", attacker); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("%s: err = %v, want ErrInvalidCredentials", email, err)
+		}
+	}
+
+	_, _, err := a.Login(context.Background(), "alice@example.com", testPassword, attacker)
+	if d, ok := retryAfter(err); !ok || d != 30*time.Second {
+		t.Fatalf("login from the locked IP: err = %v, retry after %v; want ErrTooManyAttempts", err, d)
+	}
+
+	tokens, _, err := a.Login(context.Background(), "alice@example.com", testPassword, models.ClientInfo{IP: "198.51.100.7"})
+	if err != nil || tokens == nil {
+		t.Fatalf("login from another IP: err = %v, want tokens", err)
+	}
+}
+
+func TestLockoutResetAfterLogin(t *testing.T) {
+	store := newMemStore()
+	a := newPasswordAuth(t, store)
+	addPasswordUser(t, a, store, "alice@example.com")
+	client := models.ClientInfo{IP: "203.0.113.5"}
+
+	fail := func() {
+		t.Helper()
+		if _, _, err := a.Login(context.Background(), "alice@example.com", "wrong", client); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+		}
+	}
+
+	fail()
+	fail()
+	if _, _, err := a.Login(context.Background(), "alice@example.com", testPassword, client); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	fail()
+	fail()
+
+	if got := store.attempts[accountAttemptKey("alice@example.com")]; got != 2 {
+		t.Errorf("account failures = %d, want 2 counted since the login", got)
+	}
+	if d := store.locked[accountAttemptKey("alice@example.com")]; d != 0 {
+		t.Errorf("account locked for %v after a successful login in between", d)
+	}
+	// the IP counter survives, otherwise any account of the attacker's own
+	// would clear it
+	if got := store.attempts["ip:"+client.IP]; got != 4 {
+		t.Errorf("IP failures = %d, want 4", got)
+	}
+}
+
+func TestClearLockout(t *testing.T) {
+	store := newMemStore()
+	a := newPasswordAuth(t, store)
+	user := addPasswordUser(t, a, store, "alice@example.com")
+	client := models.ClientInfo{IP: "203.0.113.5"}
+
+	for range 3 {
+		_, _, _ = a.Login(context.Background(), "alice@example.com", "wrong", client)
+	}
+	if store.locked[accountAttemptKey("alice@example.com")] == 0 {
+		t.Fatal("account not locked")
+	}
+
+	if err := a.ClearLockout(context.Background(), 99, user.ID, client); err != nil {
+		t.Fatalf("ClearLockout: %v", err)
+	}
+	if _, _, err := a.Login(context.Background(), "alice@example.com", testPassword, client); err != nil {
+		t.Errorf("login after clearing the lockout: %v", err)
+	}
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"web_auth/internal/models"
+)
+
+type LoginHistoryStore interface {
+	// SaveLoginAttempt stores the attempt and sets its ID and CreatedAt.
+	SaveLoginAttempt(ctx context.Context, attempt *models.LoginAttempt) error
+	ListLoginAttempts(ctx context.Context, userID int64, limit, offset int) ([]models.LoginAttempt, error)
+	// LoginOrigin looks the device and IP range up in the user's successful
+	// logins.
+	LoginOrigin(ctx context.Context, userID int64, device, ipRange string) (*models.LoginOrigin, error)
+}
+
+// LoginNotifier tells users about logins from a device or network they
+// haven't signed in from before, so they can spot someone else using their
+// account.
+type LoginNotifier interface {
+	NotifyNewLogin(ctx context.Context, user *models.User, login *models.LoginAttempt,
+		origin *models.LoginOrigin) error
+}
+
+// ListLogins returns the user's login history, newest first.
+func (a *Auth) ListLogins(ctx context.Context, userID int64, limit, offset int) ([]models.LoginAttempt, error) {
+	const op = "auth.ListLogins"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("list logins attempt", slog.Int64("userID", userID))
+
+	logins, err := a.loginHistory.ListLoginAttempts(ctx, userID, limit, offset)
+	if err != nil {
+		log.Error("failed to list logins", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return logins, nil
+}
+
+// recordLogin adds a login attempt to the user's history and notifies the
+// user of a successful login from a new device or IP range. It is meant to
+// be deferred once the account is known; attempts that fail before that,
+// like an unknown email, aren't anyone's history. Failures here are logged
+// but don't fail the login.
+func (a *Auth) recordLogin(ctx context.Context, user *models.User, method string, client models.ClientInfo,
+	challenge *models.MFAChallenge, loginErr error,
+) {
+	if user == nil {
+		return
+	}
+
+	const op = "auth.recordLogin"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID))
+	// a client hanging up right after logging in must not skip the alert
+	ctx = context.WithoutCancel(ctx)
+
+	attempt := &models.LoginAttempt{
+		UserID:    user.ID,
+		Method:    method,
+		Result:    models.LoginSuccess,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+		Device:    deviceFingerprint(client.UserAgent),
+		IPRange:   ipRange(client.IP),
+	}
+	switch {
+	case loginErr != nil:
+		attempt.Result = models.LoginFailure
+	case challenge != nil:
+		attempt.Result = models.LoginMFARequired
+	}
+
+	// the origin has to be looked up before this login becomes part of it
+	var origin *models.LoginOrigin
+	if attempt.Result == models.LoginSuccess && a.loginNotifier != nil {
+		var err error
+		origin, err = a.loginHistory.LoginOrigin(ctx, user.ID, attempt.Device, attempt.IPRange)
+		if err != nil {
+			log.Error("failed to look up login origin", "err", err)
+		}
+	}
+
+	if err := a.loginHistory.SaveLoginAttempt(ctx, attempt); err != nil {
+		log.Error("failed to save login attempt", "err", err)
+	}
+
+	// the very first login has nothing to compare with
+	if origin == nil || origin.FirstLogin || (origin.KnownDevice && origin.KnownIPRange) {
+		return
+	}
+
+	if err := a.loginNotifier.NotifyNewLogin(ctx, user, attempt, origin); err != nil {
+		log.Error("failed to notify about new login", "err", err)
+		return
+	}
+
+	log.Info("new login origin notified",
+		slog.Bool("newDevice", !origin.KnownDevice),
+		slog.Bool("newIPRange", !origin.KnownIPRange),
+	)
+}
+
+// deviceFingerprint identifies the client software. The user agent is all a
+// plain login request tells about the device; only the browser family and OS
+// are kept, so a browser update isn't taken for a new device.
+func deviceFingerprint(userAgent string) string {
+	sum := sha256.Sum256([]byte(browserFamily(userAgent) + " on " + osFamily(userAgent)))
+	return hex.EncodeToString(sum[:])
+}
+
+// browserFamilies are matched in order: most browsers also name the engines
+// they are compatible with, e.g. Edge says Chrome and Safari too.
+var browserFamilies = []struct{ token, family string }{
+	{"Edg", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"Chrome/", "Chrome"},
+	{"CriOS/", "Chrome"},
+	{"Safari/", "Safari"},
+}
+
+func browserFamily(userAgent string) string {
+	for _, b := range browserFamilies {
+		if strings.Contains(userAgent, b.token) {
+			return b.family
+		}
+	}
+
+	// other clients, like curl/8.5.0, usually start with their product
+	product, _, _ := strings.Cut(userAgent, "/")
+	product, _, _ = strings.Cut(product, " ")
+	return product
+}
+
+var osFamilies = []struct{ token, family string }{
+	{"Windows", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"CrOS", "ChromeOS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"Linux", "Linux"},
+}
+
+func osFamily(userAgent string) string {
+	for _, o := range osFamilies {
+		if strings.Contains(userAgent, o.token) {
+			return o.family
+		}
+	}
+	return ""
+}
+
+// ipRange returns the /24 IPv4 or /48 IPv6 network of ip, roughly what a
+// home or office connection keeps across address changes. Unparsable
+// addresses are returned as is.
+func ipRange(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+	addr = addr.Unmap().WithZone("")
+
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+
+	return prefix.String()
+}
@@ -0,0 +1,55 @@
+package auth
+
+import "testing"
+
+func TestDeviceFingerprintIgnoresVersions(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		old, new string
+	}{
+		{
+			name: "chrome update",
+			old:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36",
+			new:  "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.71 Safari/537.36",
+		},
+		{
+			name: "ios update",
+			old:  "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Mobile/15E148 Safari/604.1",
+			new:  "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+		},
+		{
+			name: "firefox update",
+			old:  "Mozilla/5.0 (X11; Linux x86_64; rv:118.0) Gecko/20100101 Firefox/118.0",
+			new:  "Mozilla/5.0 (X11; Linux x86_64; rv:119.0) Gecko/20100101 Firefox/119.0",
+		},
+		{name: "cli update", old: "curl/8.4.0", new: "curl/8.5.0"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if deviceFingerprint(tc.old) != deviceFingerprint(tc.new) {
+				t.Error("new version taken for a new device")
+			}
+		})
+	}
+}
+
+func TestDeviceFingerprintTellsDevicesApart(t *testing.T) {
+	agents := map[string]string{
+		"Chrome on Windows": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Edge on Windows":   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.61",
+		"Chrome on Android": "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+		"Chrome on Linux":   "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+		"Safari on macOS":   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+		"Safari on iOS":     "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Mobile/15E148 Safari/604.1",
+		"Firefox on Linux":  "Mozilla/5.0 (X11; Linux x86_64; rv:119.0) Gecko/20100101 Firefox/119.0",
+		"curl":              "curl/8.5.0",
+	}
+
+	seen := make(map[string]string)
+	for device, userAgent := range agents {
+		fingerprint := deviceFingerprint(userAgent)
+		if other, ok := seen[fingerprint]; ok {
+			t.Errorf("%s and %s have the same fingerprint", device, other)
+		}
+		seen[fingerprint] = device
+	}
+}
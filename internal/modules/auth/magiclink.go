@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+)
+
+const magicLinkAudience = "magic_link"
+
+type MagicLinkStore interface {
+	// SaveMagicLink stores the link and sets its ID.
+	SaveMagicLink(ctx context.Context, link *models.MagicLink) error
+	// TakeMagicLink marks the link used if it was requested with the nonce.
+	// Unknown, used and expired links and other nonces are ErrInvalidToken.
+	TakeMagicLink(ctx context.Context, linkID, nonceHash string) (*models.MagicLink, error)
+}
+
+// RequestMagicLink mails a sign in link to the account owner and returns the
+// nonce the requesting browser has to keep; the link only works together
+// with it, so a forwarded link is useless. Like ForgotPassword it doesn't
+// reveal whether the email is registered: a nonce is returned either way.
+func (a *Auth) RequestMagicLink(ctx context.Context, email string) (nonce string, err error) {
+	const op = "auth.RequestMagicLink"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("magic link requested")
+
+	nonce, err = token.NewOpaque()
+	if err != nil {
+		log.Error("failed to generate nonce", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// directory users sign in with the directory password only
+	if _, ok := a.directoryFor(email); ok {
+		log.Warn("magic link for directory domain")
+		return nonce, nil
+	}
+
+	user, err := a.userProvider.ProvideUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("magic link for unknown email")
+			return nonce, nil
+		}
+		log.Error("failed to provide user", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("userID", user.ID))
+
+	if !user.IsActive {
+		log.Warn("magic link for blocked user")
+		return nonce, nil
+	}
+
+	link := &models.MagicLink{
+		UserID:    user.ID,
+		Email:     user.Email,
+		NonceHash: token.Hash(nonce),
+		ExpiresAt: time.Now().Add(a.cfg.MagicLinkTTL),
+	}
+	if err := a.magicLinkStore.SaveMagicLink(ctx, link); err != nil {
+		log.Error("failed to save magic link", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	linkToken, expiresAt, err := a.tokenManager.NewScopedToken(link.ID, magicLinkAudience, a.cfg.MagicLinkTTL)
+	if err != nil {
+		log.Error("failed to sign magic link", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	signInURL := a.cfg.PublicURL + "/login/magic-link/callback?token=" + url.QueryEscape(linkToken)
+	body := fmt.Sprintf("To sign in open %s\n\n"+
+		"The link works once, only in the browser you requested it from, and expires at %s. "+
+		"If you didn't request it, ignore this email.",
+		signInURL, expiresAt.UTC().Format(time.RFC1123))
+
+	if err := a.mailer.Send(ctx, user.Email, "Sign in link", body); err != nil {
+		log.Error("failed to send magic link", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("magic link sent")
+	return nonce, nil
+}
+
+// CompleteMagicLinkLogin signs in with a link from RequestMagicLink. nonce is
+// the value kept by the browser that opened the link. Only that browser can
+// burn the link, someone else opening it can't use it up for the owner. Like
+// Login, a challenge is returned instead of tokens if the user has a second
+// factor.
+func (a *Auth) CompleteMagicLinkLogin(ctx context.Context, linkToken, nonce string, client models.ClientInfo,
+) (tokens *models.Token, challenge *models.MFAChallenge, err error) {
+	const op = "auth.CompleteMagicLinkLogin"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("magic link login attempt")
+
+	event := newAuditEvent(models.AuditUserLogin, nil, nil, client, "method: magic link")
+	defer a.audit(ctx, event, &err)
+
+	claims, err := a.tokenManager.ParseScoped(linkToken, magicLinkAudience)
+	if err != nil {
+		log.Warn("invalid magic link token", "err", err)
+		return nil, nil, ErrInvalidToken
+	}
+
+	if nonce == "" {
+		log.Warn("magic link opened in another browser")
+		return nil, nil, ErrInvalidToken
+	}
+
+	link, err := a.magicLinkStore.TakeMagicLink(ctx, claims.Subject, token.Hash(nonce))
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("unknown, used or expired magic link, or opened in another browser")
+			return nil, nil, ErrInvalidToken
+		}
+		log.Error("failed to take magic link", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("userID", link.UserID))
+	event.ActorID, event.TargetID = &link.UserID, &link.UserID
+
+	user, err := a.userProvider.ProvideUser(ctx, link.Email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("magic link user is gone")
+			return nil, nil, ErrInvalidToken
+		}
+		log.Error("failed to provide user", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the email moved to another account since the link was sent
+	if user.ID != link.UserID {
+		log.Warn("magic link email changed owner")
+		return nil, nil, ErrInvalidToken
+	}
+
+	defer func() { a.recordLogin(ctx, user, models.LoginMethodMagicLink, client, challenge, err) }()
+
+	if err := a.checkCanLogin(user); err != nil {
+		log.Warn("login refused", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	mfaEnabled, err := a.TOTPEnabled(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to check second factor", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if mfaEnabled {
+		challenge, err := a.newMFAChallenge(user)
+		if err != nil {
+			log.Error("failed to issue mfa challenge", "err", err)
+			return nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		log.Info("second factor required")
+		event.Details += ", second factor required"
+		return nil, challenge, nil
+	}
+
+	tokens, err = a.issueTokens(ctx, user, client)
+	if err != nil {
+		log.Error("failed to issue tokens", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with magic link")
+
+	return tokens, nil, nil
+}
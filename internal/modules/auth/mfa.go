@@ -0,0 +1,287 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+	"web_auth/internal/utils/totp"
+)
+
+const (
+	mfaAudience        = "mfa"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+)
+
+// TOTPEnabled reports whether the user has a confirmed authenticator app.
+func (a *Auth) TOTPEnabled(ctx context.Context, userID int64) (bool, error) {
+	t, err := a.totpStore.TOTPByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotEnabled) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return t.ConfirmedAt != nil, nil
+}
+
+// EnrollTOTP generates a new secret for the user. The second factor only
+// becomes active after ConfirmTOTP.
+func (a *Auth) EnrollTOTP(ctx context.Context, user *models.User) (*models.TOTPEnrollment, error) {
+	const op = "auth.EnrollTOTP"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID))
+	log.Info("totp enrollment attempt")
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error("failed to generate totp secret", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.totpStore.SaveTOTPSecret(ctx, user.ID, secret); err != nil {
+		if errors.Is(err, ErrTOTPAlreadyEnabled) {
+			log.Warn("totp already enabled")
+			return nil, ErrTOTPAlreadyEnabled
+		}
+		log.Error("failed to save totp secret", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enrollment started")
+
+	return &models.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(a.cfg.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP activates the pending secret once the user proves their app
+// produces valid codes. The returned recovery codes are shown only once.
+func (a *Auth) ConfirmTOTP(ctx context.Context, userID int64, code string, client models.ClientInfo,
+) (_ []string, err error) {
+	const op = "auth.ConfirmTOTP"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+	log.Info("totp confirmation attempt")
+
+	defer a.audit(ctx, newAuditEvent(models.AuditTOTPEnable, &userID, &userID, client, ""), &err)
+
+	t, err := a.totpStore.TOTPByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrTOTPNotEnabled) {
+			return nil, ErrTOTPNotEnabled
+		}
+		log.Error("failed to get totp", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if t.ConfirmedAt != nil {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	if err := a.verifyTOTP(ctx, t, code); err != nil {
+		log.Warn("invalid totp code")
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		log.Error("failed to generate recovery codes", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.totpStore.ConfirmTOTP(ctx, userID, hashes); err != nil {
+		if errors.Is(err, ErrTOTPAlreadyEnabled) {
+			return nil, ErrTOTPAlreadyEnabled
+		}
+		log.Error("failed to confirm totp", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp enabled")
+
+	return codes, nil
+}
+
+// DisableTOTP removes the second factor. It requires a current code or an
+// unused recovery code.
+func (a *Auth) DisableTOTP(ctx context.Context, userID int64, code string, client models.ClientInfo) (err error) {
+	const op = "auth.DisableTOTP"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+	log.Info("totp disable attempt")
+
+	defer a.audit(ctx, newAuditEvent(models.AuditTOTPDisable, &userID, &userID, client, ""), &err)
+
+	if err := a.verifySecondFactor(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrInvalidOTP) || errors.Is(err, ErrTOTPNotEnabled) {
+			log.Warn("second factor rejected", "err", err)
+			return err
+		}
+		log.Error("failed to verify second factor", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.totpStore.DeleteTOTP(ctx, userID); err != nil {
+		log.Error("failed to delete totp", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("totp disabled")
+	return nil
+}
+
+// CompleteMFALogin finishes a login started by Login with the challenge token
+// and either a TOTP code or a recovery code.
+func (a *Auth) CompleteMFALogin(ctx context.Context, mfaToken, code string, client models.ClientInfo,
+) (tokens *models.Token, err error) {
+	const op = "auth.CompleteMFALogin"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("second factor login attempt")
+
+	event := newAuditEvent(models.AuditUserLogin, nil, nil, client, "method: second factor")
+	defer a.audit(ctx, event, &err)
+
+	claims, err := a.tokenManager.ParseScoped(mfaToken, mfaAudience)
+	if err != nil {
+		log.Warn("invalid mfa token", "err", err)
+		return nil, ErrInvalidToken
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	log = log.With(slog.Int64("userID", userID))
+	event.ActorID, event.TargetID = &userID, &userID
+
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return nil, ErrInvalidToken
+		}
+		log.Error("failed to get user", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	defer func() { a.recordLogin(ctx, user, models.LoginMethodSecondFactor, client, nil, err) }()
+
+	if err := a.checkCanLogin(user); err != nil {
+		log.Warn("login refused", "err", err)
+		return nil, err
+	}
+
+	attemptKeys := a.attemptKeys(user.Email, client.IP)
+	if err := a.checkLockout(ctx, attemptKeys); err != nil {
+		if errors.Is(err, ErrTooManyAttempts) {
+			log.Warn("second factor attempt while locked out")
+			return nil, err
+		}
+		log.Error("failed to check lockout", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.verifySecondFactor(ctx, userID, code); err != nil {
+		if errors.Is(err, ErrInvalidOTP) || errors.Is(err, ErrTOTPNotEnabled) {
+			log.Warn("second factor rejected", "err", err)
+			a.registerFailure(ctx, log, attemptKeys)
+			return nil, ErrInvalidOTP
+		}
+		log.Error("failed to verify second factor", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err = a.issueTokens(ctx, user, client)
+	if err != nil {
+		log.Error("failed to issue tokens", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.resetAttempts(ctx, log, user.Email)
+
+	log.Info("user logged in success")
+
+	return tokens, nil
+}
+
+func (a *Auth) newMFAChallenge(user *models.User) (*models.MFAChallenge, error) {
+	mfaToken, expiresAt, err := a.tokenManager.NewScopedToken(
+		strconv.FormatInt(user.ID, 10), mfaAudience, a.cfg.MFATokenTTL,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.MFAChallenge{
+		MFARequired: true,
+		MFAToken:    mfaToken,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// verifySecondFactor accepts a six digit TOTP code or a recovery code.
+func (a *Auth) verifySecondFactor(ctx context.Context, userID int64, code string) error {
+	t, err := a.totpStore.TOTPByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if t.ConfirmedAt == nil {
+		return ErrTOTPNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return a.verifyTOTP(ctx, t, code)
+	}
+
+	return a.totpStore.UseRecoveryCode(ctx, userID, token.Hash(normalizeRecoveryCode(code)))
+}
+
+// verifyTOTP checks code and burns its time step so it can't be replayed.
+func (a *Auth) verifyTOTP(ctx context.Context, t *models.TOTP, code string) error {
+	step, ok := totp.Validate(t.Secret, code, time.Now(), a.cfg.TOTPSkew)
+	if !ok {
+		return ErrInvalidOTP
+	}
+
+	return a.totpStore.UseTOTPStep(ctx, t.UserID, step)
+}
+
+func newRecoveryCodes() (codes, hashes []string, err error) {
+	enc := base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeLength)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		code := strings.ToLower(enc.EncodeToString(b))[:recoveryCodeLength]
+		code = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, token.Hash(normalizeRecoveryCode(code)))
+	}
+
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/totp"
+)
+
+// enableTOTP enrolls the user and confirms the app with the code of the
+// current step. It returns the secret and the recovery codes.
+func enableTOTP(t *testing.T, a *Auth, user *models.User) (string, []string) {
+	t.Helper()
+
+	enrollment, err := a.EnrollTOTP(context.Background(), user)
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatalf("totp.Code: %v", err)
+	}
+
+	recoveryCodes, err := a.ConfirmTOTP(context.Background(), user.ID, code, models.ClientInfo{})
+	if err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	return enrollment.Secret, recoveryCodes
+}
+
+// mfaLogin completes a login whose password was accepted with code.
+func mfaLogin(t *testing.T, a *Auth, user *models.User, code string) error {
+	t.Helper()
+
+	challenge, err := a.newMFAChallenge(user)
+	if err != nil {
+		t.Fatalf("newMFAChallenge: %v", err)
+	}
+
+	_, err = a.CompleteMFALogin(context.Background(), challenge.MFAToken, code,
+		models.ClientInfo{IP: "203.0.113.5", UserAgent: "test"})
+	return err
+}
+
+func TestTOTPStepCannotBeReused(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser("alice@example.com")
+	a := newTestAuth(t, store)
+	a.cfg.TOTPSkew = 1
+
+	secret, _ := enableTOTP(t, a, user)
+
+	// confirming the app used up the current step
+	current, _ := totp.Code(secret, totp.Step(time.Now()))
+	if err := mfaLogin(t, a, user, current); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("login with the confirmation code error = %v, want ErrInvalidOTP", err)
+	}
+
+	next, _ := totp.Code(secret, totp.Step(time.Now())+1)
+	if err := mfaLogin(t, a, user, next); err != nil {
+		t.Fatalf("login with the next code: %v", err)
+	}
+	if err := mfaLogin(t, a, user, next); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("replayed code error = %v, want ErrInvalidOTP", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser("alice@example.com")
+	a := newTestAuth(t, store)
+
+	_, recoveryCodes := enableTOTP(t, a, user)
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(recoveryCodes), recoveryCodeCount)
+	}
+
+	// codes are typed back loosely
+	typed := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", " "))
+	if err := mfaLogin(t, a, user, typed); err != nil {
+		t.Fatalf("login with a recovery code: %v", err)
+	}
+
+	if err := mfaLogin(t, a, user, recoveryCodes[0]); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("reused recovery code error = %v, want ErrInvalidOTP", err)
+	}
+	if err := mfaLogin(t, a, user, "aaaaa-bbbbb"); !errors.Is(err, ErrInvalidOTP) {
+		t.Fatalf("unknown recovery code error = %v, want ErrInvalidOTP", err)
+	}
+
+	// a recovery code also disables the second factor
+	if err := a.DisableTOTP(context.Background(), user.ID, recoveryCodes[1], models.ClientInfo{}); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if enabled, _ := a.TOTPEnabled(context.Background(), user.ID); enabled {
+		t.Error("second factor still enabled")
+	}
+}
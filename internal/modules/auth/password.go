@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/password"
+	"web_auth/internal/utils/token"
+)
+
+// ForgotPassword mails a single-use reset link to the account owner. It
+// reports success for unknown emails too, so it can't be used to probe which
+// addresses are registered.
+func (a *Auth) ForgotPassword(ctx context.Context, email string) error {
+	const op = "auth.ForgotPassword"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("password reset requested")
+
+	user, err := a.userProvider.ProvideUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("password reset for unknown email")
+			return nil
+		}
+		log.Error("failed to provide user", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("userID", user.ID))
+
+	if !user.IsActive {
+		log.Warn("password reset for blocked user")
+		return nil
+	}
+
+	raw, err := token.NewOpaque()
+	if err != nil {
+		log.Error("failed to generate reset token", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	expiresAt := time.Now().Add(a.cfg.PasswordResetTTL)
+	if err := a.resetStore.SavePasswordResetToken(ctx, user.ID, token.Hash(raw), expiresAt); err != nil {
+		log.Error("failed to save reset token", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the API has no page to enter the new password on, only a frontend can
+	// be linked to
+	body := fmt.Sprintf("To reset your password send this token to POST /password/reset: %s\n\n", raw)
+	if a.cfg.PasswordResetURL != "" {
+		link, err := url.Parse(a.cfg.PasswordResetURL)
+		if err != nil {
+			log.Error("invalid password reset url", "err", err)
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		q := link.Query()
+		q.Set("token", raw)
+		link.RawQuery = q.Encode()
+
+		body = fmt.Sprintf("To reset your password open %s\n\n", link)
+	}
+	body += fmt.Sprintf("The reset expires at %s. If you didn't request a reset, ignore this email.",
+		expiresAt.UTC().Format(time.RFC1123))
+
+	if err := a.mailer.Send(ctx, user.Email, "Password reset", body); err != nil {
+		log.Error("failed to send reset email", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password reset email sent")
+	return nil
+}
+
+// ResetPassword sets a new password using a token from ForgotPassword and logs
+// the user out of every session.
+func (a *Auth) ResetPassword(ctx context.Context, resetToken, newPassword string, client models.ClientInfo,
+) (err error) {
+	const op = "auth.ResetPassword"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("password reset attempt")
+
+	event := newAuditEvent(models.AuditPasswordReset, nil, nil, client, "")
+	defer a.audit(ctx, event, &err)
+
+	tokenHash := token.Hash(resetToken)
+
+	// The owner is looked up before the token is used up, the policy needs
+	// their email and a rejected password shouldn't cost them the link.
+	userID, err := a.resetStore.PasswordResetUser(ctx, tokenHash)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("invalid reset token")
+			return ErrInvalidToken
+		}
+		log.Error("failed to look up reset token", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	event.ActorID, event.TargetID = &userID, &userID
+
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("reset token user is gone", slog.Int64("userID", userID))
+			return ErrInvalidToken
+		}
+		log.Error("failed to get user", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.checkPasswordPolicy(log, newPassword, user.Email); err != nil {
+		return err
+	}
+
+	passwordHashed, err := a.hasher.Hash(newPassword)
+	if err != nil {
+		log.Error("failed to generate password hash", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	// the token may have been used in the meantime, only this burns it
+	userID, err = a.resetStore.ResetPassword(ctx, tokenHash, []byte(passwordHashed))
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("invalid reset token")
+			return ErrInvalidToken
+		}
+		log.Error("failed to reset password", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.RevokeAllSessions(ctx, userID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("password reset successfully", slog.Int64("userID", userID))
+	return nil
+}
+
+// PasswordPolicyError lists the rules a new password breaks. It matches
+// ErrWeakPassword with errors.Is.
+type PasswordPolicyError struct {
+	Violations []password.Violation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return ErrWeakPassword.Error()
+}
+
+func (e *PasswordPolicyError) Unwrap() error {
+	return ErrWeakPassword
+}
+
+// checkPasswordPolicy returns a *PasswordPolicyError if the password is
+// rejected. An unreadable breached list is logged rather than blocking every
+// password change.
+func (a *Auth) checkPasswordPolicy(log *slog.Logger, newPassword, email string) error {
+	violations, err := a.policy.Check(newPassword, email)
+	if err != nil {
+		log.Error("failed to check breached passwords", "err", err)
+	}
+
+	if len(violations) > 0 {
+		log.Warn("password rejected by policy", slog.Int("violations", len(violations)))
+		return &PasswordPolicyError{Violations: violations}
+	}
+
+	return nil
+}
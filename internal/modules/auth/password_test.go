@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+	"web_auth/internal/utils/password"
+	"web_auth/internal/utils/token"
+)
+
+func TestResetPasswordPolicyUsesEmail(t *testing.T) {
+	store := newMemStore()
+	a := newPasswordAuth(t, store)
+	user := addPasswordUser(t, a, store, "alice@example.com")
+
+	policy, err := password.NewPolicy(config.PasswordPolicy{MinLength: 8, DisallowEmail: true})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	a.policy = policy
+
+	const resetToken = "reset-token"
+	if err := store.SavePasswordResetToken(context.Background(), user.ID, token.Hash(resetToken), time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	err = a.ResetPassword(context.Background(), resetToken, "Alice-in-2026!", models.ClientInfo{})
+	var policyErr *PasswordPolicyError
+	if !errors.As(err, &policyErr) || len(policyErr.Violations) != 1 || policyErr.Violations[0].Code != password.CodeContainsEmail {
+		t.Fatalf("err = %v, want a contains_email violation", err)
+	}
+
+	// the rejected password doesn't use up the link
+	if err := a.ResetPassword(context.Background(), resetToken, "Wonderland-2026!", models.ClientInfo{}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if ok, _ := a.hasher.Verify(store.users[user.ID].PasswordHashed, "Wonderland-2026!"); !ok {
+		t.Error("new password not stored")
+	}
+
+	if err := a.ResetPassword(context.Background(), resetToken, "Wonderland-2027!", models.ClientInfo{}); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("second reset err = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"web_auth/internal/models"
+)
+
+// BootstrapAdmins grants the admin role to the accounts of
+// cfg.AdminEmails, so a fresh install gets its first administrator without
+// touching the database. Emails without an account or with an unconfirmed
+// address are skipped: whoever registered them first must not become admin.
+func (a *Auth) BootstrapAdmins(ctx context.Context) error {
+	const op = "auth.BootstrapAdmins"
+
+	log := a.log.With(slog.String("op", op))
+
+	for _, email := range a.cfg.AdminEmails {
+		if err := a.bootstrapAdmin(ctx, log, email); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+	}
+
+	return nil
+}
+
+func (a *Auth) bootstrapAdmin(ctx context.Context, log *slog.Logger, email string) (err error) {
+	user, err := a.userProvider.ProvideUser(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("admin email has no account yet", slog.String("email", email))
+			return nil
+		}
+		log.Error("failed to provide user", "err", err)
+		return err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		log.Warn("admin email not confirmed", slog.Int64("userID", user.ID))
+		return nil
+	}
+
+	roles, err := a.roleStore.UserRoles(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get user roles", "err", err)
+		return err
+	}
+	if slices.Contains(roles, models.RoleAdmin) {
+		return nil
+	}
+
+	defer a.audit(ctx, newAuditEvent(models.AuditRoleGrant, nil, &user.ID, models.ClientInfo{},
+		"role: "+models.RoleAdmin+", from auth.admin_emails"), &err)
+
+	if err := a.roleStore.AssignRole(ctx, user.ID, models.RoleAdmin); err != nil {
+		log.Error("failed to assign admin role", "err", err)
+		return err
+	}
+
+	log.Info("admin role granted", slog.Int64("userID", user.ID))
+	return nil
+}
+
+// HasPermission reports whether any of the user's roles grants permission.
+func (a *Auth) HasPermission(ctx context.Context, userID int64, permission string) (bool, error) {
+	const op = "auth.HasPermission"
+
+	permissions, err := a.roleStore.UserPermissions(ctx, userID)
+	if err != nil {
+		a.log.With(slog.String("op", op)).Error("failed to get user permissions", "err", err)
+		return false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return slices.Contains(permissions, permission), nil
+}
+
+// Authorize returns ErrForbidden unless the user holds permission and, for
+// API key requests, the key has it in its scopes. Admins additionally get
+// ErrMFARequired until they enable two-factor authentication.
+func (a *Auth) Authorize(ctx context.Context, user *models.User, permission string) error {
+	const op = "auth.Authorize"
+
+	log := a.log.With(slog.String("op", op))
+
+	if err := checkScope(user, permission); err != nil {
+		log.Warn("api key scope missing",
+			slog.Int64("userID", user.ID),
+			slog.String("permission", permission),
+		)
+		return err
+	}
+
+	ok, err := a.HasPermission(ctx, user.ID, permission)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		log.Warn("permission denied",
+			slog.Int64("userID", user.ID),
+			slog.String("permission", permission),
+		)
+		return ErrForbidden
+	}
+
+	if slices.Contains(user.Roles, models.RoleAdmin) {
+		enabled, err := a.TOTPEnabled(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !enabled {
+			log.Warn("admin without second factor", slog.Int64("userID", user.ID))
+			return ErrMFARequired
+		}
+	}
+
+	return nil
+}
+
+// AuthorizeOwnerOr lets users act on their own resources and requires
+// permission for anybody else's. API keys need permission in their scopes
+// even for the owner's resources.
+func (a *Auth) AuthorizeOwnerOr(ctx context.Context, user *models.User, ownerID int64, permission string) error {
+	if user.ID == ownerID {
+		return checkScope(user, permission)
+	}
+
+	return a.Authorize(ctx, user, permission)
+}
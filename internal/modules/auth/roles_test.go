@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"web_auth/internal/models"
+)
+
+func TestBootstrapAdmins(t *testing.T) {
+	store := newMemStore()
+	verified := store.addUser("root@example.com")
+	verifiedAt := time.Now()
+	verified.EmailVerifiedAt = &verifiedAt
+	unverified := store.addUser("squatter@example.com")
+
+	a := newTestAuth(t, store)
+	a.cfg.AdminEmails = []string{"root@example.com", "squatter@example.com", "nobody@example.com"}
+
+	// a restart must not grant the role again
+	for range 2 {
+		if err := a.BootstrapAdmins(context.Background()); err != nil {
+			t.Fatalf("BootstrapAdmins: %v", err)
+		}
+	}
+
+	if roles, _ := store.UserRoles(context.Background(), verified.ID); !slices.Contains(roles, models.RoleAdmin) {
+		t.Errorf("verified account roles = %v, want admin", roles)
+	}
+	if roles, _ := store.UserRoles(context.Background(), unverified.ID); slices.Contains(roles, models.RoleAdmin) {
+		t.Error("account with an unconfirmed email made admin")
+	}
+
+	var grants []models.AuditEvent
+	for _, event := range store.events {
+		if event.Type == models.AuditRoleGrant {
+			grants = append(grants, event)
+		}
+	}
+	if len(grants) != 1 || grants[0].TargetID == nil || *grants[0].TargetID != verified.ID ||
+		grants[0].Outcome != models.AuditOutcomeSuccess {
+		t.Errorf("role grants = %+v, want one for %d", grants, verified.ID)
+	}
+}
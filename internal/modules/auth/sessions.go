@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"web_auth/internal/models"
+)
+
+// Logout revokes the session the request was made with.
+func (a *Auth) Logout(ctx context.Context, userID int64, sessionID string) error {
+	const op = "auth.Logout"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("logout attempt", slog.Int64("userID", userID))
+
+	if err := a.sessionStore.RevokeSession(ctx, userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		log.Error("failed to revoke session", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged out", slog.Int64("userID", userID))
+	return nil
+}
+
+// ListSessions returns the user's live sessions, flagging currentID.
+func (a *Auth) ListSessions(ctx context.Context, userID int64, currentID string) ([]models.Session, error) {
+	const op = "auth.ListSessions"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("list sessions attempt", slog.Int64("userID", userID))
+
+	sessions, err := a.sessionStore.ListUserSessions(ctx, userID)
+	if err != nil {
+		log.Error("failed to list sessions", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends one of the user's sessions, e.g. a lost device.
+func (a *Auth) RevokeSession(ctx context.Context, userID int64, sessionID string, client models.ClientInfo,
+) (err error) {
+	const op = "auth.RevokeSession"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("revoke session attempt", slog.Int64("userID", userID), slog.String("sessionID", sessionID))
+
+	defer a.audit(ctx, newAuditEvent(models.AuditSessionRevoke, &userID, &userID, client, "session: "+sessionID), &err)
+
+	if err := a.sessionStore.RevokeSession(ctx, userID, sessionID); err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			log.Warn("session not found", slog.Int64("userID", userID))
+			return ErrSessionNotFound
+		}
+		log.Error("failed to revoke session", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("session revoked", slog.Int64("userID", userID))
+	return nil
+}
+
+// RevokeOtherSessions logs the user out on every device but the one making
+// the request.
+func (a *Auth) RevokeOtherSessions(ctx context.Context, userID int64, currentID string, client models.ClientInfo,
+) (err error) {
+	const op = "auth.RevokeOtherSessions"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("revoke other sessions attempt", slog.Int64("userID", userID))
+
+	defer a.audit(ctx, newAuditEvent(models.AuditSessionRevokeOthers, &userID, &userID, client, "kept session: "+currentID), &err)
+
+	if err := a.sessionStore.RevokeOtherSessions(ctx, userID, currentID); err != nil {
+		log.Error("failed to revoke other sessions", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("other sessions revoked", slog.Int64("userID", userID))
+	return nil
+}
+
+// RevokeAllSessions logs the user out everywhere.
+func (a *Auth) RevokeAllSessions(ctx context.Context, userID int64) error {
+	const op = "auth.RevokeAllSessions"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("revoke all sessions attempt", slog.Int64("userID", userID))
+
+	if err := a.sessionStore.RevokeUserSessions(ctx, userID); err != nil {
+		log.Error("failed to revoke sessions", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("all sessions revoked", slog.Int64("userID", userID))
+	return nil
+}
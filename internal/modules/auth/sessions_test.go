@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"web_auth/internal/models"
+)
+
+func TestRevokeOtherSessions(t *testing.T) {
+	store := newMemStore()
+	alice := store.addUser("alice@example.com")
+	bob := store.addUser("bob@example.com")
+	a := newTestAuth(t, store)
+
+	login := func(user *models.User) *models.Token {
+		t.Helper()
+
+		tokens, err := a.issueTokens(context.Background(), user, models.ClientInfo{IP: "203.0.113.5", UserAgent: "test"})
+		if err != nil {
+			t.Fatalf("issueTokens: %v", err)
+		}
+		return tokens
+	}
+
+	laptop, phone, bobs := login(alice), login(alice), login(bob)
+
+	_, current, err := a.AuthenticateAccessToken(context.Background(), laptop.AccessToken)
+	if err != nil {
+		t.Fatalf("AuthenticateAccessToken: %v", err)
+	}
+
+	if err := a.RevokeOtherSessions(context.Background(), alice.ID, current.ID, models.ClientInfo{}); err != nil {
+		t.Fatalf("RevokeOtherSessions: %v", err)
+	}
+
+	if _, _, err := a.AuthenticateAccessToken(context.Background(), phone.AccessToken); err == nil {
+		t.Error("other session still accepted")
+	}
+	if _, err := a.RefreshTokens(context.Background(), phone.RefreshToken); err == nil {
+		t.Error("other session still refreshes")
+	}
+	if _, _, err := a.AuthenticateAccessToken(context.Background(), laptop.AccessToken); err != nil {
+		t.Errorf("current session revoked: %v", err)
+	}
+	if _, _, err := a.AuthenticateAccessToken(context.Background(), bobs.AccessToken); err != nil {
+		t.Errorf("another user's session revoked: %v", err)
+	}
+}
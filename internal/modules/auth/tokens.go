@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+)
+
+// VerifyAccessToken checks the signature and expiry of an access token and
+// returns its claims.
+func (a *Auth) VerifyAccessToken(ctx context.Context, accessToken string) (*token.Claims, error) {
+	const op = "auth.VerifyAccessToken"
+
+	claims, err := a.tokenManager.Parse(accessToken)
+	if err != nil {
+		a.log.With(slog.String("op", op)).Debug("access token rejected", "err", err)
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// AuthenticateAccessToken verifies an access token and loads its owner and
+// session. Tokens of revoked sessions are rejected with ErrInvalidToken and
+// blocked users with ErrUserBlocked even if the token itself is valid.
+func (a *Auth) AuthenticateAccessToken(ctx context.Context, accessToken string) (*models.User, *models.Session, error) {
+	const op = "auth.AuthenticateAccessToken"
+
+	log := a.log.With(slog.String("op", op))
+
+	claims, err := a.VerifyAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil || claims.SessionID == "" {
+		log.Warn("malformed token claims", slog.String("sub", claims.Subject))
+		return nil, nil, ErrInvalidToken
+	}
+
+	session, err := a.sessionStore.SessionByID(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, ErrSessionNotFound) {
+			log.Warn("token session not found", slog.Int64("userID", userID))
+			return nil, nil, ErrInvalidToken
+		}
+		log.Error("failed to get session", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if session.UserID != userID || !session.Active(time.Now()) {
+		log.Warn("token of inactive session presented", slog.Int64("userID", userID))
+		return nil, nil, ErrInvalidToken
+	}
+
+	if err := a.checkActor(ctx, log, claims, session); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			log.Warn("token owner not found", slog.Int64("userID", userID))
+			return nil, nil, ErrInvalidToken
+		}
+		log.Error("failed to get user", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !user.IsActive {
+		log.Warn("blocked user presented access token", slog.Int64("userID", userID))
+		return nil, nil, ErrUserBlocked
+	}
+
+	user.Roles, err = a.roleStore.UserRoles(ctx, user.ID)
+	if err != nil {
+		log.Error("failed to get user roles", "err", err)
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.sessionStore.TouchSession(ctx, session.ID); err != nil {
+		log.Warn("failed to touch session", "err", err)
+	}
+
+	return user, session, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new access/refresh pair. Every
+// refresh token is single use: presenting one that was already rotated means
+// it has leaked, so the whole family is revoked.
+func (a *Auth) RefreshTokens(ctx context.Context, refreshToken string) (*models.Token, error) {
+	const op = "auth.RefreshTokens"
+
+	log := a.log.With(slog.String("op", op))
+
+	log.Info("refresh tokens attempt")
+
+	stored, err := a.tokenStore.RefreshTokenByHash(ctx, token.Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("unknown refresh token")
+			return nil, ErrInvalidToken
+		}
+		log.Error("failed to get refresh token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log = log.With(slog.Int64("userID", stored.UserID), slog.String("familyID", stored.FamilyID))
+
+	if stored.RevokedAt != nil {
+		log.Warn("revoked refresh token presented")
+		return nil, ErrInvalidToken
+	}
+
+	if stored.RotatedAt != nil {
+		return nil, a.revokeReusedFamily(ctx, log, stored)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		log.Warn("expired refresh token presented")
+		return nil, ErrInvalidToken
+	}
+
+	user, err := a.userProvider.GetUserByID(ctx, stored.UserID)
+	if err != nil {
+		log.Error("failed to get user", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !user.IsActive {
+		log.Warn("blocked user refresh attempt")
+		return nil, ErrUserBlocked
+	}
+
+	// the family's session, to carry over who acts as the user
+	session, err := a.sessionStore.SessionByID(ctx, stored.FamilyID)
+	if err != nil {
+		log.Error("failed to get session", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	raw, hash, refreshExpiresAt, err := a.tokenManager.NewRefreshToken()
+	if err != nil {
+		log.Error("failed to issue refresh token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	// impersonation ends with its session, refreshing can't extend it
+	if session.ExpiresAt.Before(refreshExpiresAt) {
+		refreshExpiresAt = session.ExpiresAt
+	}
+
+	next := &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  stored.FamilyID,
+		TokenHash: hash,
+		ExpiresAt: refreshExpiresAt,
+	}
+
+	if err := a.tokenStore.RotateRefreshToken(ctx, stored.ID, next); err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			// Lost a race against another refresh with the same token.
+			return nil, a.revokeReusedFamily(ctx, log, stored)
+		}
+		log.Error("failed to rotate refresh token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err := a.tokenResponse(user, session, raw)
+	if err != nil {
+		log.Error("failed to issue access token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("tokens refreshed successfully")
+
+	return tokens, nil
+}
+
+func (a *Auth) revokeReusedFamily(ctx context.Context, log *slog.Logger, stored *models.RefreshToken) error {
+	log.Warn("refresh token reuse detected, revoking token family")
+
+	if err := a.tokenStore.RevokeTokenFamily(ctx, stored.FamilyID); err != nil {
+		log.Error("failed to revoke token family", "err", err)
+		return fmt.Errorf("auth.revokeReusedFamily: %w", err)
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// issueTokens starts a new session for the user's device. The session id
+// doubles as the refresh token family id.
+func (a *Auth) issueTokens(ctx context.Context, user *models.User, client models.ClientInfo) (*models.Token, error) {
+	raw, hash, refreshExpiresAt, err := a.tokenManager.NewRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+		ExpiresAt: refreshExpiresAt,
+	}
+
+	refresh := &models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: refreshExpiresAt,
+	}
+
+	if err := a.sessionStore.CreateSession(ctx, session, refresh); err != nil {
+		return nil, err
+	}
+
+	return a.tokenResponse(user, session, raw)
+}
+
+func (a *Auth) tokenResponse(user *models.User, session *models.Session, refreshToken string) (*models.Token, error) {
+	accessToken, expiresAt, err := a.tokenManager.NewAccessToken(user, session)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Token{
+		AccessToken:  accessToken,
+		TokenType:    tokenTypeBearer,
+		ExpiresAt:    expiresAt,
+		RefreshToken: refreshToken,
+	}, nil
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"web_auth/internal/models"
+)
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	store := newMemStore()
+	user := store.addUser("alice@example.com")
+	a := newTestAuth(t, store)
+
+	first, err := a.issueTokens(context.Background(), user, models.ClientInfo{IP: "203.0.113.5", UserAgent: "test"})
+	if err != nil {
+		t.Fatalf("issueTokens: %v", err)
+	}
+
+	second, err := a.RefreshTokens(context.Background(), first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token not rotated")
+	}
+
+	// the rotated token turning up again means it leaked
+	if _, err := a.RefreshTokens(context.Background(), first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token error = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// whoever holds the current token is logged out too
+	if _, err := a.RefreshTokens(context.Background(), second.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("token after reuse error = %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := a.AuthenticateAccessToken(context.Background(), second.AccessToken); err == nil {
+		t.Error("access token of the revoked family still accepted")
+	}
+}
+
+func TestRefreshTokensUnknown(t *testing.T) {
+	a := newTestAuth(t, newMemStore())
+
+	if _, err := a.RefreshTokens(context.Background(), "forged"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("RefreshTokens error = %v, want ErrInvalidToken", err)
+	}
+}
@@ -0,0 +1,340 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"web_auth/internal/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	ceremonyRegistration = "registration"
+	ceremonyLogin        = "login"
+
+	defaultCeremonyTTL = 5 * time.Minute
+)
+
+// requireUserVerification makes the authenticator check a PIN or biometric,
+// a passkey login skips the second factor only because of it.
+func requireUserVerification(options *protocol.PublicKeyCredentialCreationOptions) {
+	options.AuthenticatorSelection.UserVerification = protocol.VerificationRequired
+}
+
+// webAuthnUser adapts models.User to webauthn.User. The user handle is the
+// decimal user id.
+type webAuthnUser struct {
+	user        *models.User
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatInt(u.user.ID, 10))
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.user.Email
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// BeginWebAuthnRegistration starts adding a passkey to the user's account.
+func (a *Auth) BeginWebAuthnRegistration(ctx context.Context, user *models.User) (*models.WebAuthnCeremony, error) {
+	const op = "auth.BeginWebAuthnRegistration"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID))
+	log.Info("passkey registration attempt")
+
+	waUser, err := a.loadWebAuthnUser(ctx, user)
+	if err != nil {
+		log.Error("failed to load credentials", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(waUser.credentials))
+	for _, credential := range waUser.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	creation, session, err := a.passkeys.BeginRegistration(waUser,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		requireUserVerification,
+	)
+	if err != nil {
+		log.Error("failed to begin registration", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := a.saveCeremony(ctx, ceremonyRegistration, user.ID, session)
+	if err != nil {
+		log.Error("failed to save ceremony", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.WebAuthnCeremony{ID: id, Options: creation}, nil
+}
+
+// FinishWebAuthnRegistration verifies the attestation and stores the new
+// credential's public key.
+func (a *Auth) FinishWebAuthnRegistration(ctx context.Context, user *models.User, ceremonyID string, response []byte) error {
+	const op = "auth.FinishWebAuthnRegistration"
+
+	log := a.log.With(slog.String("op", op), slog.Int64("userID", user.ID))
+
+	ownerID, session, err := a.takeCeremony(ctx, ceremonyRegistration, ceremonyID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("unknown registration ceremony")
+			return ErrInvalidToken
+		}
+		log.Error("failed to load ceremony", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if ownerID != user.ID {
+		log.Warn("registration ceremony of another user", slog.Int64("ownerID", ownerID))
+		return ErrInvalidToken
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		log.Warn("malformed attestation", "err", err)
+		return ErrWebAuthnFailed
+	}
+
+	waUser, err := a.loadWebAuthnUser(ctx, user)
+	if err != nil {
+		log.Error("failed to load credentials", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	credential, err := a.passkeys.CreateCredential(waUser, *session, parsed)
+	if err != nil {
+		log.Warn("attestation rejected", "err", err)
+		return ErrWebAuthnFailed
+	}
+
+	if err := a.webAuthnStore.SaveWebAuthnCredential(ctx, user.ID, credential); err != nil {
+		if errors.Is(err, ErrCredentialExists) {
+			log.Warn("credential already registered")
+			return ErrCredentialExists
+		}
+		log.Error("failed to save credential", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("passkey registered")
+	return nil
+}
+
+// BeginWebAuthnLogin starts a passkey login. With an empty email the
+// authenticator is asked for a discoverable credential instead.
+func (a *Auth) BeginWebAuthnLogin(ctx context.Context, email string) (*models.WebAuthnCeremony, error) {
+	const op = "auth.BeginWebAuthnLogin"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("passkey login attempt")
+
+	var (
+		assertion *protocol.CredentialAssertion
+		session   *webauthn.SessionData
+		userID    int64
+		err       error
+	)
+
+	if email == "" {
+		assertion, session, err = a.passkeys.BeginDiscoverableLogin(
+			webauthn.WithUserVerification(protocol.VerificationRequired))
+	} else {
+		user, provideErr := a.userProvider.ProvideUser(ctx, email)
+		if provideErr != nil {
+			if errors.Is(provideErr, ErrUserNotFound) {
+				log.Warn("user not found")
+				return nil, ErrInvalidCredentials
+			}
+			log.Error("failed to provide user", "err", provideErr)
+			return nil, fmt.Errorf("%s: %w", op, provideErr)
+		}
+
+		waUser, loadErr := a.loadWebAuthnUser(ctx, user)
+		if loadErr != nil {
+			log.Error("failed to load credentials", "err", loadErr)
+			return nil, fmt.Errorf("%s: %w", op, loadErr)
+		}
+
+		if len(waUser.credentials) == 0 {
+			log.Warn("user has no passkeys", slog.Int64("userID", user.ID))
+			return nil, ErrInvalidCredentials
+		}
+
+		userID = user.ID
+		assertion, session, err = a.passkeys.BeginLogin(waUser,
+			webauthn.WithUserVerification(protocol.VerificationRequired))
+	}
+	if err != nil {
+		log.Error("failed to begin login", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	id, err := a.saveCeremony(ctx, ceremonyLogin, userID, session)
+	if err != nil {
+		log.Error("failed to save ceremony", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &models.WebAuthnCeremony{ID: id, Options: assertion}, nil
+}
+
+// FinishWebAuthnLogin verifies the assertion and logs the credential owner in.
+// A passkey proves possession and, with the required user verification,
+// knowledge or inherence, so no TOTP challenge follows.
+func (a *Auth) FinishWebAuthnLogin(ctx context.Context, ceremonyID string, response []byte, client models.ClientInfo,
+) (tokens *models.Token, err error) {
+	const op = "auth.FinishWebAuthnLogin"
+
+	log := a.log.With(slog.String("op", op))
+
+	event := newAuditEvent(models.AuditUserLogin, nil, nil, client, "method: passkey")
+	defer a.audit(ctx, event, &err)
+
+	userID, session, err := a.takeCeremony(ctx, ceremonyLogin, ceremonyID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Warn("unknown login ceremony")
+			return nil, ErrInvalidToken
+		}
+		log.Error("failed to load ceremony", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		log.Warn("malformed assertion", "err", err)
+		return nil, ErrWebAuthnFailed
+	}
+
+	var (
+		waUser     *webAuthnUser
+		credential *webauthn.Credential
+	)
+
+	if userID == 0 {
+		var found webauthn.User
+		found, credential, err = a.passkeys.ValidatePasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			handleID, err := strconv.ParseInt(string(userHandle), 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			return a.webAuthnUserByID(ctx, handleID)
+		}, *session, parsed)
+		if err == nil {
+			waUser = found.(*webAuthnUser)
+		}
+	} else {
+		waUser, err = a.webAuthnUserByID(ctx, userID)
+		if err != nil {
+			log.Error("failed to load user", "err", err)
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		credential, err = a.passkeys.ValidateLogin(waUser, *session, parsed)
+	}
+	if err != nil {
+		log.Warn("assertion rejected", "err", err)
+		return nil, ErrWebAuthnFailed
+	}
+
+	log = log.With(slog.Int64("userID", waUser.user.ID))
+	event.ActorID, event.TargetID = &waUser.user.ID, &waUser.user.ID
+	defer func() { a.recordLogin(ctx, waUser.user, models.LoginMethodPasskey, client, nil, err) }()
+
+	// the ceremony demands it, but a login must never pass on possession alone
+	if !credential.Flags.UserVerified {
+		log.Warn("assertion without user verification")
+		return nil, ErrWebAuthnFailed
+	}
+
+	if credential.Authenticator.CloneWarning {
+		log.Warn("authenticator sign counter went backwards, possible cloned key")
+		return nil, ErrWebAuthnFailed
+	}
+
+	if err := a.checkCanLogin(waUser.user); err != nil {
+		log.Warn("login refused", "err", err)
+		return nil, err
+	}
+
+	if err := a.webAuthnStore.UpdateWebAuthnCredential(ctx, credential); err != nil {
+		log.Error("failed to update credential", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	tokens, err = a.issueTokens(ctx, waUser.user, client)
+	if err != nil {
+		log.Error("failed to issue tokens", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("user logged in with passkey")
+
+	return tokens, nil
+}
+
+func (a *Auth) webAuthnUserByID(ctx context.Context, userID int64) (*webAuthnUser, error) {
+	user, err := a.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.loadWebAuthnUser(ctx, user)
+}
+
+func (a *Auth) loadWebAuthnUser(ctx context.Context, user *models.User) (*webAuthnUser, error) {
+	credentials, err := a.webAuthnStore.WebAuthnCredentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &webAuthnUser{user: user, credentials: credentials}, nil
+}
+
+func (a *Auth) saveCeremony(ctx context.Context, kind string, userID int64, session *webauthn.SessionData) (string, error) {
+	raw, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := session.Expires
+	if expiresAt.IsZero() {
+		expiresAt = time.Now().Add(defaultCeremonyTTL)
+	}
+
+	return a.webAuthnStore.SaveWebAuthnCeremony(ctx, kind, userID, raw, expiresAt)
+}
+
+func (a *Auth) takeCeremony(ctx context.Context, kind, ceremonyID string) (int64, *webauthn.SessionData, error) {
+	userID, raw, err := a.webAuthnStore.TakeWebAuthnCeremony(ctx, kind, ceremonyID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return 0, nil, err
+	}
+
+	return userID, &session, nil
+}
@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"web_auth/internal/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+const (
+	testRPID   = "example.test"
+	testOrigin = "https://example.test"
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// softAuthenticator is a passkey held in memory. It answers ceremonies the
+// way a platform authenticator would, with "none" attestation.
+type softAuthenticator struct {
+	t          *testing.T
+	key        *ecdsa.PrivateKey
+	credID     []byte
+	userHandle []byte
+	counter    uint32
+	// verifyUser sets the UV flag, as if a PIN or biometric was checked.
+	verifyUser bool
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	credID := make([]byte, 16)
+	if _, err := rand.Read(credID); err != nil {
+		t.Fatalf("generate credential id: %v", err)
+	}
+
+	return &softAuthenticator{t: t, key: key, credID: credID, verifyUser: true}
+}
+
+func (s *softAuthenticator) flags() byte {
+	flags := byte(flagUserPresent)
+	if s.verifyUser {
+		flags |= flagUserVerified
+	}
+	return flags
+}
+
+func (s *softAuthenticator) clientData(kind string, challenge protocol.URLEncodedBase64) []byte {
+	data, err := json.Marshal(map[string]string{
+		"type":      kind,
+		"challenge": challenge.String(),
+		"origin":    testOrigin,
+	})
+	if err != nil {
+		s.t.Fatalf("marshal client data: %v", err)
+	}
+	return data
+}
+
+// register answers navigator.credentials.create().
+func (s *softAuthenticator) register(options interface{}) []byte {
+	s.t.Helper()
+
+	creation := options.(*protocol.CredentialCreation)
+	s.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	coseKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: s.key.X.FillBytes(make([]byte, 32)),
+		-3: s.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		s.t.Fatalf("marshal cose key: %v", err)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	authData := append([]byte(nil), rpIDHash[:]...)
+	authData = append(authData, s.flags()|flagAttestedData)
+	authData = binary.BigEndian.AppendUint32(authData, s.counter)
+	authData = append(authData, make([]byte, 16)...) // aaguid
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(s.credID)))
+	authData = append(authData, s.credID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		s.t.Fatalf("marshal attestation: %v", err)
+	}
+
+	return s.response(map[string]string{
+		"clientDataJSON":    b64(s.clientData("webauthn.create", creation.Response.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// assert answers navigator.credentials.get().
+func (s *softAuthenticator) assert(options interface{}) []byte {
+	s.t.Helper()
+
+	assertion := options.(*protocol.CredentialAssertion)
+	s.counter++
+
+	rpIDHash := sha256.Sum256([]byte(testRPID))
+	authData := append([]byte(nil), rpIDHash[:]...)
+	authData = append(authData, s.flags())
+	authData = binary.BigEndian.AppendUint32(authData, s.counter)
+
+	clientData := s.clientData("webauthn.get", assertion.Response.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, s.key, digest[:])
+	if err != nil {
+		s.t.Fatalf("sign assertion: %v", err)
+	}
+
+	return s.response(map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(s.userHandle),
+	})
+}
+
+func (s *softAuthenticator) response(response map[string]string) []byte {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":       b64(s.credID),
+		"rawId":    b64(s.credID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		s.t.Fatalf("marshal response: %v", err)
+	}
+	return body
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func newPasskeyAuth(t *testing.T, store *memStore) *Auth {
+	t.Helper()
+
+	passkeys, err := webauthn.New(&webauthn.Config{
+		RPID:          testRPID,
+		RPDisplayName: "web_auth",
+		RPOrigins:     []string{testOrigin},
+	})
+	if err != nil {
+		t.Fatalf("webauthn.New: %v", err)
+	}
+
+	a := newTestAuth(t, store)
+	a.passkeys = passkeys
+	return a
+}
+
+// registerPasskey runs a registration ceremony for user with authenticator.
+func registerPasskey(t *testing.T, a *Auth, user *models.User, authenticator *softAuthenticator) error {
+	t.Helper()
+
+	ceremony, err := a.BeginWebAuthnRegistration(context.Background(), user)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnRegistration: %v", err)
+	}
+
+	return a.FinishWebAuthnRegistration(context.Background(), user, ceremony.ID, authenticator.register(ceremony.Options))
+}
+
+// loginWithPasskey runs a login ceremony, discoverable if email is empty.
+func loginWithPasskey(t *testing.T, a *Auth, email string, authenticator *softAuthenticator) (*models.Token, error) {
+	t.Helper()
+
+	ceremony, err := a.BeginWebAuthnLogin(context.Background(), email)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+
+	return a.FinishWebAuthnLogin(context.Background(), ceremony.ID, authenticator.assert(ceremony.Options),
+		models.ClientInfo{IP: "203.0.113.5", UserAgent: "test"})
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		email string
+	}{
+		{name: "by email", email: "alice@example.com"},
+		{name: "discoverable"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newMemStore()
+			a := newPasskeyAuth(t, store)
+			user := store.addUser("alice@example.com")
+			authenticator := newSoftAuthenticator(t)
+
+			if err := registerPasskey(t, a, user, authenticator); err != nil {
+				t.Fatalf("FinishWebAuthnRegistration: %v", err)
+			}
+
+			tokens, err := loginWithPasskey(t, a, tc.email, authenticator)
+			if err != nil {
+				t.Fatalf("FinishWebAuthnLogin: %v", err)
+			}
+			if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+				t.Fatalf("tokens not issued: %+v", tokens)
+			}
+
+			claims, err := a.tokenManager.Parse(tokens.AccessToken)
+			if err != nil {
+				t.Fatalf("parse access token: %v", err)
+			}
+			if id, _ := claims.UserID(); id != user.ID {
+				t.Errorf("access token subject = %d, want %d", id, user.ID)
+			}
+
+			credentials, _ := store.WebAuthnCredentials(context.Background(), user.ID)
+			if got := credentials[0].Authenticator.SignCount; got != authenticator.counter {
+				t.Errorf("stored sign count = %d, want %d", got, authenticator.counter)
+			}
+		})
+	}
+}
+
+func TestPasskeyLoginRequiresUserVerification(t *testing.T) {
+	store := newMemStore()
+	a := newPasskeyAuth(t, store)
+	user := store.addUser("alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+
+	if err := registerPasskey(t, a, user, authenticator); err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+
+	ceremony, err := a.BeginWebAuthnLogin(context.Background(), user.Email)
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+	options := ceremony.Options.(*protocol.CredentialAssertion)
+	if options.Response.UserVerification != protocol.VerificationRequired {
+		t.Errorf("user verification = %q, want required", options.Response.UserVerification)
+	}
+
+	// a security key without a PIN only proves possession
+	authenticator.verifyUser = false
+	_, err = a.FinishWebAuthnLogin(context.Background(), ceremony.ID, authenticator.assert(ceremony.Options),
+		models.ClientInfo{})
+	if !errors.Is(err, ErrWebAuthnFailed) {
+		t.Fatalf("FinishWebAuthnLogin error = %v, want ErrWebAuthnFailed", err)
+	}
+
+	if _, ok := store.lastEvent(models.AuditUserLogin); !ok {
+		t.Error("failed login not audited")
+	}
+}
+
+func TestPasskeyRegistrationRequiresUserVerification(t *testing.T) {
+	store := newMemStore()
+	a := newPasskeyAuth(t, store)
+	user := store.addUser("alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+	authenticator.verifyUser = false
+
+	if err := registerPasskey(t, a, user, authenticator); !errors.Is(err, ErrWebAuthnFailed) {
+		t.Fatalf("FinishWebAuthnRegistration error = %v, want ErrWebAuthnFailed", err)
+	}
+
+	if credentials, _ := store.WebAuthnCredentials(context.Background(), user.ID); len(credentials) != 0 {
+		t.Errorf("credential stored without user verification")
+	}
+}
+
+func TestPasskeyLoginCeremonyIsSingleUse(t *testing.T) {
+	store := newMemStore()
+	a := newPasskeyAuth(t, store)
+	user := store.addUser("alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+
+	if err := registerPasskey(t, a, user, authenticator); err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+
+	ceremony, err := a.BeginWebAuthnLogin(context.Background(), "")
+	if err != nil {
+		t.Fatalf("BeginWebAuthnLogin: %v", err)
+	}
+	response := authenticator.assert(ceremony.Options)
+
+	if _, err := a.FinishWebAuthnLogin(context.Background(), ceremony.ID, response, models.ClientInfo{}); err != nil {
+		t.Fatalf("first FinishWebAuthnLogin: %v", err)
+	}
+	_, err = a.FinishWebAuthnLogin(context.Background(), ceremony.ID, response, models.ClientInfo{})
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("replayed FinishWebAuthnLogin error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestPasskeyLoginRejectsForeignKey(t *testing.T) {
+	store := newMemStore()
+	a := newPasskeyAuth(t, store)
+	user := store.addUser("alice@example.com")
+	authenticator := newSoftAuthenticator(t)
+
+	if err := registerPasskey(t, a, user, authenticator); err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+
+	// same credential id, different private key
+	forged := newSoftAuthenticator(t)
+	forged.credID = authenticator.credID
+	forged.userHandle = authenticator.userHandle
+
+	if _, err := loginWithPasskey(t, a, user.Email, forged); !errors.Is(err, ErrWebAuthnFailed) {
+		t.Fatalf("FinishWebAuthnLogin error = %v, want ErrWebAuthnFailed", err)
+	}
+}
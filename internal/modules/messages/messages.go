@@ -2,25 +2,45 @@ package messages
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
+	"unicode/utf8"
 	"web_auth/internal/models"
 )
 
+const (
+	senderUser = "user"
+
+	maxMessageLength = 4000
+)
+
+var ErrInvalidMessage = errors.New("message must be 1 to 4000 characters")
+
 type MessageService struct {
 	log         *slog.Logger
 	msgProvider MessageProvider
+	msgSaver    MessageSaver
 }
 
 type MessageProvider interface {
 	GetUserMessages(ctx context.Context, userID int64, limit, offset int) ([]models.Message, error)
+	GetGuestMessages(ctx context.Context, guestID int64, limit, offset int) ([]models.Message, error)
+}
+
+type MessageSaver interface {
+	SaveMessage(ctx context.Context, message *models.Message) error
 }
 
 func New(log *slog.Logger,
 	messageProvider MessageProvider,
+	messageSaver MessageSaver,
 ) *MessageService {
 	return &MessageService{
 		msgProvider: messageProvider,
+		msgSaver:    messageSaver,
 		log:         log,
 	}
 }
@@ -33,10 +53,56 @@ func (a *MessageService) GetUserMessages(ctx context.Context, userID int64, limi
 
 	messages, err := a.msgProvider.GetUserMessages(ctx, userID, limit, offset)
 	if err != nil {
-		log.Error("failed to get user messages", err)
+		log.Error("failed to get user messages", "err", err)
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
 
 	log.Info("user messages retrieved successfully", slog.Int("count", len(messages)))
 	return messages, nil
 }
+
+func (a *MessageService) GetGuestMessages(ctx context.Context, guestID int64, limit, offset int) ([]models.Message, error) {
+	const op = "messages.GetGuestMessages"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("get guest messages attempt", slog.Int64("guestID", guestID))
+
+	messages, err := a.msgProvider.GetGuestMessages(ctx, guestID, limit, offset)
+	if err != nil {
+		log.Error("failed to get guest messages", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("guest messages retrieved successfully", slog.Int("count", len(messages)))
+	return messages, nil
+}
+
+// CreateGuestMessage stores a message written by the guest. It moves to the
+// account the guest registers later, like the rest of the guest's data.
+func (a *MessageService) CreateGuestMessage(ctx context.Context, guestID int64, text string) (*models.Message, error) {
+	const op = "messages.CreateGuestMessage"
+
+	log := a.log.With(slog.String("op", op))
+	log.Info("create guest message attempt", slog.Int64("guestID", guestID))
+
+	text = strings.TrimSpace(text)
+	if text == "" || utf8.RuneCountInString(text) > maxMessageLength {
+		log.Warn("invalid message length")
+		return nil, ErrInvalidMessage
+	}
+
+	message := &models.Message{
+		AnonymousUserID: &guestID,
+		MessageText:     text,
+		SenderType:      senderUser,
+		CreatedAt:       time.Now(),
+	}
+
+	if err := a.msgSaver.SaveMessage(ctx, message); err != nil {
+		log.Error("failed to save guest message", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("guest message created successfully", slog.Int64("messageID", message.ID))
+	return message, nil
+}
@@ -0,0 +1,36 @@
+package oauth
+
+import (
+	"context"
+	"log/slog"
+
+	"web_auth/internal/models"
+)
+
+// newAuditEvent describes an administrative action on the server. Clients
+// aren't users, so the events have no target.
+func newAuditEvent(eventType string, actorID int64, info models.ClientInfo, details string) *models.AuditEvent {
+	return &models.AuditEvent{
+		Type:      eventType,
+		ActorID:   &actorID,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		Details:   details,
+	}
+}
+
+// audit records event with the outcome of *errp, see auth.Auth.audit.
+func (s *Server) audit(ctx context.Context, event *models.AuditEvent, errp *error) {
+	event.Outcome = models.AuditOutcomeSuccess
+	if *errp != nil {
+		event.Outcome = models.AuditOutcomeFailure
+		if event.Details != "" {
+			event.Details += ": "
+		}
+		event.Details += (*errp).Error()
+	}
+
+	if err := s.auditLog.Record(context.WithoutCancel(ctx), event); err != nil {
+		s.log.Error("failed to record audit event", slog.String("type", event.Type), "err", err)
+	}
+}
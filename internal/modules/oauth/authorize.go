@@ -0,0 +1,147 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+
+	"github.com/google/uuid"
+)
+
+const pkceMethodS256 = "S256"
+
+// AuthorizeRequest holds the authorization endpoint parameters.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	// Nonce is echoed in the ID token of OpenID Connect requests.
+	Nonce string
+}
+
+// Authorize grants the client an authorization code on behalf of the signed
+// in user and returns the URL to send the user back to. Errors that can be
+// reported to the client are encoded into that URL as well. An *Error is
+// returned when the client or redirect uri can't be trusted, those must be
+// shown to the user instead.
+func (s *Server) Authorize(ctx context.Context, user *models.User, req AuthorizeRequest) (string, error) {
+	const op = "oauth.Authorize"
+
+	log := s.log.With(slog.String("op", op), slog.String("clientID", req.ClientID), slog.Int64("userID", user.ID))
+	log.Info("authorization attempt")
+
+	client, err := s.clientStore.OAuthClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			log.Warn("unknown client")
+			return "", newError(CodeInvalidRequest, "unknown client")
+		}
+		log.Error("failed to get client", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	redirectURI := req.RedirectURI
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		log.Warn("unregistered redirect uri", slog.String("redirectURI", req.RedirectURI))
+		return "", newError(CodeInvalidRequest, "redirect_uri is not registered for the client")
+	}
+
+	redirectErr := func(e *Error) (string, error) {
+		log.Warn("authorization refused", slog.String("error", e.Code), slog.String("description", e.Description))
+		return redirectWith(redirectURI, url.Values{
+			"error":             {e.Code},
+			"error_description": {e.Description},
+			"state":             {req.State},
+		}), nil
+	}
+
+	if req.ResponseType != "code" {
+		return redirectErr(newError(CodeUnsupportedResponseType, "only response_type=code is supported"))
+	}
+
+	if !client.AllowsGrant(models.GrantAuthorizationCode) {
+		return redirectErr(newError(CodeUnauthorizedClient, "client may not use authorization_code"))
+	}
+
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != pkceMethodS256 {
+		return redirectErr(newError(CodeInvalidRequest, "PKCE with code_challenge_method=S256 is required"))
+	}
+
+	scopes := parseScope(req.Scope)
+	if !subset(scopes, client.Scopes) {
+		return redirectErr(newError(CodeInvalidScope, "requested scope is not allowed for the client"))
+	}
+
+	raw, err := token.NewOpaque()
+	if err != nil {
+		log.Error("failed to generate authorization code", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	code := &models.OAuthCode{
+		CodeHash:      token.Hash(raw),
+		GrantID:       uuid.NewString(),
+		ClientID:      client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		ExpiresAt:     time.Now().Add(s.cfg.AuthorizationCodeTTL),
+	}
+
+	if err := s.codeStore.SaveAuthorizationCode(ctx, code); err != nil {
+		log.Error("failed to save authorization code", "err", err)
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("authorization code issued")
+
+	return redirectWith(redirectURI, url.Values{
+		"code":  {raw},
+		"state": {req.State},
+	}), nil
+}
+
+// redirectWith adds params to the redirect uri, keeping its own query and
+// dropping empty values.
+func redirectWith(redirectURI string, params url.Values) string {
+	u, _ := url.Parse(redirectURI)
+
+	q := u.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			q.Set(key, values[0])
+		}
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// verifyPKCE checks the code verifier against an S256 challenge (RFC 7636).
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
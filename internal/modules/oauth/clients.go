@@ -0,0 +1,190 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+
+	"web_auth/internal/models"
+	"web_auth/internal/utils/token"
+)
+
+// ClientRegistration describes a client to register. Public clients, e.g.
+// single page or mobile apps, get no secret and must use PKCE.
+type ClientRegistration struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+func (s *Server) RegisterClient(ctx context.Context, actorID int64, reg ClientRegistration, info models.ClientInfo,
+) (_ *models.NewOAuthClient, err error) {
+	const op = "oauth.RegisterClient"
+
+	log := s.log.With(slog.String("op", op))
+	log.Info("register oauth client attempt", slog.String("name", reg.Name))
+
+	event := newAuditEvent(models.AuditOAuthClientCreate, actorID, info, "")
+	defer s.audit(ctx, event, &err)
+
+	if err := validateRegistration(reg); err != nil {
+		log.Warn("invalid client metadata", "err", err)
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Error("failed to generate client id", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	client := &models.NewOAuthClient{
+		OAuthClient: models.OAuthClient{
+			ID:           hex.EncodeToString(id),
+			Name:         strings.TrimSpace(reg.Name),
+			RedirectURIs: reg.RedirectURIs,
+			GrantTypes:   reg.GrantTypes,
+			Scopes:       reg.Scopes,
+		},
+	}
+
+	if !reg.Public {
+		secret, err := token.NewOpaque()
+		if err != nil {
+			log.Error("failed to generate client secret", "err", err)
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		client.ClientSecret = secret
+		client.SecretHash = token.Hash(secret)
+	}
+
+	if err := s.clientStore.SaveOAuthClient(ctx, &client.OAuthClient); err != nil {
+		log.Error("failed to save client", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	event.Details = "client_id: " + client.ID
+	log.Info("oauth client registered", slog.String("clientID", client.ID))
+
+	return client, nil
+}
+
+func validateRegistration(reg ClientRegistration) error {
+	if name := strings.TrimSpace(reg.Name); name == "" || len(name) > 100 {
+		return newError(CodeInvalidClientMetadata, "name must be 1 to 100 characters long")
+	}
+
+	if len(reg.GrantTypes) == 0 {
+		return newError(CodeInvalidClientMetadata, "at least one grant type is required")
+	}
+
+	for _, grant := range reg.GrantTypes {
+		switch grant {
+		case models.GrantAuthorizationCode:
+			if len(reg.RedirectURIs) == 0 {
+				return newError(CodeInvalidClientMetadata, "authorization_code requires a redirect uri")
+			}
+		case models.GrantRefreshToken:
+			if !slices.Contains(reg.GrantTypes, models.GrantAuthorizationCode) {
+				return newError(CodeInvalidClientMetadata, "refresh_token requires authorization_code")
+			}
+		case models.GrantClientCredentials:
+			if reg.Public {
+				return newError(CodeInvalidClientMetadata, "public clients can't use client_credentials")
+			}
+		default:
+			return newError(CodeInvalidClientMetadata, "unsupported grant type %q", grant)
+		}
+	}
+
+	for _, raw := range reg.RedirectURIs {
+		u, err := url.Parse(raw)
+		if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+			return newError(CodeInvalidClientMetadata, "redirect uri %q must be an absolute url without fragment", raw)
+		}
+	}
+
+	for _, scope := range reg.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n\"\\") {
+			return newError(CodeInvalidClientMetadata, "invalid scope %q", scope)
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) ListClients(ctx context.Context) ([]models.OAuthClient, error) {
+	const op = "oauth.ListClients"
+
+	log := s.log.With(slog.String("op", op))
+	log.Info("list oauth clients attempt")
+
+	clients, err := s.clientStore.ListOAuthClients(ctx)
+	if err != nil {
+		log.Error("failed to list clients", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return clients, nil
+}
+
+// DeleteClient removes the client together with its codes and tokens.
+func (s *Server) DeleteClient(ctx context.Context, actorID int64, clientID string, info models.ClientInfo,
+) (err error) {
+	const op = "oauth.DeleteClient"
+
+	log := s.log.With(slog.String("op", op))
+	log.Info("delete oauth client attempt", slog.String("clientID", clientID))
+
+	defer s.audit(ctx, newAuditEvent(models.AuditOAuthClientDelete, actorID, info, "client_id: "+clientID), &err)
+
+	if err := s.clientStore.DeleteOAuthClient(ctx, clientID); err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			log.Warn("client not found", slog.String("clientID", clientID))
+			return ErrClientNotFound
+		}
+		log.Error("failed to delete client", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("oauth client deleted", slog.String("clientID", clientID))
+	return nil
+}
+
+// authenticateClient checks the client's credentials. Confidential clients
+// must present their secret, public clients must not have one.
+func (s *Server) authenticateClient(ctx context.Context, clientID, clientSecret string) (*models.OAuthClient, error) {
+	if clientID == "" {
+		return nil, newError(CodeInvalidClient, "client authentication required")
+	}
+
+	client, err := s.clientStore.OAuthClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, ErrClientNotFound) {
+			return nil, newError(CodeInvalidClient, "unknown client")
+		}
+		return nil, err
+	}
+
+	if !client.Confidential() {
+		if clientSecret != "" {
+			return nil, newError(CodeInvalidClient, "public clients have no secret")
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token.Hash(clientSecret)), []byte(client.SecretHash)) != 1 {
+		return nil, newError(CodeInvalidClient, "invalid client credentials")
+	}
+
+	return client, nil
+}
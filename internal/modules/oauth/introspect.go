@@ -0,0 +1,122 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+	"web_auth/internal/utils/token"
+)
+
+// Introspect describes a token to a resource server (RFC 7662). Only
+// confidential clients may introspect. Unknown, expired and revoked tokens as
+// well as tokens of blocked users are reported as inactive.
+func (s *Server) Introspect(ctx context.Context, clientID, clientSecret, rawToken string) (*models.OAuthIntrospection, error) {
+	const op = "oauth.Introspect"
+
+	log := s.log.With(slog.String("op", op), slog.String("clientID", clientID))
+
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) {
+			log.Warn("client authentication failed", slog.String("description", oauthErr.Description))
+			return nil, err
+		}
+		log.Error("failed to authenticate client", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !client.Confidential() {
+		log.Warn("public client tried to introspect")
+		return nil, newError(CodeUnauthorizedClient, "public clients can't introspect tokens")
+	}
+
+	inactive := &models.OAuthIntrospection{Active: false}
+
+	stored, err := s.tokenStore.OAuthTokenByHash(ctx, token.Hash(rawToken))
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return inactive, nil
+		}
+		log.Error("failed to get token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !stored.Active(time.Now()) {
+		return inactive, nil
+	}
+
+	resp := &models.OAuthIntrospection{
+		Active:    true,
+		Scope:     formatScope(stored.Scopes),
+		ClientID:  stored.ClientID,
+		TokenType: stored.Kind,
+		ExpiresAt: stored.ExpiresAt.Unix(),
+		IssuedAt:  stored.CreatedAt.Unix(),
+	}
+
+	if stored.UserID != nil {
+		user, err := s.userProvider.GetUserByID(ctx, *stored.UserID)
+		if err != nil {
+			if errors.Is(err, auth.ErrUserNotFound) {
+				return inactive, nil
+			}
+			log.Error("failed to get user", "err", err)
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !user.IsActive {
+			return inactive, nil
+		}
+		resp.Subject = strconv.FormatInt(user.ID, 10)
+	}
+
+	return resp, nil
+}
+
+// Revoke revokes the grant the token belongs to (RFC 7009). Unknown tokens
+// and tokens of other clients are ignored so that the response doesn't tell
+// whether a token exists.
+func (s *Server) Revoke(ctx context.Context, clientID, clientSecret, rawToken string) error {
+	const op = "oauth.Revoke"
+
+	log := s.log.With(slog.String("op", op), slog.String("clientID", clientID))
+
+	client, err := s.authenticateClient(ctx, clientID, clientSecret)
+	if err != nil {
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) {
+			log.Warn("client authentication failed", slog.String("description", oauthErr.Description))
+			return err
+		}
+		log.Error("failed to authenticate client", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	stored, err := s.tokenStore.OAuthTokenByHash(ctx, token.Hash(rawToken))
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return nil
+		}
+		log.Error("failed to get token", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if stored.ClientID != client.ID {
+		log.Warn("client tried to revoke a foreign token")
+		return nil
+	}
+
+	if err := s.tokenStore.RevokeOAuthGrant(ctx, stored.GrantID); err != nil {
+		log.Error("failed to revoke grant", "err", err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("oauth grant revoked", slog.String("grantID", stored.GrantID))
+	return nil
+}
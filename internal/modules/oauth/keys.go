@@ -0,0 +1,174 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"web_auth/internal/models"
+)
+
+const (
+	signingAlgorithm = "RS256"
+	signingKeyBits   = 2048
+)
+
+var errNoSigningKey = errors.New("no signing key")
+
+type SigningKeyStore interface {
+	SaveSigningKey(ctx context.Context, key *models.SigningKey) error
+	// SigningKeys returns all keys, newest first.
+	SigningKeys(ctx context.Context) ([]models.SigningKey, error)
+	DeleteSigningKey(ctx context.Context, keyID string) error
+}
+
+type signingKey struct {
+	id  string
+	key *rsa.PrivateKey
+}
+
+// signingKeys returns the keys to publish, the first one signs new ID
+// tokens. A new key is generated once the newest one is older than the
+// rotation period. A replaced key is kept for another ID token lifetime so
+// that tokens it signed can still be verified, then it is deleted.
+func (s *Server) signingKeys(ctx context.Context) ([]signingKey, error) {
+	stored, err := s.keyStore.SigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	if s.rotationDue(stored, now) {
+		if stored, err = s.rotateSigningKey(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	keys := make([]signingKey, 0, len(stored))
+	for i, sk := range stored {
+		// retired when its successor was created
+		if i > 0 && now.Sub(stored[i-1].CreatedAt) > s.cfg.IDTokenTTL {
+			if err := s.keyStore.DeleteSigningKey(ctx, sk.ID); err != nil {
+				s.log.Warn("failed to delete expired signing key", slog.String("kid", sk.ID), "err", err)
+			}
+			continue
+		}
+
+		key, err := s.parseSigningKey(sk)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %w", sk.ID, err)
+		}
+		keys = append(keys, signingKey{id: sk.ID, key: key})
+	}
+
+	return keys, nil
+}
+
+func (s *Server) rotationDue(stored []models.SigningKey, now time.Time) bool {
+	return len(stored) == 0 || now.Sub(stored[0].CreatedAt) >= s.cfg.SigningKeyRotation
+}
+
+// rotateSigningKey generates a new active key unless a concurrent request
+// already did, and returns the updated key list.
+func (s *Server) rotateSigningKey(ctx context.Context) ([]models.SigningKey, error) {
+	s.rotateMu.Lock()
+	defer s.rotateMu.Unlock()
+
+	stored, err := s.keyStore.SigningKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.rotationDue(stored, time.Now()) {
+		return stored, nil
+	}
+
+	key, err := newSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.keyStore.SaveSigningKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	s.log.Info("oidc signing key rotated", slog.String("kid", key.ID))
+
+	return append([]models.SigningKey{*key}, stored...), nil
+}
+
+// parseSigningKey decodes a stored key, caching the result since parsing RSA
+// keys is slow.
+func (s *Server) parseSigningKey(sk models.SigningKey) (*rsa.PrivateKey, error) {
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	if key, ok := s.parsedKeys[sk.ID]; ok {
+		return key, nil
+	}
+
+	block, _ := pem.Decode([]byte(sk.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA key")
+	}
+
+	s.parsedKeys[sk.ID] = key
+	return key, nil
+}
+
+func newSigningKey() (*models.SigningKey, error) {
+	key, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		ID:         hex.EncodeToString(id),
+		Algorithm:  signingAlgorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+func publicJWK(key signingKey) models.JSONWebKey {
+	pub := key.key.PublicKey
+
+	return models.JSONWebKey{
+		KeyType:   "RSA",
+		Use:       "sig",
+		Algorithm: signingAlgorithm,
+		KeyID:     key.id,
+		N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
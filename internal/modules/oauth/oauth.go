@@ -0,0 +1,138 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+)
+
+var (
+	ErrClientNotFound = errors.New("oauth client not found")
+	ErrCodeNotFound   = errors.New("authorization code not found")
+	ErrCodeReused     = errors.New("authorization code already used")
+	ErrTokenNotFound  = errors.New("oauth token not found")
+)
+
+// Error codes of RFC 6749 section 4.1.2.1 and 5.2 and RFC 7591.
+const (
+	CodeInvalidRequest          = "invalid_request"
+	CodeInvalidClient           = "invalid_client"
+	CodeInvalidGrant            = "invalid_grant"
+	CodeUnauthorizedClient      = "unauthorized_client"
+	CodeUnsupportedGrantType    = "unsupported_grant_type"
+	CodeUnsupportedResponseType = "unsupported_response_type"
+	CodeInvalidScope            = "invalid_scope"
+	CodeInvalidClientMetadata   = "invalid_client_metadata"
+)
+
+// Error is an OAuth protocol error that is reported to the client as is.
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func newError(code, format string, args ...any) *Error {
+	return &Error{Code: code, Description: fmt.Sprintf(format, args...)}
+}
+
+type ClientStore interface {
+	SaveOAuthClient(ctx context.Context, client *models.OAuthClient) error
+	OAuthClient(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	ListOAuthClients(ctx context.Context) ([]models.OAuthClient, error)
+	DeleteOAuthClient(ctx context.Context, clientID string) error
+}
+
+type CodeStore interface {
+	SaveAuthorizationCode(ctx context.Context, code *models.OAuthCode) error
+	// TakeAuthorizationCode marks the code used. A code that was used before
+	// is returned along with ErrCodeReused.
+	TakeAuthorizationCode(ctx context.Context, codeHash string) (*models.OAuthCode, error)
+}
+
+type TokenStore interface {
+	SaveOAuthTokens(ctx context.Context, tokens ...*models.OAuthToken) error
+	OAuthTokenByHash(ctx context.Context, tokenHash string) (*models.OAuthToken, error)
+	// RotateOAuthRefreshToken revokes the refresh token and saves its
+	// successors. It returns ErrTokenNotFound if the token was revoked
+	// meanwhile.
+	RotateOAuthRefreshToken(ctx context.Context, refreshID int64, tokens ...*models.OAuthToken) error
+	RevokeOAuthGrant(ctx context.Context, grantID string) error
+}
+
+type UserProvider interface {
+	GetUserByID(ctx context.Context, userID int64) (*models.User, error)
+}
+
+// AuditLog keeps the security audit trail.
+type AuditLog interface {
+	Record(ctx context.Context, event *models.AuditEvent) error
+}
+
+// Server is an OAuth 2.0 authorization server and OpenID Provider issuing
+// opaque access tokens and signed ID tokens for the users of the auth module.
+type Server struct {
+	log          *slog.Logger
+	cfg          config.OAuth
+	clientStore  ClientStore
+	codeStore    CodeStore
+	tokenStore   TokenStore
+	keyStore     SigningKeyStore
+	userProvider UserProvider
+	auditLog     AuditLog
+
+	rotateMu   sync.Mutex
+	keysMu     sync.Mutex
+	parsedKeys map[string]*rsa.PrivateKey
+}
+
+func New(log *slog.Logger,
+	cfg config.OAuth,
+	clientStore ClientStore,
+	codeStore CodeStore,
+	tokenStore TokenStore,
+	keyStore SigningKeyStore,
+	userProvider UserProvider,
+	auditLog AuditLog,
+) *Server {
+	return &Server{
+		log:          log,
+		cfg:          cfg,
+		clientStore:  clientStore,
+		codeStore:    codeStore,
+		tokenStore:   tokenStore,
+		keyStore:     keyStore,
+		userProvider: userProvider,
+		auditLog:     auditLog,
+		parsedKeys:   make(map[string]*rsa.PrivateKey),
+	}
+}
+
+func parseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+func formatScope(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// subset reports whether every requested scope is in allowed.
+func subset(requested, allowed []string) bool {
+	for _, scope := range requested {
+		if !slices.Contains(allowed, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,689 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+	"web_auth/internal/utils/token"
+)
+
+const (
+	testRedirectURI  = "https://app.example.test/callback"
+	testClientSecret = "confidential-secret"
+	testOtherSecret  = "other-secret"
+	// testVerifier is a valid PKCE verifier, 43 characters long.
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// memStore keeps clients, codes and tokens in memory. It implements the
+// store interfaces of Server the way the postgres storage does.
+type memStore struct {
+	mu sync.Mutex
+
+	clients map[string]*models.OAuthClient
+	codes   map[string]*memCode
+	tokens  []*models.OAuthToken
+	users   map[int64]*models.User
+	events  []models.AuditEvent
+	nextID  int64
+}
+
+type memCode struct {
+	code models.OAuthCode
+	used bool
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		clients: make(map[string]*models.OAuthClient),
+		codes:   make(map[string]*memCode),
+		users:   make(map[int64]*models.User),
+	}
+}
+
+func (s *memStore) SaveOAuthClient(_ context.Context, client *models.OAuthClient) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := *client
+	s.clients[client.ID] = &c
+	return nil
+}
+
+func (s *memStore) OAuthClient(_ context.Context, clientID string) (*models.OAuthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[clientID]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+	c := *client
+	return &c, nil
+}
+
+func (s *memStore) ListOAuthClients(context.Context) ([]models.OAuthClient, error) {
+	return nil, nil
+}
+
+func (s *memStore) DeleteOAuthClient(_ context.Context, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.clients[clientID]; !ok {
+		return ErrClientNotFound
+	}
+	delete(s.clients, clientID)
+	return nil
+}
+
+func (s *memStore) SaveAuthorizationCode(_ context.Context, code *models.OAuthCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.codes[code.CodeHash] = &memCode{code: *code}
+	return nil
+}
+
+func (s *memStore) TakeAuthorizationCode(_ context.Context, codeHash string) (*models.OAuthCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.codes[codeHash]
+	if !ok {
+		return nil, ErrCodeNotFound
+	}
+	code := stored.code
+	if stored.used {
+		return &code, ErrCodeReused
+	}
+	stored.used = true
+	return &code, nil
+}
+
+func (s *memStore) SaveOAuthTokens(_ context.Context, tokens ...*models.OAuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saveTokens(tokens)
+	return nil
+}
+
+func (s *memStore) saveTokens(tokens []*models.OAuthToken) {
+	for _, t := range tokens {
+		s.nextID++
+		t.ID = s.nextID
+		t.CreatedAt = time.Now()
+		stored := *t
+		s.tokens = append(s.tokens, &stored)
+	}
+}
+
+func (s *memStore) OAuthTokenByHash(_ context.Context, tokenHash string) (*models.OAuthToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.TokenHash == tokenHash {
+			stored := *t
+			return &stored, nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+func (s *memStore) RotateOAuthRefreshToken(_ context.Context, refreshID int64, tokens ...*models.OAuthToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.ID == refreshID {
+			if t.RevokedAt != nil {
+				return ErrTokenNotFound
+			}
+			now := time.Now()
+			t.RevokedAt = &now
+			s.saveTokens(tokens)
+			return nil
+		}
+	}
+	return ErrTokenNotFound
+}
+
+func (s *memStore) RevokeOAuthGrant(_ context.Context, grantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, t := range s.tokens {
+		if t.GrantID == grantID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (s *memStore) SaveSigningKey(context.Context, *models.SigningKey) error { return nil }
+
+func (s *memStore) SigningKeys(context.Context) ([]models.SigningKey, error) { return nil, nil }
+
+func (s *memStore) DeleteSigningKey(context.Context, string) error { return nil }
+
+func (s *memStore) GetUserByID(_ context.Context, userID int64) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, auth.ErrUserNotFound
+	}
+	u := *user
+	return &u, nil
+}
+
+func (s *memStore) Record(_ context.Context, event *models.AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, *event)
+	return nil
+}
+
+// newTestServer returns a server knowing an active user with id 1 and three
+// clients: "confidential" and "other" authenticate with a secret, "public"
+// has none and relies on PKCE alone.
+func newTestServer(t *testing.T) (*Server, *memStore) {
+	t.Helper()
+
+	store := newMemStore()
+	store.users[1] = &models.User{ID: 1, Email: "alice@example.com", IsActive: true}
+
+	allGrants := []string{models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials}
+	for _, client := range []*models.OAuthClient{
+		{ID: "confidential", SecretHash: token.Hash(testClientSecret), GrantTypes: allGrants},
+		{ID: "other", SecretHash: token.Hash(testOtherSecret), GrantTypes: allGrants},
+		{ID: "public", GrantTypes: []string{models.GrantAuthorizationCode, models.GrantRefreshToken}},
+	} {
+		client.RedirectURIs = []string{testRedirectURI}
+		client.Scopes = []string{"messages", "profile"}
+		store.clients[client.ID] = client
+	}
+
+	s := New(slog.New(slog.NewTextHandler(io.Discard, nil)), config.OAuth{
+		AuthorizationCodeTTL: time.Minute,
+		AccessTokenTTL:       time.Minute,
+		RefreshTokenTTL:      time.Hour,
+	}, store, store, store, store, store, store)
+
+	return s, store
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func authorizeRequest(clientID string) AuthorizeRequest {
+	return AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               "messages",
+		State:               "state",
+		CodeChallenge:       pkceChallenge(testVerifier),
+		CodeChallengeMethod: pkceMethodS256,
+	}
+}
+
+// redirectParams returns the query the client is sent back with.
+func redirectParams(t *testing.T, redirect string) url.Values {
+	t.Helper()
+
+	u, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatalf("parse redirect %q: %v", redirect, err)
+	}
+	if !strings.HasPrefix(redirect, testRedirectURI) {
+		t.Fatalf("redirect %q doesn't go to the registered uri", redirect)
+	}
+	return u.Query()
+}
+
+// authorize returns an authorization code for user 1.
+func authorize(t *testing.T, s *Server, req AuthorizeRequest) string {
+	t.Helper()
+
+	redirect, err := s.Authorize(context.Background(), &models.User{ID: 1}, req)
+	if err != nil {
+		t.Fatalf("Authorize: %v", err)
+	}
+	params := redirectParams(t, redirect)
+	if params.Get("code") == "" {
+		t.Fatalf("no code in %q", redirect)
+	}
+	return params.Get("code")
+}
+
+func codeRequest(clientID, secret, code string) TokenRequest {
+	return TokenRequest{
+		GrantType:    models.GrantAuthorizationCode,
+		ClientID:     clientID,
+		ClientSecret: secret,
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testVerifier,
+	}
+}
+
+// errorCode returns the OAuth error code of err, "" for nil.
+func errorCode(t *testing.T, err error) string {
+	t.Helper()
+
+	if err == nil {
+		return ""
+	}
+	var oauthErr *Error
+	if !errors.As(err, &oauthErr) {
+		t.Fatalf("error %v is not an OAuth error", err)
+	}
+	return oauthErr.Code
+}
+
+func TestAuthorizeRedirectURI(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		redirectURI string
+		// wantErr is returned instead of a redirect, the uri can't be
+		// trusted with the response.
+		wantErr bool
+	}{
+		{name: "registered", redirectURI: testRedirectURI},
+		{name: "omitted with a single registered uri", redirectURI: ""},
+		{name: "unregistered", redirectURI: "https://evil.example.test/callback", wantErr: true},
+		{name: "registered with extra path", redirectURI: testRedirectURI + "/../steal", wantErr: true},
+		{name: "registered with extra query", redirectURI: testRedirectURI + "?next=evil", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+
+			req := authorizeRequest("public")
+			req.RedirectURI = tc.redirectURI
+
+			redirect, err := s.Authorize(context.Background(), &models.User{ID: 1}, req)
+			if tc.wantErr {
+				if got := errorCode(t, err); got != CodeInvalidRequest {
+					t.Fatalf("Authorize error = %v, redirect = %q; want %s", err, redirect, CodeInvalidRequest)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+			if params := redirectParams(t, redirect); params.Get("code") == "" || params.Get("state") != "state" {
+				t.Errorf("redirect = %q, want a code and the state", redirect)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRefused(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		modify    func(req *AuthorizeRequest)
+		wantError string
+	}{
+		{
+			name:      "no code challenge",
+			modify:    func(req *AuthorizeRequest) { req.CodeChallenge = "" },
+			wantError: CodeInvalidRequest,
+		},
+		{
+			name:      "plain code challenge",
+			modify:    func(req *AuthorizeRequest) { req.CodeChallengeMethod = "plain" },
+			wantError: CodeInvalidRequest,
+		},
+		{
+			name:      "implicit flow",
+			modify:    func(req *AuthorizeRequest) { req.ResponseType = "token" },
+			wantError: CodeUnsupportedResponseType,
+		},
+		{
+			name:      "scope beyond the client's",
+			modify:    func(req *AuthorizeRequest) { req.Scope = "messages admin" },
+			wantError: CodeInvalidScope,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+
+			req := authorizeRequest("public")
+			tc.modify(&req)
+
+			redirect, err := s.Authorize(context.Background(), &models.User{ID: 1}, req)
+			if err != nil {
+				t.Fatalf("Authorize: %v", err)
+			}
+
+			params := redirectParams(t, redirect)
+			if params.Get("error") != tc.wantError || params.Get("code") != "" || params.Get("state") != "state" {
+				t.Errorf("redirect = %q, want error %s with the state and no code", redirect, tc.wantError)
+			}
+			if len(store.codes) != 0 {
+				t.Errorf("%d codes saved for a refused request", len(store.codes))
+			}
+		})
+	}
+}
+
+func TestExchangeCode(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(req *TokenRequest)
+		// ttl is the authorization code lifetime, a minute if zero.
+		ttl       time.Duration
+		wantError string
+	}{
+		{name: "valid", modify: func(*TokenRequest) {}},
+		{
+			name:      "wrong code verifier",
+			modify:    func(req *TokenRequest) { req.CodeVerifier = strings.Repeat("x", 43) },
+			wantError: CodeInvalidGrant,
+		},
+		{
+			name:      "code challenge as verifier",
+			modify:    func(req *TokenRequest) { req.CodeVerifier = pkceChallenge(testVerifier) },
+			wantError: CodeInvalidGrant,
+		},
+		{
+			name:      "no code verifier",
+			modify:    func(req *TokenRequest) { req.CodeVerifier = "" },
+			wantError: CodeInvalidGrant,
+		},
+		{
+			name:      "other redirect uri",
+			modify:    func(req *TokenRequest) { req.RedirectURI = "https://app.example.test/other" },
+			wantError: CodeInvalidGrant,
+		},
+		{
+			name:      "code of another client",
+			modify:    func(req *TokenRequest) { req.ClientID, req.ClientSecret = "other", testOtherSecret },
+			wantError: CodeInvalidGrant,
+		},
+		{
+			name:      "unknown code",
+			modify:    func(req *TokenRequest) { req.Code = "forged" },
+			wantError: CodeInvalidGrant,
+		},
+		{
+			name:      "expired code",
+			modify:    func(*TokenRequest) {},
+			ttl:       -time.Second,
+			wantError: CodeInvalidGrant,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+			if tc.ttl != 0 {
+				s.cfg.AuthorizationCodeTTL = tc.ttl
+			}
+
+			req := codeRequest("confidential", testClientSecret, authorize(t, s, authorizeRequest("confidential")))
+			tc.modify(&req)
+
+			resp, err := s.Token(context.Background(), req)
+			if got := errorCode(t, err); got != tc.wantError {
+				t.Fatalf("Token error = %v, want %q", err, tc.wantError)
+			}
+			if tc.wantError == "" && (resp.AccessToken == "" || resp.RefreshToken == "" || resp.Scope != "messages") {
+				t.Errorf("response = %+v", resp)
+			}
+		})
+	}
+}
+
+func TestExchangeCodeSingleUse(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := codeRequest("public", "", authorize(t, s, authorizeRequest("public")))
+
+	first, err := s.Token(context.Background(), req)
+	if err != nil {
+		t.Fatalf("first Token: %v", err)
+	}
+
+	if _, err := s.Token(context.Background(), req); errorCode(t, err) != CodeInvalidGrant {
+		t.Fatalf("replayed code error = %v, want %s", err, CodeInvalidGrant)
+	}
+
+	// a replayed code means it leaked, the tokens it gave are revoked
+	for _, raw := range []string{first.AccessToken, first.RefreshToken} {
+		info, err := s.Introspect(context.Background(), "confidential", testClientSecret, raw)
+		if err != nil {
+			t.Fatalf("Introspect: %v", err)
+		}
+		if info.Active {
+			t.Error("token of a replayed code still active")
+		}
+	}
+}
+
+func TestRefreshTokenReuse(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	first, err := s.Token(context.Background(),
+		codeRequest("public", "", authorize(t, s, authorizeRequest("public"))))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+
+	refresh := func(raw string) (*models.OAuthTokenResponse, error) {
+		return s.Token(context.Background(), TokenRequest{
+			GrantType:    models.GrantRefreshToken,
+			ClientID:     "public",
+			RefreshToken: raw,
+		})
+	}
+
+	second, err := refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refresh: %v", err)
+	}
+
+	if _, err := refresh(first.RefreshToken); errorCode(t, err) != CodeInvalidGrant {
+		t.Fatalf("replayed refresh token error = %v, want %s", err, CodeInvalidGrant)
+	}
+	if _, err := refresh(second.RefreshToken); errorCode(t, err) != CodeInvalidGrant {
+		t.Fatalf("refresh after reuse error = %v, want %s: the grant must be revoked", err, CodeInvalidGrant)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		clientID  string
+		secret    string
+		scope     string
+		wantError string
+	}{
+		{name: "valid", clientID: "confidential", secret: testClientSecret},
+		{name: "narrower scope", clientID: "confidential", secret: testClientSecret, scope: "profile"},
+		{name: "wrong secret", clientID: "confidential", secret: "guess", wantError: CodeInvalidClient},
+		{name: "secret of another client", clientID: "confidential", secret: testOtherSecret, wantError: CodeInvalidClient},
+		{name: "no secret", clientID: "confidential", wantError: CodeInvalidClient},
+		{name: "no client", wantError: CodeInvalidClient},
+		{name: "unknown client", clientID: "nobody", secret: testClientSecret, wantError: CodeInvalidClient},
+		{name: "public client", clientID: "public", wantError: CodeUnauthorizedClient},
+		{name: "public client with a secret", clientID: "public", secret: "anything", wantError: CodeInvalidClient},
+		{
+			name: "scope beyond the client's", clientID: "confidential", secret: testClientSecret, scope: "admin",
+			wantError: CodeInvalidScope,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, _ := newTestServer(t)
+
+			resp, err := s.Token(context.Background(), TokenRequest{
+				GrantType:    models.GrantClientCredentials,
+				ClientID:     tc.clientID,
+				ClientSecret: tc.secret,
+				Scope:        tc.scope,
+			})
+			if got := errorCode(t, err); got != tc.wantError {
+				t.Fatalf("Token error = %v, want %q", err, tc.wantError)
+			}
+			if tc.wantError == "" && (resp.AccessToken == "" || resp.RefreshToken != "") {
+				t.Errorf("response = %+v, want an access token only", resp)
+			}
+		})
+	}
+}
+
+func TestClientCredentialsForbiddenForPublicClient(t *testing.T) {
+	s, store := newTestServer(t)
+	// registration refuses this, a client edited in the database must not
+	// get tokens either
+	store.clients["public"].GrantTypes = append(store.clients["public"].GrantTypes, models.GrantClientCredentials)
+
+	_, err := s.Token(context.Background(), TokenRequest{GrantType: models.GrantClientCredentials, ClientID: "public"})
+	if got := errorCode(t, err); got != CodeUnauthorizedClient {
+		t.Fatalf("Token error = %v, want %s", err, CodeUnauthorizedClient)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// prepare gets the access token of user 1 issued to "public".
+		prepare    func(t *testing.T, s *Server, store *memStore, raw string) string
+		wantActive bool
+	}{
+		{
+			name:       "active token",
+			prepare:    func(_ *testing.T, _ *Server, _ *memStore, raw string) string { return raw },
+			wantActive: true,
+		},
+		{
+			name:    "unknown token",
+			prepare: func(*testing.T, *Server, *memStore, string) string { return "forged" },
+		},
+		{
+			name: "revoked token",
+			prepare: func(t *testing.T, s *Server, _ *memStore, raw string) string {
+				if err := s.Revoke(context.Background(), "public", "", raw); err != nil {
+					t.Fatalf("Revoke: %v", err)
+				}
+				return raw
+			},
+		},
+		{
+			name: "token of a blocked user",
+			prepare: func(_ *testing.T, _ *Server, store *memStore, raw string) string {
+				store.users[1].IsActive = false
+				return raw
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s, store := newTestServer(t)
+
+			resp, err := s.Token(context.Background(),
+				codeRequest("public", "", authorize(t, s, authorizeRequest("public"))))
+			if err != nil {
+				t.Fatalf("Token: %v", err)
+			}
+			raw := tc.prepare(t, s, store, resp.AccessToken)
+
+			info, err := s.Introspect(context.Background(), "confidential", testClientSecret, raw)
+			if err != nil {
+				t.Fatalf("Introspect: %v", err)
+			}
+			if info.Active != tc.wantActive {
+				t.Fatalf("active = %v, want %v", info.Active, tc.wantActive)
+			}
+			if !tc.wantActive && (info.Subject != "" || info.ClientID != "" || info.Scope != "") {
+				t.Errorf("inactive token described: %+v", info)
+			}
+			if tc.wantActive && (info.Subject != "1" || info.ClientID != "public" || info.Scope != "messages") {
+				t.Errorf("introspection = %+v", info)
+			}
+		})
+	}
+}
+
+func TestIntrospectRequiresConfidentialClient(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	resp, err := s.Token(context.Background(), codeRequest("public", "", authorize(t, s, authorizeRequest("public"))))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name      string
+		clientID  string
+		secret    string
+		wantError string
+	}{
+		{name: "public client", clientID: "public", wantError: CodeUnauthorizedClient},
+		{name: "wrong secret", clientID: "confidential", secret: "guess", wantError: CodeInvalidClient},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := s.Introspect(context.Background(), tc.clientID, tc.secret, resp.AccessToken)
+			if got := errorCode(t, err); got != tc.wantError {
+				t.Fatalf("Introspect = %+v, %v; want error %s", info, err, tc.wantError)
+			}
+		})
+	}
+}
+
+func TestRevokeForeignToken(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	resp, err := s.Token(context.Background(),
+		codeRequest("confidential", testClientSecret, authorize(t, s, authorizeRequest("confidential"))))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+
+	// the response must not tell whether the token exists
+	if err := s.Revoke(context.Background(), "other", testOtherSecret, resp.AccessToken); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := s.Revoke(context.Background(), "other", "guess", resp.AccessToken); errorCode(t, err) != CodeInvalidClient {
+		t.Fatalf("Revoke with a wrong secret error = %v, want %s", err, CodeInvalidClient)
+	}
+
+	for _, raw := range []string{resp.AccessToken, resp.RefreshToken} {
+		info, err := s.Introspect(context.Background(), "confidential", testClientSecret, raw)
+		if err != nil {
+			t.Fatalf("Introspect: %v", err)
+		}
+		if !info.Active {
+			t.Error("another client revoked the token")
+		}
+	}
+
+	// the owner revokes the whole grant with either token
+	if err := s.Revoke(context.Background(), "confidential", testClientSecret, resp.RefreshToken); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	info, err := s.Introspect(context.Background(), "confidential", testClientSecret, resp.AccessToken)
+	if err != nil {
+		t.Fatalf("Introspect: %v", err)
+	}
+	if info.Active {
+		t.Error("access token active after its grant was revoked")
+	}
+}
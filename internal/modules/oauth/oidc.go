@@ -0,0 +1,176 @@
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+	"web_auth/internal/utils/token"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OpenID Connect scopes. openid turns an authorization into an OIDC one and
+// adds an ID token to the token response, email adds the email claims.
+const (
+	ScopeOpenID = "openid"
+	ScopeEmail  = "email"
+)
+
+// Bearer token error codes of RFC 6750 section 3.1.
+const (
+	CodeInvalidToken      = "invalid_token"
+	CodeInsufficientScope = "insufficient_scope"
+)
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce,omitempty"`
+	AccessTokenHash string `json:"at_hash,omitempty"`
+	Email           string `json:"email,omitempty"`
+	EmailVerified   *bool  `json:"email_verified,omitempty"`
+}
+
+// Discovery returns the OpenID Provider metadata.
+func (s *Server) Discovery() models.OIDCDiscovery {
+	base := strings.TrimSuffix(s.cfg.Issuer, "/")
+
+	return models.OIDCDiscovery{
+		Issuer:                 s.cfg.Issuer,
+		AuthorizationEndpoint:  base + "/oauth/authorize",
+		TokenEndpoint:          base + "/oauth/token",
+		UserInfoEndpoint:       base + "/userinfo",
+		JWKSURI:                base + "/.well-known/jwks.json",
+		IntrospectionEndpoint:  base + "/oauth/introspect",
+		RevocationEndpoint:     base + "/oauth/revoke",
+		ScopesSupported:        []string{ScopeOpenID, ScopeEmail},
+		ResponseTypesSupported: []string{"code"},
+		GrantTypesSupported: []string{
+			models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials,
+		},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{signingAlgorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{pkceMethodS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "nonce", "at_hash", "email", "email_verified",
+		},
+	}
+}
+
+// JWKS returns the public keys ID tokens are signed with, including retired
+// keys whose tokens may still be valid.
+func (s *Server) JWKS(ctx context.Context) (*models.JSONWebKeySet, error) {
+	const op = "oauth.JWKS"
+
+	keys, err := s.signingKeys(ctx)
+	if err != nil {
+		s.log.With(slog.String("op", op)).Error("failed to load signing keys", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	set := &models.JSONWebKeySet{Keys: make([]models.JSONWebKey, 0, len(keys))}
+	for _, key := range keys {
+		set.Keys = append(set.Keys, publicJWK(key))
+	}
+
+	return set, nil
+}
+
+// UserInfo returns the claims of the user an OAuth access token was issued
+// for. The token must have the openid scope.
+func (s *Server) UserInfo(ctx context.Context, accessToken string) (*models.OIDCUserInfo, error) {
+	const op = "oauth.UserInfo"
+
+	log := s.log.With(slog.String("op", op))
+
+	stored, err := s.tokenStore.OAuthTokenByHash(ctx, token.Hash(accessToken))
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return nil, newError(CodeInvalidToken, "unknown access token")
+		}
+		log.Error("failed to get token", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if stored.Kind != models.OAuthTokenAccess || !stored.Active(time.Now()) || stored.UserID == nil {
+		return nil, newError(CodeInvalidToken, "access token is not valid")
+	}
+
+	if !slices.Contains(stored.Scopes, ScopeOpenID) {
+		return nil, newError(CodeInsufficientScope, "openid scope required")
+	}
+
+	user, err := s.userProvider.GetUserByID(ctx, *stored.UserID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return nil, newError(CodeInvalidToken, "access token is not valid")
+		}
+		log.Error("failed to get user", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if !user.IsActive {
+		log.Warn("blocked user's token presented", slog.Int64("userID", user.ID))
+		return nil, newError(CodeInvalidToken, "access token is not valid")
+	}
+
+	info := &models.OIDCUserInfo{Subject: strconv.FormatInt(user.ID, 10)}
+	if slices.Contains(stored.Scopes, ScopeEmail) {
+		verified := user.EmailVerifiedAt != nil
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+
+	return info, nil
+}
+
+// newIDToken signs an ID token for the user with the current key.
+func (s *Server) newIDToken(ctx context.Context, client *models.OAuthClient, user *models.User,
+	scopes []string, nonce, accessToken string,
+) (string, error) {
+	keys, err := s.signingKeys(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", errNoSigningKey
+	}
+
+	now := time.Now()
+
+	// at_hash is the left half of the access token's SHA-256 (OIDC Core 3.1.3.6)
+	sum := sha256.Sum256([]byte(accessToken))
+
+	claims := idTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.cfg.Issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			Audience:  jwt.ClaimStrings{client.ID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.IDTokenTTL)),
+		},
+		Nonce:           nonce,
+		AccessTokenHash: base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]),
+	}
+
+	if slices.Contains(scopes, ScopeEmail) {
+		verified := user.EmailVerifiedAt != nil
+		claims.Email = user.Email
+		claims.EmailVerified = &verified
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = keys[0].id
+
+	return idToken.SignedString(keys[0].key)
+}
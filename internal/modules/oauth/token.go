@@ -0,0 +1,320 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"web_auth/internal/models"
+	"web_auth/internal/modules/auth"
+	"web_auth/internal/utils/token"
+
+	"github.com/google/uuid"
+)
+
+const tokenTypeBearer = "Bearer"
+
+// TokenRequest holds the token endpoint parameters. The client credentials
+// come from HTTP Basic authentication or the request body.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+// Token serves the token endpoint for the authorization_code, refresh_token
+// and client_credentials grants. Protocol errors are returned as *Error.
+func (s *Server) Token(ctx context.Context, req TokenRequest) (*models.OAuthTokenResponse, error) {
+	const op = "oauth.Token"
+
+	log := s.log.With(slog.String("op", op), slog.String("clientID", req.ClientID), slog.String("grant", req.GrantType))
+	log.Info("token request")
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) {
+			log.Warn("client authentication failed", slog.String("description", oauthErr.Description))
+			return nil, err
+		}
+		log.Error("failed to authenticate client", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch req.GrantType {
+	case models.GrantAuthorizationCode, models.GrantRefreshToken, models.GrantClientCredentials:
+	default:
+		return nil, newError(CodeUnsupportedGrantType, "unsupported grant_type %q", req.GrantType)
+	}
+
+	if !client.AllowsGrant(req.GrantType) {
+		log.Warn("grant not allowed for client")
+		return nil, newError(CodeUnauthorizedClient, "client may not use %s", req.GrantType)
+	}
+
+	var resp *models.OAuthTokenResponse
+	switch req.GrantType {
+	case models.GrantAuthorizationCode:
+		resp, err = s.exchangeCode(ctx, log, client, req)
+	case models.GrantRefreshToken:
+		resp, err = s.refresh(ctx, log, client, req)
+	case models.GrantClientCredentials:
+		resp, err = s.clientCredentials(ctx, client, req)
+	}
+	if err != nil {
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) {
+			log.Warn("token request refused", slog.String("error", oauthErr.Code),
+				slog.String("description", oauthErr.Description))
+			return nil, err
+		}
+		log.Error("failed to issue tokens", "err", err)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	log.Info("tokens issued")
+	return resp, nil
+}
+
+func (s *Server) exchangeCode(ctx context.Context, log *slog.Logger, client *models.OAuthClient, req TokenRequest,
+) (*models.OAuthTokenResponse, error) {
+	code, err := s.codeStore.TakeAuthorizationCode(ctx, token.Hash(req.Code))
+	if err != nil {
+		if errors.Is(err, ErrCodeReused) {
+			// RFC 6749 section 4.1.2: tokens issued for a replayed code
+			// should be revoked.
+			log.Warn("authorization code reuse detected, revoking grant")
+			if err := s.tokenStore.RevokeOAuthGrant(ctx, code.GrantID); err != nil {
+				return nil, err
+			}
+			return nil, newError(CodeInvalidGrant, "authorization code already used")
+		}
+		if errors.Is(err, ErrCodeNotFound) {
+			return nil, newError(CodeInvalidGrant, "unknown authorization code")
+		}
+		return nil, err
+	}
+
+	if code.ClientID != client.ID {
+		return nil, newError(CodeInvalidGrant, "authorization code was issued to another client")
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return nil, newError(CodeInvalidGrant, "authorization code expired")
+	}
+	if code.RedirectURI != req.RedirectURI {
+		return nil, newError(CodeInvalidGrant, "redirect_uri doesn't match the authorization request")
+	}
+	if !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return nil, newError(CodeInvalidGrant, "invalid code_verifier")
+	}
+
+	user, err := s.activeUser(ctx, code.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	access, refresh, resp, err := s.newTokens(client, code.GrantID, &user.ID, code.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.addIDToken(ctx, resp, client, user, code.Scopes, code.Nonce); err != nil {
+		return nil, err
+	}
+
+	tokens := []*models.OAuthToken{access}
+	if refresh != nil {
+		tokens = append(tokens, refresh)
+	}
+
+	if err := s.tokenStore.SaveOAuthTokens(ctx, tokens...); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) refresh(ctx context.Context, log *slog.Logger, client *models.OAuthClient, req TokenRequest,
+) (*models.OAuthTokenResponse, error) {
+	stored, err := s.tokenStore.OAuthTokenByHash(ctx, token.Hash(req.RefreshToken))
+	if err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			return nil, newError(CodeInvalidGrant, "unknown refresh token")
+		}
+		return nil, err
+	}
+
+	if stored.Kind != models.OAuthTokenRefresh || stored.ClientID != client.ID {
+		return nil, newError(CodeInvalidGrant, "unknown refresh token")
+	}
+
+	if stored.RevokedAt != nil {
+		// Refresh tokens are single use like the first party ones, a
+		// replayed token has leaked.
+		log.Warn("refresh token reuse detected, revoking grant")
+		if err := s.tokenStore.RevokeOAuthGrant(ctx, stored.GrantID); err != nil {
+			return nil, err
+		}
+		return nil, newError(CodeInvalidGrant, "refresh token already used")
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, newError(CodeInvalidGrant, "refresh token expired")
+	}
+
+	scopes := stored.Scopes
+	if req.Scope != "" {
+		scopes = parseScope(req.Scope)
+		if !subset(scopes, stored.Scopes) {
+			return nil, newError(CodeInvalidScope, "scope exceeds the original grant")
+		}
+	}
+
+	user, err := s.activeUser(ctx, *stored.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	access, refresh, resp, err := s.newTokens(client, stored.GrantID, stored.UserID, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.addIDToken(ctx, resp, client, user, scopes, ""); err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenStore.RotateOAuthRefreshToken(ctx, stored.ID, access, refresh); err != nil {
+		if errors.Is(err, ErrTokenNotFound) {
+			// lost a race against another refresh with the same token
+			log.Warn("concurrent refresh token reuse, revoking grant")
+			if err := s.tokenStore.RevokeOAuthGrant(ctx, stored.GrantID); err != nil {
+				return nil, err
+			}
+			return nil, newError(CodeInvalidGrant, "refresh token already used")
+		}
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *Server) clientCredentials(ctx context.Context, client *models.OAuthClient, req TokenRequest,
+) (*models.OAuthTokenResponse, error) {
+	if !client.Confidential() {
+		return nil, newError(CodeUnauthorizedClient, "public clients can't use client_credentials")
+	}
+
+	scopes := client.Scopes
+	if req.Scope != "" {
+		scopes = parseScope(req.Scope)
+		if !subset(scopes, client.Scopes) {
+			return nil, newError(CodeInvalidScope, "requested scope is not allowed for the client")
+		}
+	}
+
+	// no refresh token, the client can simply authenticate again
+	access, _, resp, err := s.newTokens(client, uuid.NewString(), nil, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenStore.SaveOAuthTokens(ctx, access); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// activeUser refuses tokens for deleted and blocked users.
+func (s *Server) activeUser(ctx context.Context, userID int64) (*models.User, error) {
+	user, err := s.userProvider.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return nil, newError(CodeInvalidGrant, "user not found")
+		}
+		return nil, err
+	}
+
+	if !user.IsActive {
+		return nil, newError(CodeInvalidGrant, "user is blocked")
+	}
+
+	return user, nil
+}
+
+// addIDToken adds an ID token to responses of OpenID Connect grants.
+func (s *Server) addIDToken(ctx context.Context, resp *models.OAuthTokenResponse, client *models.OAuthClient,
+	user *models.User, scopes []string, nonce string,
+) error {
+	if !slices.Contains(scopes, ScopeOpenID) {
+		return nil
+	}
+
+	idToken, err := s.newIDToken(ctx, client, user, scopes, nonce, resp.AccessToken)
+	if err != nil {
+		return err
+	}
+
+	resp.IDToken = idToken
+	return nil
+}
+
+// newTokens creates an access token and, for user grants of clients allowed
+// to refresh, a refresh token.
+func (s *Server) newTokens(client *models.OAuthClient, grantID string, userID *int64, scopes []string,
+) (access, refresh *models.OAuthToken, resp *models.OAuthTokenResponse, err error) {
+	now := time.Now()
+
+	rawAccess, err := token.NewOpaque()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	access = &models.OAuthToken{
+		GrantID:   grantID,
+		Kind:      models.OAuthTokenAccess,
+		TokenHash: token.Hash(rawAccess),
+		ClientID:  client.ID,
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: now.Add(s.cfg.AccessTokenTTL),
+	}
+
+	resp = &models.OAuthTokenResponse{
+		AccessToken: rawAccess,
+		TokenType:   tokenTypeBearer,
+		ExpiresIn:   int(s.cfg.AccessTokenTTL.Seconds()),
+		Scope:       formatScope(scopes),
+	}
+
+	if userID == nil || !client.AllowsGrant(models.GrantRefreshToken) {
+		return access, nil, resp, nil
+	}
+
+	rawRefresh, err := token.NewOpaque()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	refresh = &models.OAuthToken{
+		GrantID:   grantID,
+		Kind:      models.OAuthTokenRefresh,
+		TokenHash: token.Hash(rawRefresh),
+		ClientID:  client.ID,
+		UserID:    userID,
+		Scopes:    scopes,
+		ExpiresAt: now.Add(s.cfg.RefreshTokenTTL),
+	}
+	resp.RefreshToken = rawRefresh
+
+	return access, refresh, resp, nil
+}
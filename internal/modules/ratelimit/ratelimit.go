@@ -0,0 +1,26 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"web_auth/internal/config"
+)
+
+// Result is the state of a bucket after a request was counted.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero if the
+	// request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets. Implementations shared between instances can be
+// plugged in instead of the in-memory one.
+type Store interface {
+	Take(ctx context.Context, key string, rule config.RateLimitRule) (Result, error)
+}
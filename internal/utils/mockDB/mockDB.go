@@ -35,7 +35,7 @@ func SeedDatabase(ctx context.Context, storage *postgres.Storage, numUsers, numM
 				SenderType:  getRandomSenderType(),
 				CreatedAt:   createdAt,
 			}
-			if err := storage.SaveMessage(ctx, message); err != nil {
+			if err := storage.SaveMessage(ctx, &message); err != nil {
 				log.Printf("Error creating message for user %d: %v", userID, err)
 			}
 		}
@@ -0,0 +1,177 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"web_auth/internal/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnsupportedAlg = errors.New("unsupported password hashing algorithm")
+	ErrMalformedHash  = errors.New("malformed password hash")
+)
+
+// Hasher produces PHC formatted hashes with the configured algorithm and
+// verifies hashes of every supported algorithm.
+type Hasher struct {
+	cfg config.Password
+}
+
+func New(cfg config.Password) (*Hasher, error) {
+	const op = "password.New"
+
+	switch cfg.Algorithm {
+	case AlgArgon2id:
+		if cfg.Argon2Parallelism == 0 || cfg.Argon2Parallelism > 255 {
+			return nil, fmt.Errorf("%s: argon2 parallelism must be in 1..255", op)
+		}
+	case AlgBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("%s: bcrypt cost must be in %d..%d", op, bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrUnsupportedAlg, cfg.Algorithm)
+	}
+
+	return &Hasher{cfg: cfg}, nil
+}
+
+func (h *Hasher) Hash(password string) (string, error) {
+	const op = "password.Hash"
+
+	if h.cfg.Algorithm == AlgBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", op, err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.cfg.Argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	params := argon2Params{
+		memory:      h.cfg.Argon2Memory,
+		iterations:  h.cfg.Argon2Iterations,
+		parallelism: uint8(h.cfg.Argon2Parallelism),
+	}
+	key := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism,
+		h.cfg.Argon2KeyLength)
+
+	return params.encode(salt, key), nil
+}
+
+// Verify reports whether password matches hash. It fails only if the hash
+// can't be parsed.
+func (h *Hasher) Verify(hash, password string) (bool, error) {
+	const op = "password.Verify"
+
+	switch {
+	case isBcrypt(hash):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+		return true, nil
+	case strings.HasPrefix(hash, "$"+AlgArgon2id+"$"):
+		params, salt, key, err := decodeArgon2(hash)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", op, err)
+		}
+		other := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism,
+			uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	default:
+		return false, fmt.Errorf("%s: %w", op, ErrMalformedHash)
+	}
+}
+
+// NeedsRehash reports whether hash was made with another algorithm or other
+// parameters than the configured ones.
+func (h *Hasher) NeedsRehash(hash string) bool {
+	if h.cfg.Algorithm == AlgBcrypt {
+		if !isBcrypt(hash) {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		return err != nil || cost != h.cfg.BcryptCost
+	}
+
+	params, salt, key, err := decodeArgon2(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.memory != h.cfg.Argon2Memory ||
+		params.iterations != h.cfg.Argon2Iterations ||
+		uint32(params.parallelism) != h.cfg.Argon2Parallelism ||
+		uint32(len(salt)) != h.cfg.Argon2SaltLength ||
+		uint32(len(key)) != h.cfg.Argon2KeyLength
+}
+
+func isBcrypt(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// encode formats an argon2id hash as a PHC string:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (p argon2Params) encode(salt, key []byte) string {
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgArgon2id, argon2.Version, p.memory, p.iterations, p.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+}
+
+func decodeArgon2(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgArgon2id {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	_, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism)
+	if err != nil || params.iterations == 0 || params.parallelism == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrMalformedHash
+	}
+
+	return params, salt, key, nil
+}
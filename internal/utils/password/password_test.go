@@ -0,0 +1,190 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"web_auth/internal/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testConfig uses cheap argon2id parameters to keep the tests fast.
+func testConfig() config.Password {
+	return config.Password{
+		Algorithm:         AlgArgon2id,
+		BcryptCost:        bcrypt.MinCost,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		Argon2SaltLength:  16,
+		Argon2KeyLength:   32,
+	}
+}
+
+func newTestHasher(t *testing.T, cfg config.Password) *Hasher {
+	t.Helper()
+
+	h, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return h
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := newTestHasher(t, testConfig())
+
+	hash, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("hash = %q, want a PHC argon2id string", hash)
+	}
+
+	for _, tc := range []struct {
+		password string
+		want     bool
+	}{
+		{password: "correct horse battery staple", want: true},
+		{password: "correct horse battery stapler"},
+		{password: ""},
+	} {
+		ok, err := h.Verify(hash, tc.password)
+		if err != nil {
+			t.Fatalf("Verify(%q): %v", tc.password, err)
+		}
+		if ok != tc.want {
+			t.Errorf("Verify(%q) = %v, want %v", tc.password, ok, tc.want)
+		}
+	}
+
+	other, err := h.Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if other == hash {
+		t.Error("two hashes of a password are equal, salt not random")
+	}
+}
+
+func TestVerifyLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("hunter2hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+
+	// configured for argon2id, bcrypt hashes of older accounts still verify
+	h := newTestHasher(t, testConfig())
+
+	if ok, err := h.Verify(string(legacy), "hunter2hunter2"); err != nil || !ok {
+		t.Errorf("Verify = %v, %v; want true", ok, err)
+	}
+	if ok, err := h.Verify(string(legacy), "hunter3hunter3"); err != nil || ok {
+		t.Errorf("Verify with a wrong password = %v, %v; want false", ok, err)
+	}
+	if !h.NeedsRehash(string(legacy)) {
+		t.Error("bcrypt hash not rehashed to argon2id")
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	hash, err := newTestHasher(t, testConfig()).Hash("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(cfg *config.Password)
+		want   bool
+	}{
+		{name: "same parameters", modify: func(*config.Password) {}},
+		{name: "more memory", modify: func(cfg *config.Password) { cfg.Argon2Memory = 2048 }, want: true},
+		{name: "more iterations", modify: func(cfg *config.Password) { cfg.Argon2Iterations = 2 }, want: true},
+		{name: "more parallelism", modify: func(cfg *config.Password) { cfg.Argon2Parallelism = 2 }, want: true},
+		{name: "longer salt", modify: func(cfg *config.Password) { cfg.Argon2SaltLength = 32 }, want: true},
+		{name: "longer key", modify: func(cfg *config.Password) { cfg.Argon2KeyLength = 64 }, want: true},
+		{name: "switch to bcrypt", modify: func(cfg *config.Password) { cfg.Algorithm = AlgBcrypt }, want: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			tc.modify(&cfg)
+
+			if got := newTestHasher(t, cfg).NeedsRehash(hash); got != tc.want {
+				t.Errorf("NeedsRehash = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNeedsRehashBcryptCost(t *testing.T) {
+	cfg := testConfig()
+	cfg.Algorithm = AlgBcrypt
+
+	hash, err := newTestHasher(t, cfg).Hash("hunter2hunter2")
+	if err != nil {
+		t.Fatalf("Hash: %v", err)
+	}
+	if newTestHasher(t, cfg).NeedsRehash(hash) {
+		t.Error("hash with the configured cost needs rehash")
+	}
+
+	cfg.BcryptCost++
+	if !newTestHasher(t, cfg).NeedsRehash(hash) {
+		t.Error("hash with a lower cost doesn't need rehash")
+	}
+}
+
+func TestVerifyMalformedHash(t *testing.T) {
+	h := newTestHasher(t, testConfig())
+
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=0,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=0$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$garbage$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$not*base64$a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdHNhbHRzYWx0c2FsdA$a2V5",
+	} {
+		ok, err := h.Verify(hash, "password")
+		if !errors.Is(err, ErrMalformedHash) || ok {
+			t.Errorf("Verify(%q) = %v, %v; want ErrMalformedHash", hash, ok, err)
+		}
+		if !h.NeedsRehash(hash) {
+			t.Errorf("NeedsRehash(%q) = false", hash)
+		}
+	}
+}
+
+func TestNewRejectsConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(cfg *config.Password)
+	}{
+		{name: "unknown algorithm", modify: func(cfg *config.Password) { cfg.Algorithm = "md5" }},
+		{name: "no argon2 parallelism", modify: func(cfg *config.Password) { cfg.Argon2Parallelism = 0 }},
+		{name: "argon2 parallelism overflow", modify: func(cfg *config.Password) { cfg.Argon2Parallelism = 256 }},
+		{
+			name: "bcrypt cost too low",
+			modify: func(cfg *config.Password) {
+				cfg.Algorithm, cfg.BcryptCost = AlgBcrypt, bcrypt.MinCost-1
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			tc.modify(&cfg)
+
+			if _, err := New(cfg); err == nil {
+				t.Error("New accepted the config")
+			}
+		})
+	}
+}
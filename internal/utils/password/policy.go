@@ -0,0 +1,155 @@
+package password
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"web_auth/internal/config"
+)
+
+// Violation codes returned by Policy.Check.
+const (
+	CodeTooShort      = "too_short"
+	CodeTooLong       = "too_long"
+	CodeMissingLower  = "missing_lower"
+	CodeMissingUpper  = "missing_upper"
+	CodeMissingDigit  = "missing_digit"
+	CodeMissingSymbol = "missing_symbol"
+	CodeContainsEmail = "contains_email"
+	CodeTooWeak       = "too_weak"
+	CodeBreached      = "breached"
+)
+
+// Violation is a single reason a password was rejected.
+type Violation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Policy validates new passwords against the configured rules.
+type Policy struct {
+	cfg      config.PasswordPolicy
+	breached *BreachedList
+}
+
+func NewPolicy(cfg config.PasswordPolicy) (*Policy, error) {
+	const op = "password.NewPolicy"
+
+	if cfg.MaxLength > 0 && cfg.MinLength > cfg.MaxLength {
+		return nil, fmt.Errorf("%s: min length %d exceeds max length %d", op, cfg.MinLength, cfg.MaxLength)
+	}
+
+	p := &Policy{cfg: cfg}
+
+	if cfg.BreachedDir != "" {
+		info, err := os.Stat(cfg.BreachedDir)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s: %s is not a directory", op, cfg.BreachedDir)
+		}
+		p.breached = NewBreachedList(cfg.BreachedDir)
+	}
+
+	return p, nil
+}
+
+// Check returns every rule the password breaks. email may be empty when the
+// owner isn't known. An error means the breached list couldn't be read, the
+// returned violations are still valid.
+func (p *Policy) Check(password, email string) ([]Violation, error) {
+	var violations []Violation
+	add := func(code, format string, args ...any) {
+		violations = append(violations, Violation{Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < p.cfg.MinLength {
+		add(CodeTooShort, "password must be at least %d characters long", p.cfg.MinLength)
+	}
+	if p.cfg.MaxLength > 0 && length > p.cfg.MaxLength {
+		add(CodeTooLong, "password must be at most %d characters long", p.cfg.MaxLength)
+	}
+
+	classes := charClasses(password)
+	if p.cfg.RequireLower && !classes.lower {
+		add(CodeMissingLower, "password must contain a lowercase letter")
+	}
+	if p.cfg.RequireUpper && !classes.upper {
+		add(CodeMissingUpper, "password must contain an uppercase letter")
+	}
+	if p.cfg.RequireDigit && !classes.digit {
+		add(CodeMissingDigit, "password must contain a digit")
+	}
+	if p.cfg.RequireSymbol && !classes.symbol {
+		add(CodeMissingSymbol, "password must contain a symbol")
+	}
+
+	if p.cfg.DisallowEmail && containsEmail(password, email) {
+		add(CodeContainsEmail, "password must not contain the email address")
+	}
+
+	if score := Strength(password); score < p.cfg.MinStrength {
+		add(CodeTooWeak, "password is too easy to guess (strength %d of 4, at least %d required)",
+			score, p.cfg.MinStrength)
+	}
+
+	if p.breached == nil || password == "" {
+		return violations, nil
+	}
+
+	breached, err := p.breached.Contains(password)
+	if err != nil {
+		return violations, fmt.Errorf("password.Check: %w", err)
+	}
+	if breached {
+		add(CodeBreached, "password has appeared in a data breach")
+	}
+
+	return violations, nil
+}
+
+type classSet struct {
+	lower, upper, digit, symbol, other bool
+}
+
+func charClasses(s string) classSet {
+	var c classSet
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		case r < utf8.RuneSelf && unicode.IsPrint(r):
+			c.symbol = true
+		default:
+			c.other = true
+		}
+	}
+	return c
+}
+
+// containsEmail reports whether password contains the whole email or its
+// local part, ignoring case. Very short local parts are ignored.
+func containsEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+
+	password = strings.ToLower(password)
+	email = strings.ToLower(email)
+
+	local, _, _ := strings.Cut(email, "@")
+	if len(local) < 3 {
+		return strings.Contains(password, email)
+	}
+
+	return strings.Contains(password, local)
+}
@@ -0,0 +1,179 @@
+package password
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"web_auth/internal/config"
+)
+
+const breachedPassword = "Vq8&zR3#pW6!"
+
+// writeBreached adds the passwords to a breached list in dir, in the layout of
+// the range downloads.
+func writeBreached(t *testing.T, dir string, passwords ...string) {
+	t.Helper()
+
+	for _, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+		line := "0000000000000000000000000000000000A:3\n" + hash[5:] + ":42\n"
+		f, err := os.OpenFile(filepath.Join(dir, hash[:5]+".txt"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString(line); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestPolicy(t *testing.T) *Policy {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeBreached(t, dir, breachedPassword)
+
+	p, err := NewPolicy(config.PasswordPolicy{
+		MinLength:     8,
+		MaxLength:     16,
+		RequireLower:  true,
+		RequireUpper:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+		DisallowEmail: true,
+		MinStrength:   2,
+		BreachedDir:   dir,
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	return p
+}
+
+func codes(violations []Violation) []string {
+	var codes []string
+	for _, v := range violations {
+		if v.Message == "" {
+			codes = append(codes, v.Code+" without a message")
+			continue
+		}
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestPolicyCheck(t *testing.T) {
+	p := newTestPolicy(t)
+
+	for _, tc := range []struct {
+		name     string
+		password string
+		email    string
+		want     []string
+	}{
+		{name: "valid", password: "Vx7#kq9!Lm2$", email: "alice@example.com"},
+		{name: "too short", password: "Vx7#kq9", want: []string{CodeTooShort}},
+		{name: "too long", password: "Vx7#kq9!Lm2$Rt5%Hz", want: []string{CodeTooLong}},
+		{name: "length counts runes", password: "Vx7#kq9!Lm2$ёжик", want: nil},
+		{name: "missing lower", password: "VX7#KQ9!LM2$", want: []string{CodeMissingLower}},
+		{name: "missing upper", password: "vx7#kq9!lm2$", want: []string{CodeMissingUpper}},
+		{name: "missing digit", password: "Vxq#kqz!Lmw$", want: []string{CodeMissingDigit}},
+		{name: "missing symbol", password: "Vx7kq9Lm2Tp4", want: []string{CodeMissingSymbol}},
+		{
+			name:     "contains email local part",
+			password: "ALICE#7Vx9kq",
+			email:    "alice@example.com",
+			want:     []string{CodeContainsEmail},
+		},
+		{name: "email unknown", password: "ALICE#7Vx9kq"},
+		{name: "short local part ignored", password: "Al#7Vx9kqLm2", email: "al@example.com"},
+		{
+			name:     "short local part, whole email",
+			password: "X1!al@ex.io",
+			email:    "al@ex.io",
+			want:     []string{CodeContainsEmail},
+		},
+		{name: "too weak", password: "Password1!", want: []string{CodeTooWeak}},
+		{name: "breached", password: breachedPassword, want: []string{CodeBreached}},
+		{
+			name:     "several rules",
+			password: "qwerty",
+			email:    "qwerty@example.com",
+			want: []string{
+				CodeTooShort, CodeMissingUpper, CodeMissingDigit, CodeMissingSymbol, CodeContainsEmail, CodeTooWeak,
+			},
+		},
+		{
+			name: "empty",
+			want: []string{
+				CodeTooShort, CodeMissingLower, CodeMissingUpper, CodeMissingDigit, CodeMissingSymbol, CodeTooWeak,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := p.Check(tc.password, tc.email)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if got := codes(violations); !slices.Equal(got, tc.want) {
+				t.Errorf("violations = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckBreachedListUnreadable(t *testing.T) {
+	dir := t.TempDir()
+
+	p, err := NewPolicy(config.PasswordPolicy{MinLength: 20, BreachedDir: dir})
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+
+	// a directory where the range file should be can't be read
+	sum := sha1.Sum([]byte("Vx7#kq9!Lm2$"))
+	prefix := strings.ToUpper(hex.EncodeToString(sum[:]))[:5]
+	if err := os.Mkdir(filepath.Join(dir, prefix+".txt"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	violations, err := p.Check("Vx7#kq9!Lm2$", "")
+	if err == nil {
+		t.Error("Check didn't report the unreadable breached list")
+	}
+	if got := codes(violations); !slices.Equal(got, []string{CodeTooShort}) {
+		t.Errorf("violations = %v, want the ones found before the lookup", got)
+	}
+}
+
+func TestNewPolicyRejectsConfig(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		cfg  config.PasswordPolicy
+	}{
+		{name: "min length over max", cfg: config.PasswordPolicy{MinLength: 20, MaxLength: 10}},
+		{name: "missing breached dir", cfg: config.PasswordPolicy{BreachedDir: filepath.Join(t.TempDir(), "missing")}},
+		{name: "breached dir is a file", cfg: config.PasswordPolicy{BreachedDir: file}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewPolicy(tc.cfg); err == nil {
+				t.Error("NewPolicy accepted the config")
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package token
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"web_auth/internal/config"
+	"web_auth/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrUnsupportedAlg   = errors.New("unsupported signing algorithm")
+	ErrMissingSignature = errors.New("signing key is not configured")
+)
+
+type Claims struct {
+	jwt.RegisteredClaims
+	Email     string `json:"email"`
+	SessionID string `json:"sid,omitempty"`
+	// Actor is set when someone else acts as the subject, see RFC 8693.
+	Actor *Actor `json:"act,omitempty"`
+}
+
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// UserID returns the numeric user id stored in the subject claim.
+func (c *Claims) UserID() (int64, error) {
+	return strconv.ParseInt(c.Subject, 10, 64)
+}
+
+type Manager struct {
+	method     jwt.SigningMethod
+	signKey    crypto.PrivateKey
+	verifyKey  crypto.PublicKey
+	issuer     string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func New(cfg config.Token) (*Manager, error) {
+	const op = "token.New"
+
+	m := &Manager{
+		issuer:     cfg.Issuer,
+		accessTTL:  cfg.AccessTTL,
+		refreshTTL: cfg.RefreshTTL,
+	}
+
+	var err error
+
+	switch cfg.Algorithm {
+	case "HS256":
+		if cfg.Secret == "" {
+			return nil, fmt.Errorf("%s: %w", op, ErrMissingSignature)
+		}
+		m.method = jwt.SigningMethodHS256
+		m.signKey = []byte(cfg.Secret)
+		m.verifyKey = []byte(cfg.Secret)
+	case "RS256":
+		m.method = jwt.SigningMethodRS256
+		m.signKey, m.verifyKey, err = loadKeys(cfg, jwt.ParseRSAPrivateKeyFromPEM, jwt.ParseRSAPublicKeyFromPEM)
+	case "EdDSA":
+		m.method = jwt.SigningMethodEdDSA
+		m.signKey, m.verifyKey, err = loadKeys(cfg, jwt.ParseEdPrivateKeyFromPEM, jwt.ParseEdPublicKeyFromPEM)
+	default:
+		return nil, fmt.Errorf("%s: %w: %q", op, ErrUnsupportedAlg, cfg.Algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return m, nil
+}
+
+// loadKeys reads the PEM encoded key pair. The public key is derived from the
+// private key when no separate public key file is configured.
+func loadKeys[Priv crypto.PrivateKey, Pub crypto.PublicKey](
+	cfg config.Token,
+	parsePriv func([]byte) (Priv, error),
+	parsePub func([]byte) (Pub, error),
+) (crypto.PrivateKey, crypto.PublicKey, error) {
+	var (
+		priv crypto.PrivateKey
+		pub  crypto.PublicKey
+	)
+
+	if cfg.PrivateKeyPath != "" {
+		raw, err := os.ReadFile(cfg.PrivateKeyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := parsePriv(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		priv = key
+		if signer, ok := any(key).(crypto.Signer); ok {
+			pub = signer.Public()
+		}
+	}
+
+	if cfg.PublicKeyPath != "" {
+		raw, err := os.ReadFile(cfg.PublicKeyPath)
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := parsePub(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		pub = key
+	}
+
+	if priv == nil {
+		return nil, nil, ErrMissingSignature
+	}
+
+	return priv, pub, nil
+}
+
+// NewAccessToken signs an access token of the session. Impersonation sessions
+// get the impersonator as actor.
+func (m *Manager) NewAccessToken(user *models.User, session *models.Session) (string, time.Time, error) {
+	const op = "token.NewAccessToken"
+
+	now := time.Now()
+	expiresAt := now.Add(m.accessTTL)
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   strconv.FormatInt(user.ID, 10),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Email:     user.Email,
+		SessionID: session.ID,
+	}
+	if session.ImpersonatorID != nil {
+		claims.Actor = &Actor{Subject: strconv.FormatInt(*session.ImpersonatorID, 10)}
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+// NewRefreshToken returns an opaque refresh token, the hash to persist and its
+// expiry.
+func (m *Manager) NewRefreshToken() (raw, hash string, expiresAt time.Time, err error) {
+	raw, err = NewOpaque()
+	if err != nil {
+		return "", "", time.Time{}, fmt.Errorf("token.NewRefreshToken: %w", err)
+	}
+
+	return raw, Hash(raw), time.Now().Add(m.refreshTTL), nil
+}
+
+// NewScopedToken signs a short-lived token that is only accepted by
+// ParseScoped with the same audience, e.g. a pending second factor challenge.
+func (m *Manager) NewScopedToken(subject, audience string, ttl time.Duration) (string, time.Time, error) {
+	const op = "token.NewScopedToken"
+
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+
+	claims := Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    m.issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(m.method, claims).SignedString(m.signKey)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return signed, expiresAt, nil
+}
+
+// Parse validates an access token. Scoped tokens are rejected.
+func (m *Manager) Parse(tokenString string) (*Claims, error) {
+	claims, err := m.parse(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(claims.Audience) != 0 {
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	return claims, nil
+}
+
+// ParseScoped validates a token issued by NewScopedToken for audience.
+func (m *Manager) ParseScoped(tokenString, audience string) (*Claims, error) {
+	return m.parse(tokenString, jwt.WithAudience(audience))
+}
+
+func (m *Manager) parse(tokenString string, opts ...jwt.ParserOption) (*Claims, error) {
+	var claims Claims
+
+	opts = append(opts,
+		jwt.WithValidMethods([]string{m.method.Alg()}),
+		jwt.WithIssuer(m.issuer),
+		jwt.WithExpirationRequired(),
+	)
+
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(*jwt.Token) (interface{}, error) {
+		return m.verifyKey, nil
+	}, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return &claims, nil
+}
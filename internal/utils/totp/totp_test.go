@@ -0,0 +1,79 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890".
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+// The RFC lists eight digit codes; six digit codes are their last six digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		want := v.code[len(v.code)-Digits:]
+
+		got, err := Code(rfcSecret, Step(time.Unix(v.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		if got != want {
+			t.Errorf("code at %d = %s, want %s", v.unix, got, want)
+		}
+	}
+}
+
+func TestCodeLowercaseSecret(t *testing.T) {
+	got, err := Code(strings.ToLower(rfcSecret), Step(time.Unix(59, 0)))
+	if err != nil || got != "287082" {
+		t.Fatalf("Code = %q, %v; want 287082", got, err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	for _, tc := range []struct {
+		name     string
+		code     string
+		skew     int
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: "050471", wantStep: current, wantOK: true},
+		{name: "surrounded by spaces", code: " 050471 ", wantStep: current, wantOK: true},
+		{name: "previous step within skew", code: "081804", skew: 1, wantStep: current - 1, wantOK: true},
+		{name: "previous step without skew", code: "081804"},
+		{name: "wrong code", code: "123456", skew: 1},
+		{name: "eight digits", code: "14050471", skew: 1},
+		{name: "empty", code: "", skew: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := Validate(rfcSecret, tc.code, now, tc.skew)
+			if ok != tc.wantOK || step != tc.wantStep {
+				t.Errorf("Validate = %d, %v; want %d, %v", step, ok, tc.wantStep, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestValidateMalformedSecret(t *testing.T) {
+	if _, ok := Validate("not base32!", "123456", time.Now(), 1); ok {
+		t.Error("code accepted for a malformed secret")
+	}
+}